@@ -0,0 +1,103 @@
+// Command greenanon anonymizes saved games for a dataset release.
+//
+// Usage:
+//
+//	greenanon -salt s [-k n] [-regions file] [-report file] [file ...]
+//
+// Each file holds one or more games as JSON. With no files, games
+// are read from standard input. Player IDs are replaced with salted
+// hashes, names are dropped, ages are binned, genders folded and
+// countries with fewer than k players coarsened into regions. The
+// anonymized games are written to standard output, one per line,
+// ready for greenexport. A k-anonymity report on the result is
+// written to the report file, or standard error; the command fails
+// without writing any games if a demographic tuple is shared by
+// fewer than k players.
+package main
+
+import (
+	"bufio"
+	"codenamesgreen/gameapi"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+func main() {
+	salt := flag.String("salt", "", "the secret salt for this release's player IDs")
+	k := flag.Int("k", 5, "the fewest players a demographic tuple may describe")
+	regionsFile := flag.String("regions", "regions/countries.csv", "a CSV file mapping countries to regions")
+	report := flag.String("report", "", "where to write the k-anonymity report; standard error if empty")
+	flag.Parse()
+
+	regions, err := gameapi.LoadRegions(*regionsFile)
+	if err != nil {
+		fatal(*regionsFile, err)
+	}
+
+	var games []*gameapi.Game
+	collect := func(g *gameapi.Game) error {
+		games = append(games, g)
+		return nil
+	}
+	if flag.NArg() == 0 {
+		if err := gameapi.ReadGames(os.Stdin, collect); err != nil {
+			fatal("stdin", err)
+		}
+	}
+	for _, name := range flag.Args() {
+		f, err := os.Open(name)
+		if err != nil {
+			fatal(name, err)
+		}
+		err = gameapi.ReadGames(f, collect)
+		f.Close()
+		if err != nil {
+			fatal(name, err)
+		}
+	}
+
+	a, err := gameapi.NewAnonymizer(games, gameapi.AnonymizeOptions{Salt: *salt, K: *k, Regions: regions})
+	if err != nil {
+		fatal("-salt", err)
+	}
+	for _, g := range games {
+		a.Anonymize(g)
+	}
+
+	// Check the result before writing any of it, so a release that
+	// fails the check never reaches standard output.
+	r := gameapi.KAnonymity(games, *k)
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		fatal("report", err)
+	}
+	b = append(b, '\n')
+	if *report == "" {
+		os.Stderr.Write(b)
+	} else if err := ioutil.WriteFile(*report, b, 0644); err != nil {
+		fatal(*report, err)
+	}
+	if len(r.Violations) > 0 {
+		fmt.Fprintf(os.Stderr, "greenanon: %d demographic tuples describe fewer than %d players\n", len(r.Violations), *k)
+		os.Exit(1)
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	out := json.NewEncoder(w)
+	for _, g := range games {
+		if err := out.Encode(g); err != nil {
+			fatal("stdout", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		fatal("stdout", err)
+	}
+}
+
+func fatal(name string, err error) {
+	fmt.Fprintf(os.Stderr, "greenanon: %s: %v\n", name, err)
+	os.Exit(1)
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"codenamesgreen/gameapi"
 	"fmt"
+	"time"
 )
 
 func main() {
@@ -12,7 +13,32 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
-	h := gameapi.Handler(wordLists)
+	layouts, err := gameapi.DefaultLayouts()
+	if err != nil {
+		panic(err)
+	}
+	wordMeta, err := gameapi.DefaultWordMetadata()
+	if err != nil {
+		panic(err)
+	}
+	blocklist, err := gameapi.DefaultBlocklist()
+	if err != nil {
+		panic(err)
+	}
+	h, err := gameapi.Handler(wordLists, gameapi.Config{
+		WordListDir:  "wordlists",
+		GameDir:      "games",
+		Layouts:      layouts,
+		WordMetadata: wordMeta,
+		Blocklist:    blocklist,
+		// Admin actions are turned off unless ADMIN_TOKEN is set.
+		AdminToken:   os.Getenv("ADMIN_TOKEN"),
+		// The client offers a restart after two minutes of waiting.
+		Inactivity: gameapi.InactivityPolicy{After: 2 * time.Minute, Requeue: true},
+	})
+	if err != nil {
+		panic(err)
+	}
 	port := os.Getenv("PORT")
 	// PORT env should not be set on EC2
 	if port == "" {
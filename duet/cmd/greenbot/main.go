@@ -0,0 +1,250 @@
+// Command greenbot seats a model in live Duet games, so trained
+// models can be played against people.
+//
+// Usage:
+//
+//	greenbot (-model-url url | -model-cmd command) [-server url] [-game id] [-team n] [-name name] [-player id] [-timeout d] [-fallback random|pass] [-games n]
+//
+// The bot joins the game with -game, or is paired like any other
+// player, and plays its side through the same endpoints as the
+// client. It joins as a bot, so its seat is marked with the bot
+// role, and plays the side the server gives it. Each decision is put to the model as a dataset task:
+// the task's name and its base_text, in the format of data/. With
+// -model-url, tasks are POSTed as {"task": ..., "base_text": ...}
+// and the model replies with {"output": ...}. With -model-cmd, the
+// command is run with sh and given one task per line on its
+// standard input, as {"id": n, "task": ..., "base_text": ...}, and
+// replies one line per task on its standard output, either as
+// {"id": n, "output": ...} or as the bare output.
+//
+// A clue takes a target_selection_task, a clue_generation_task
+// and a target_rationale_task for each target, and a guess a
+// generate_guess_task and a guess_rationale_task. The bot guesses
+// as many times as the clue had targets. When the model fails,
+// takes longer than -timeout or replies with something it can't
+// play, the bot falls back to random picks, or with -fallback
+// pass, ends the turn when it can. Fallback clues are drawn from
+// the word lists in wordlists/. Each move is logged to standard
+// error.
+package main
+
+import (
+	"bytes"
+	"codenamesgreen/gameapi"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+func main() {
+	server := flag.String("server", "http://localhost:8080", "the game server's URL")
+	modelURL := flag.String("model-url", "", "the URL of a model served over HTTP")
+	modelCmd := flag.String("model-cmd", "", "a model command that reads tasks on stdin, a line each")
+	gameID := flag.String("game", "", "the game to join; paired with a partner if empty")
+	team := flag.Int("team", 0, "the side to take, 1 or 2; any if 0")
+	name := flag.String("name", "Bot", "the name to play under")
+	playerID := flag.String("player", "", "the player ID to play under; made up if empty")
+	timeout := flag.Duration("timeout", gameapi.DefaultBotTimeout, "how long to wait for each answer from the model")
+	fallback := flag.String("fallback", gameapi.FallbackRandom, "what to do when the model fails: random or pass")
+	games := flag.Int("games", 1, "how many games to play")
+	flag.Parse()
+
+	var model gameapi.Model
+	switch {
+	case *modelURL != "" && *modelCmd == "":
+		model = gameapi.HTTPModel{URL: *modelURL}
+	case *modelCmd != "" && *modelURL == "":
+		cmd := exec.Command("sh", "-c", *modelCmd)
+		cmd.Stderr = os.Stderr
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			fatal(*modelCmd, err)
+		}
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			fatal(*modelCmd, err)
+		}
+		if err := cmd.Start(); err != nil {
+			fatal(*modelCmd, err)
+		}
+		defer cmd.Process.Kill()
+		model = gameapi.NewLineModel(stdout, stdin)
+	default:
+		fmt.Fprintln(os.Stderr, "greenbot: give one of -model-url and -model-cmd")
+		os.Exit(2)
+	}
+	if *fallback != gameapi.FallbackRandom && *fallback != gameapi.FallbackPass {
+		fmt.Fprintf(os.Stderr, "greenbot: unknown fallback %q\n", *fallback)
+		os.Exit(2)
+	}
+	if *playerID == "" {
+		*playerID = "bot-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+
+	wordLists, err := gameapi.DefaultWordlists()
+	if err != nil {
+		fatal("wordlists", err)
+	}
+	var clues []string
+	for _, words := range wordLists {
+		clues = append(clues, words...)
+	}
+
+	c := client{server: *server, playerID: *playerID, name: *name}
+	bot := &gameapi.Bot{
+		Model:    model,
+		PlayerID: *playerID,
+		Timeout:  *timeout,
+		Fallback: *fallback,
+		Clues:    clues,
+		Rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	for n := 0; n < *games; n++ {
+		if err := c.play(bot, *gameID, *team); err != nil {
+			fatal(*server, err)
+		}
+		*gameID = ""
+	}
+}
+
+// client talks to the game server for the bot.
+type client struct {
+	server   string
+	playerID string
+	name     string
+}
+
+// play joins a game and plays it to the end.
+func (c client) play(bot *gameapi.Bot, gameID string, team int) error {
+	var body struct {
+		GameID   *string `json:"game_id,omitempty"`
+		Team     int     `json:"team,omitempty"`
+		PlayerID string  `json:"player_id"`
+		Name     string  `json:"name"`
+		Bot      bool    `json:"bot"`
+	}
+	if gameID != "" {
+		body.GameID = &gameID
+	}
+	body.Team, body.PlayerID, body.Name, body.Bot = team, c.playerID, c.name, true
+	var raw json.RawMessage
+	if err := c.post("/new-game", body, &raw); err != nil {
+		return err
+	}
+	var g *gameapi.Game
+	if err := gameapi.ReadGames(bytes.NewReader(raw), func(read *gameapi.Game) error {
+		g = read
+		return nil
+	}); err != nil || g == nil {
+		return fmt.Errorf("reading the game: %v", err)
+	}
+	if bot.Team = g.Side(c.playerID); bot.Team == 0 {
+		return fmt.Errorf("game %s: no side to play", g.GameID)
+	}
+	log.Printf("game %s: playing side %d as %s", g.GameID, bot.Team, c.playerID)
+
+	ctx := context.Background()
+	for {
+		if outcome := g.Metrics().Outcome; outcome != "" {
+			log.Printf("game %s: %s", g.GameID, outcome)
+			return nil
+		}
+		if move, ok := bot.Next(ctx, g); ok {
+			if err := c.send(g, bot.Team, move); err != nil {
+				log.Printf("game %s: %s turned down: %v", g.GameID, move.Type, err)
+			}
+		}
+
+		var update gameapi.GameUpdate
+		if err := c.post("/events", map[string]interface{}{
+			"game_id":    g.GameID,
+			"seed":       g.Seed,
+			"player_id":  c.playerID,
+			"name":       c.name,
+			"team":       bot.Team,
+			"last_event": g.LastEvent(),
+		}, &update); err != nil {
+			return err
+		}
+		if update.Seed != g.Seed {
+			log.Printf("game %s: the game was replaced", g.GameID)
+			return nil
+		}
+		g.CatchUp(update.Events)
+	}
+}
+
+// send makes a move, logging it.
+func (c client) send(g *gameapi.Game, team int, move gameapi.BotMove) error {
+	note := ""
+	if move.Fallback {
+		note = " (fallback"
+		if move.Err != nil {
+			note += ": " + move.Err.Error()
+		}
+		note += ")"
+	}
+	body := map[string]interface{}{
+		"game_id":   g.GameID,
+		"seed":      g.Seed,
+		"player_id": c.playerID,
+		"name":      c.name,
+		"team":      team,
+	}
+	switch move.Type {
+	case gameapi.EventChat:
+		log.Printf("game %s: clue %q for %q%s", g.GameID, move.Message[0], move.Message[1:6], note)
+		body["message"] = move.Message
+		return c.post("/chat", body, nil)
+	case gameapi.EventGuess:
+		log.Printf("game %s: guess %q%s", g.GameID, g.Words[move.Index], note)
+		body["index"], body["rationale"] = move.Index, move.Rationale
+		err := c.post("/guess", body, nil)
+		if err != nil && move.Rationale != "" {
+			// The rationale may have been blocked; the guess stands without it.
+			body["rationale"] = ""
+			err = c.post("/guess", body, nil)
+		}
+		return err
+	case gameapi.EventEndTurn:
+		log.Printf("game %s: end turn%s", g.GameID, note)
+		return c.post("/end-turn", body, nil)
+	}
+	return fmt.Errorf("unknown move %q", move.Type)
+}
+
+// post sends body to the server as JSON and decodes the reply
+// into resp, if it isn't nil.
+func (c client) post(path string, body, resp interface{}) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	r, err := http.Post(c.server+path, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(r.Body)
+		return fmt.Errorf("%s: %s: %s", path, r.Status, bytes.TrimSpace(msg))
+	}
+	if resp == nil {
+		return nil
+	}
+	return json.NewDecoder(r.Body).Decode(resp)
+}
+
+func fatal(name string, err error) {
+	fmt.Fprintf(os.Stderr, "greenbot: %s: %v\n", name, err)
+	os.Exit(1)
+}
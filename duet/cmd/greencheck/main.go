@@ -0,0 +1,128 @@
+// Command greencheck replays saved games through the rules and
+// reports the inconsistencies in their event logs.
+//
+// Usage:
+//
+//	greencheck [-clean file] [-quarantine file] [file ...]
+//
+// Each file holds one or more games as JSON. With no files, games
+// are read from standard input. Each game with issues is written
+// to standard output as a line of JSON listing them: out-of-range
+// guesses, duplicate targets, seen-word lists that disagree with
+// the guesses, moves out of turn or order, missing join events and
+// the like. With -clean and -quarantine, the games without and
+// with issues are also written to those files, one per line, so
+// bad games can be kept out of greenexport. The command fails if
+// any game has issues.
+package main
+
+import (
+	"bufio"
+	"codenamesgreen/gameapi"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+func main() {
+	cleanFile := flag.String("clean", "", "where to write the games without issues")
+	quarantineFile := flag.String("quarantine", "", "where to write the games with issues")
+	flag.Parse()
+
+	clean, err := create(*cleanFile)
+	if err != nil {
+		fatal(*cleanFile, err)
+	}
+	quarantine, err := create(*quarantineFile)
+	if err != nil {
+		fatal(*quarantineFile, err)
+	}
+
+	out := json.NewEncoder(os.Stdout)
+	games, bad := 0, 0
+	each := func(g *gameapi.Game) error {
+		games++
+		issues := g.Validate()
+		if len(issues) == 0 {
+			return clean.Encode(g)
+		}
+		bad++
+		if err := quarantine.Encode(g); err != nil {
+			return err
+		}
+		return out.Encode(struct {
+			GameID string          `json:"game_id"`
+			Issues []gameapi.Issue `json:"issues"`
+		}{g.GameID, issues})
+	}
+
+	if flag.NArg() == 0 {
+		if err := gameapi.ReadGames(os.Stdin, each); err != nil {
+			fatal("stdin", err)
+		}
+	}
+	for _, name := range flag.Args() {
+		f, err := os.Open(name)
+		if err != nil {
+			fatal(name, err)
+		}
+		err = gameapi.ReadGames(f, each)
+		f.Close()
+		if err != nil {
+			fatal(name, err)
+		}
+	}
+	if err := clean.Close(); err != nil {
+		fatal(*cleanFile, err)
+	}
+	if err := quarantine.Close(); err != nil {
+		fatal(*quarantineFile, err)
+	}
+
+	fmt.Fprintf(os.Stderr, "greencheck: %d of %d games have issues\n", bad, games)
+	if bad > 0 {
+		os.Exit(1)
+	}
+}
+
+// gameFile writes games to a file, one per line. With no file
+// name, it throws them away.
+type gameFile struct {
+	f *os.File
+	w *bufio.Writer
+}
+
+func create(name string) (*gameFile, error) {
+	if name == "" {
+		return &gameFile{}, nil
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return &gameFile{f, bufio.NewWriter(f)}, nil
+}
+
+func (gf *gameFile) Encode(g *gameapi.Game) error {
+	if gf.f == nil {
+		return nil
+	}
+	return json.NewEncoder(gf.w).Encode(g)
+}
+
+func (gf *gameFile) Close() error {
+	if gf.f == nil {
+		return nil
+	}
+	if err := gf.w.Flush(); err != nil {
+		gf.f.Close()
+		return err
+	}
+	return gf.f.Close()
+}
+
+func fatal(name string, err error) {
+	fmt.Fprintf(os.Stderr, "greencheck: %s: %v\n", name, err)
+	os.Exit(1)
+}
@@ -0,0 +1,163 @@
+// Command greenexport writes saved Duet games out as a dataset:
+// one JSONL file per task and split, and a manifest.
+//
+// Usage:
+//
+//	greenexport [-out dir] [-group player|game|seed] [-seed n] [-split train,val,test] [-blocklist file] [-bots include|exclude|only] [file ...]
+//
+// Each file holds one or more games as JSON, such as the /game
+// endpoint returns or the server saves. With no files, games are
+// read from standard input. Records are written to
+// dir/<task>/<split>.jsonl, and the split settings and counts to
+// dir/manifest.json. Grouping by player keeps everyone who ever
+// shared a game in one split, so no player's turns leak between
+// splits, though one large group can fill a whole split: the
+// manifest records the biggest group's share, with a warning when
+// it's more than a split's. Grouping by seed keeps games on the
+// same board together. With -blocklist, blocked words are starred
+// out of clues, rationales and messages before anything is written.
+// With -bots exclude, games a bot played in are left out, and with
+// -bots only, every other game is.
+package main
+
+import (
+	"bufio"
+	"codenamesgreen/gameapi"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	out := flag.String("out", "export", "the directory to write the dataset to")
+	group := flag.String("group", gameapi.GroupByPlayer, "keep records together by player, game or seed")
+	seed := flag.Int64("seed", 1, "the seed for shuffling groups into splits")
+	split := flag.String("split", "0.8,0.1,0.1", "the train, val and test fractions")
+	blocklistFile := flag.String("blocklist", "", "a file of words to star out, one per line")
+	bots := flag.String("bots", gameapi.BotsInclude, "whether to keep games with bots: include, exclude or only")
+	flag.Parse()
+
+	fractions, err := parseFractions(*split)
+	if err != nil {
+		fatal("-split", err)
+	}
+	var blocklist *gameapi.Blocklist
+	if *blocklistFile != "" {
+		if blocklist, err = gameapi.LoadBlocklist(*blocklistFile, gameapi.BlockMask); err != nil {
+			fatal(*blocklistFile, err)
+		}
+	}
+
+	keep, err := gameapi.BotFilter(*bots)
+	if err != nil {
+		fatal("-bots", err)
+	}
+
+	var games []*gameapi.Game
+	collect := func(g *gameapi.Game) error {
+		if !keep(&g.GameState) {
+			return nil
+		}
+		g.Events = blocklist.RedactEvents(g.Events)
+		games = append(games, g)
+		return nil
+	}
+	if flag.NArg() == 0 {
+		if err := gameapi.ReadGames(os.Stdin, collect); err != nil {
+			fatal("stdin", err)
+		}
+	}
+	for _, name := range flag.Args() {
+		f, err := os.Open(name)
+		if err != nil {
+			fatal(name, err)
+		}
+		err = gameapi.ReadGames(f, collect)
+		f.Close()
+		if err != nil {
+			fatal(name, err)
+		}
+	}
+
+	splits, manifest, err := gameapi.SplitRecords(games, *group, *seed, fractions)
+	if err != nil {
+		fatal("split", err)
+	}
+	for _, name := range gameapi.Splits {
+		if f := manifest.Fractions[name]; f > 0 && manifest.LargestGroup > f {
+			fmt.Fprintf(os.Stderr, "greenexport: warning: one group holds %.0f%% of the records, more than the %s split's %.0f%%\n",
+				100*manifest.LargestGroup, name, 100*f)
+			break
+		}
+	}
+	for _, task := range gameapi.Tasks {
+		for _, name := range gameapi.Splits {
+			var records []gameapi.Record
+			for _, r := range splits[name] {
+				if r.Task == task {
+					records = append(records, r)
+				}
+			}
+			if err := writeJSONL(filepath.Join(*out, task, name+".jsonl"), records); err != nil {
+				fatal(task, err)
+			}
+		}
+	}
+
+	b, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		fatal("manifest", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(*out, "manifest.json"), append(b, '\n'), 0644); err != nil {
+		fatal("manifest", err)
+	}
+}
+
+func parseFractions(s string) ([3]float64, error) {
+	var fractions [3]float64
+	parts := strings.Split(s, ",")
+	if len(parts) != 3 {
+		return fractions, fmt.Errorf("want three fractions, got %q", s)
+	}
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return fractions, err
+		}
+		fractions[i] = f
+	}
+	return fractions, nil
+}
+
+func writeJSONL(filename string, records []gameapi.Record) error {
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func fatal(name string, err error) {
+	fmt.Fprintf(os.Stderr, "greenexport: %s: %v\n", name, err)
+	os.Exit(1)
+}
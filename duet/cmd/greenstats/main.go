@@ -0,0 +1,87 @@
+// Command greenstats computes clue and game metrics for saved
+// Duet games, such as those the /game endpoint returns.
+//
+// Usage:
+//
+//	greenstats [-summary | -pairs] [-bots include|exclude|only] [file ...]
+//
+// Each file holds one or more games as JSON. With no files, games
+// are read from standard input. The metrics of each game are
+// written as a line of JSON, followed by a summary of them all;
+// with -summary, only the summary is written. With -pairs, the
+// clues of finished games are grouped by the demographics of the
+// players who gave and guessed them, and each group is written
+// as a line of JSON instead. With -bots exclude, games a bot played
+// in are skipped, and with -bots only, every other game is.
+package main
+
+import (
+	"codenamesgreen/gameapi"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+func main() {
+	summaryOnly := flag.Bool("summary", false, "only write the summary of all games")
+	pairs := flag.Bool("pairs", false, "write metrics by giver and guesser demographics")
+	bots := flag.String("bots", gameapi.BotsInclude, "whether to count games with bots: include, exclude or only")
+	flag.Parse()
+	keep, err := gameapi.BotFilter(*bots)
+	if err != nil {
+		fatal("-bots", err)
+	}
+
+	var games []*gameapi.Game
+	var metrics []gameapi.GameMetrics
+	out := json.NewEncoder(os.Stdout)
+	each := func(g *gameapi.Game) error {
+		if g.Mode == gameapi.ModeClassic || !keep(&g.GameState) {
+			return nil
+		}
+		if *pairs {
+			games = append(games, g)
+			return nil
+		}
+		m := g.Metrics()
+		metrics = append(metrics, m)
+		if *summaryOnly {
+			return nil
+		}
+		return out.Encode(m)
+	}
+
+	if flag.NArg() == 0 {
+		if err := gameapi.ReadGames(os.Stdin, each); err != nil {
+			fatal("stdin", err)
+		}
+	}
+	for _, name := range flag.Args() {
+		f, err := os.Open(name)
+		if err != nil {
+			fatal(name, err)
+		}
+		err = gameapi.ReadGames(f, each)
+		f.Close()
+		if err != nil {
+			fatal(name, err)
+		}
+	}
+	if *pairs {
+		for _, p := range gameapi.PairAnalytics(games) {
+			if err := out.Encode(p); err != nil {
+				fatal("stdout", err)
+			}
+		}
+		return
+	}
+	if err := out.Encode(gameapi.Summarize(metrics)); err != nil {
+		fatal("stdout", err)
+	}
+}
+
+func fatal(name string, err error) {
+	fmt.Fprintf(os.Stderr, "greenstats: %s: %v\n", name, err)
+	os.Exit(1)
+}
@@ -0,0 +1,218 @@
+package gameapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// ClueMetrics describes one clue in a Duet game and the
+// guesses that answered it.
+type ClueMetrics struct {
+	Number          int      `json:"number"` // the clue's event number
+	Team            int      `json:"team"`   // the side that gave it
+	PlayerID        string   `json:"player_id"`
+	Bot             bool     `json:"bot,omitempty"` // the giver joined as a bot
+	Clue            string   `json:"clue"`
+	Targets         []string `json:"targets"`
+	IntendedTargets int      `json:"intended_targets"`
+	Guesses         int      `json:"guesses"`
+	TargetHits      int      `json:"target_hits"` // guesses that found an intended target
+	Green           int      `json:"green"`
+	Tan             int      `json:"tan"`
+	Black           int      `json:"black"`
+	TokensUsed      int      `json:"tokens_used"`
+	Seconds         int64    `json:"seconds"` // from the clue to the last move answering it
+}
+
+// GameMetrics rolls up the clues of a Duet game.
+type GameMetrics struct {
+	GameID      string        `json:"game_id"`
+	Clues       []ClueMetrics `json:"clues"`
+	Turns       int           `json:"turns"` // times the guessing side changed hands, plus one
+	Guesses     int           `json:"guesses"`
+	TargetHits  int           `json:"target_hits"`
+	Green       int           `json:"green"`
+	Tan         int           `json:"tan"`
+	Black       int           `json:"black"`
+	TokensUsed  int           `json:"tokens_used"`
+	Remaining   int           `json:"remaining"` // greens left unfound
+	Outcome     string        `json:"outcome,omitempty"`
+	Seconds     int64         `json:"seconds"`
+	Accuracy    float64       `json:"accuracy"`          // share of guesses that hit an intended target
+	AvgClueSize float64       `json:"avg_clue_size"`     // intended targets per clue
+	Partial     bool          `json:"partial,omitempty"` // a player withdrew; their clues are blank
+	Bot         bool          `json:"bot,omitempty"`     // a bot played
+}
+
+// Metrics replays a Duet game's events into per-clue metrics.
+// Each guess and end of turn is credited to the last clue the
+// other side gave before it.
+func (g *Game) Metrics() GameMetrics {
+	m := GameMetrics{GameID: g.GameID, Clues: []ClueMetrics{}, Partial: g.Partial, Bot: g.HasBot()}
+	s := g.newDuetState()
+	lastClue := [3]int{-1, -1, -1}
+	turn := 0
+	for _, e := range g.Events {
+		tokens := s.Tokens
+		applied := s.apply(e)
+		if s.Turn != turn {
+			turn = s.Turn
+			m.Turns++
+		}
+
+		if e.Type == "chat" && (e.Team == 1 || e.Team == 2) {
+			c := ClueMetrics{
+				Number:          e.Number,
+				Team:            e.Team,
+				PlayerID:        e.PlayerID,
+				Bot:             g.IsBot(e.PlayerID),
+				IntendedTargets: e.Num_target_words,
+			}
+			if len(e.Message) > 0 {
+				c.Clue = e.Message[0]
+			}
+			for i := 1; i <= 5 && i < len(e.Message); i++ {
+				if t := strings.TrimSpace(e.Message[i]); t != "" {
+					c.Targets = append(c.Targets, t)
+				}
+			}
+			m.Clues = append(m.Clues, c)
+			lastClue[e.Team] = len(m.Clues) - 1
+			continue
+		}
+		if !applied {
+			continue
+		}
+		i := lastClue[otherTeam(e.Team)]
+		if i < 0 {
+			continue
+		}
+		c := &m.Clues[i]
+		c.TokensUsed += s.Tokens - tokens
+		c.Seconds = e.Time - g.eventTime(c.Number)
+		if e.Type != "guess" {
+			continue
+		}
+		c.Guesses++
+		for _, t := range c.Targets {
+			if e.Index < len(g.Words) && strings.EqualFold(t, strings.TrimSpace(g.Words[e.Index])) {
+				c.TargetHits++
+				break
+			}
+		}
+		switch s.key(c.Team)[e.Index] {
+		case Green:
+			c.Green++
+		case Tan:
+			c.Tan++
+		case Black:
+			c.Black++
+		}
+	}
+
+	for _, c := range m.Clues {
+		m.Guesses += c.Guesses
+		m.TargetHits += c.TargetHits
+		m.Green += c.Green
+		m.Tan += c.Tan
+		m.Black += c.Black
+		m.AvgClueSize += float64(c.IntendedTargets)
+	}
+	if len(m.Clues) > 0 {
+		m.AvgClueSize /= float64(len(m.Clues))
+	}
+	if m.Guesses > 0 {
+		m.Accuracy = float64(m.TargetHits) / float64(m.Guesses)
+	}
+	m.TokensUsed = s.Tokens
+	m.Remaining = s.remainingGreens()
+	m.Outcome = s.Outcome
+	if m.Outcome == "" {
+		m.Outcome = g.Outcome
+	}
+	if n := len(g.Events); n > 0 {
+		m.Seconds = g.Events[n-1].Time - g.Events[0].Time
+	}
+	return m
+}
+
+// eventTime returns the time of the event with the given number.
+func (gs *GameState) eventTime(number int) int64 {
+	if number < 1 || number > len(gs.Events) {
+		return 0
+	}
+	return gs.Events[number-1].Time
+}
+
+// Summary rolls up the metrics of many games.
+type Summary struct {
+	Games       int            `json:"games"`
+	Outcomes    map[string]int `json:"outcomes"`
+	Clues       int            `json:"clues"`
+	Guesses     int            `json:"guesses"`
+	TargetHits  int            `json:"target_hits"`
+	Accuracy    float64        `json:"accuracy"`
+	AvgClueSize float64        `json:"avg_clue_size"`
+	AvgTokens   float64        `json:"avg_tokens"`
+	AvgSeconds  float64        `json:"avg_seconds"`
+}
+
+// Summarize rolls up the metrics of many games. Games that are
+// still being played count towards everything but the outcomes.
+func Summarize(games []GameMetrics) Summary {
+	s := Summary{Games: len(games), Outcomes: map[string]int{}}
+	intended := 0
+	for _, m := range games {
+		if m.Outcome != "" {
+			s.Outcomes[m.Outcome]++
+		}
+		s.Clues += len(m.Clues)
+		s.Guesses += m.Guesses
+		s.TargetHits += m.TargetHits
+		for _, c := range m.Clues {
+			intended += c.IntendedTargets
+		}
+		s.AvgTokens += float64(m.TokensUsed)
+		s.AvgSeconds += float64(m.Seconds)
+	}
+	if s.Games > 0 {
+		s.AvgTokens /= float64(s.Games)
+		s.AvgSeconds /= float64(s.Games)
+	}
+	if s.Clues > 0 {
+		s.AvgClueSize = float64(intended) / float64(s.Clues)
+	}
+	if s.Guesses > 0 {
+		s.Accuracy = float64(s.TargetHits) / float64(s.Guesses)
+	}
+	return s
+}
+
+// POST /metrics
+// get the clue and game metrics of a Duet game
+func (h *handler) handleMetrics(rw http.ResponseWriter, req *http.Request) {
+	var body struct {
+		GameID string `json:"game_id"`
+	}
+	err := json.NewDecoder(req.Body).Decode(&body)
+	if err != nil || body.GameID == "" {
+		writeError(rw, "malformed_body", "Unable to parse request body.", 400)
+		return
+	}
+
+	h.mu.Lock()
+	g, ok := h.games[body.GameID]
+	h.mu.Unlock()
+	if !ok {
+		writeError(rw, "not_found", "Game not found", 404)
+		return
+	}
+	if g.Mode == ModeClassic {
+		writeError(rw, "wrong_mode", "Metrics are only kept for Duet games.", 400)
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	writeJSON(rw, g.Metrics())
+}
@@ -0,0 +1,61 @@
+package gameapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	g := &Game{
+		GameID:    "g",
+		Words:     []string{"apple", "bear", "cat", "dog"},
+		OneLayout: []Color{Green, Tan, Green, Black},
+		TwoLayout: []Color{Green, Green, Tan, Tan},
+	}
+	for i, e := range []Event{
+		{Type: "join_side", Team: 1},
+		{Type: "chat", Team: 1, Message: []string{"fruit", "apple", "cat", "", "", ""}, Num_target_words: 2},
+		{Type: "guess", Team: 2, Index: 0}, // green, an intended target
+		{Type: "guess", Team: 2, Index: 1}, // tan, the turn passes
+		{Type: "chat", Team: 2, Message: []string{"animal", "bear", "", "", "", ""}, Num_target_words: 1},
+		{Type: "guess", Team: 1, Index: 1}, // side two's last green
+	} {
+		e.Number = i + 1
+		e.Time = 100 + 10*int64(i)
+		g.Events = append(g.Events, e)
+	}
+
+	m := g.Metrics()
+	want := []ClueMetrics{
+		{Number: 2, Team: 1, Clue: "fruit", Targets: []string{"apple", "cat"}, IntendedTargets: 2,
+			Guesses: 2, TargetHits: 1, Green: 1, Tan: 1, TokensUsed: 1, Seconds: 20},
+		{Number: 5, Team: 2, Clue: "animal", Targets: []string{"bear"}, IntendedTargets: 1,
+			Guesses: 1, TargetHits: 1, Green: 1, TokensUsed: 1, Seconds: 10},
+	}
+	if !reflect.DeepEqual(m.Clues, want) {
+		t.Errorf("Clues = %+v\nwant %+v", m.Clues, want)
+	}
+	if m.Turns != 3 || m.Guesses != 3 || m.TargetHits != 2 || m.TokensUsed != 2 ||
+		m.Remaining != 1 || m.Seconds != 50 || m.AvgClueSize != 1.5 || m.Outcome != "" {
+		t.Errorf("Unexpected game metrics %+v", m)
+	}
+
+	// Saved games give the same metrics, as the batch tool sees them.
+	b, err := json.Marshal(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved Game
+	if err := json.Unmarshal(b, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if got := saved.Metrics(); !reflect.DeepEqual(got, m) {
+		t.Errorf("Saved game metrics = %+v\nwant %+v", got, m)
+	}
+
+	s := Summarize([]GameMetrics{m, {Outcome: OutcomeWon, Guesses: 1, TokensUsed: 4}})
+	if s.Games != 2 || s.Clues != 2 || s.Guesses != 4 || s.Outcomes[OutcomeWon] != 1 || s.AvgTokens != 3 {
+		t.Errorf("Unexpected summary %+v", s)
+	}
+}
@@ -0,0 +1,243 @@
+package gameapi
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultK is the smallest group of players a demographic tuple
+// may pick out, when the options don't say.
+const defaultK = 5
+
+// AnonymizeOptions say how to anonymize games for a release.
+type AnonymizeOptions struct {
+	// Salt is mixed into every hashed player ID. Use a new one for
+	// each release, so IDs can't be matched across releases.
+	Salt string
+
+	// K is the smallest number of players any demographic tuple
+	// may describe. Countries with fewer players than this are
+	// replaced by their region. Zero means 5.
+	K int
+
+	// Regions maps countries to the regions rare countries are
+	// coarsened into. Countries missing from it become "Other".
+	Regions map[string]string
+}
+
+// Anonymizer rewrites games for a dataset release: it hashes player
+// IDs, drops display names and coarsens demographics.
+type Anonymizer struct {
+	opts      AnonymizeOptions
+	regions   map[string]string // by lower-case country
+	countries map[string]int    // players per lower-case country
+	spelling  map[string]string // how each lower-case country is released
+}
+
+// NewAnonymizer prepares to anonymize the games of a release.
+// It needs every game up front to tell which countries are rare.
+func NewAnonymizer(games []*Game, opts AnonymizeOptions) (*Anonymizer, error) {
+	if opts.Salt == "" {
+		return nil, errors.New("anonymizing needs a salt")
+	}
+	if opts.K <= 0 {
+		opts.K = defaultK
+	}
+	a := &Anonymizer{opts: opts, regions: map[string]string{}, countries: map[string]int{}, spelling: map[string]string{}}
+	for c, r := range opts.Regions {
+		key := countryKey(c)
+		a.regions[key] = r
+		a.spelling[key] = strings.TrimSpace(c)
+	}
+	seen := map[string]bool{}
+	for _, g := range games {
+		for id, j := range g.demographics() {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			key := countryKey(j.UserCountry)
+			a.countries[key]++
+			// Spell countries as the regions file does, or else
+			// pick one spelling the same way every time.
+			if c := strings.TrimSpace(j.UserCountry); a.regions[key] == "" && (a.spelling[key] == "" || c < a.spelling[key]) {
+				a.spelling[key] = c
+			}
+		}
+	}
+	return a, nil
+}
+
+// HashID returns the salted hash that stands in for a player ID.
+// The stand-ins for withdrawn players are kept as they are: they
+// only name a player within one game, and hashing them would join
+// every withdrawn player into one.
+func (a *Anonymizer) HashID(id string) string {
+	if id == "" || withdrawn(id) {
+		return id
+	}
+	sum := sha256.Sum256([]byte(a.opts.Salt + "\x00" + id))
+	return hex.EncodeToString(sum[:8])
+}
+
+// AgeBin coarsens an age into a ten-year bin.
+func AgeBin(age string) string {
+	n, err := strconv.Atoi(strings.TrimSpace(age))
+	switch {
+	case err != nil || n <= 0:
+		return "unknown"
+	case n < 18:
+		return "under 18"
+	case n < 25:
+		return "18-24"
+	case n >= 65:
+		return "65+"
+	}
+	low := (n-5)/10*10 + 5
+	return strconv.Itoa(low) + "-" + strconv.Itoa(low+9)
+}
+
+// genderLabel folds the free-text gender field into a few labels.
+func genderLabel(gender string) string {
+	switch strings.ToLower(strings.TrimSpace(gender)) {
+	case "":
+		return "unknown"
+	case "m", "male", "man":
+		return "male"
+	case "f", "female", "woman":
+		return "female"
+	}
+	return "other"
+}
+
+// Country returns a country, spelt the same way throughout the
+// release, or its region if fewer than K players come from it.
+func (a *Anonymizer) Country(country string) string {
+	key := countryKey(country)
+	switch {
+	case key == "":
+		return "unknown"
+	case a.countries[key] >= a.opts.K:
+		return a.spelling[key]
+	case a.regions[key] != "":
+		return a.regions[key]
+	}
+	return "Other"
+}
+
+// Anonymize rewrites a game's events in place.
+func (a *Anonymizer) Anonymize(g *Game) {
+	for i := range g.Events {
+		e := &g.Events[i]
+		e.PlayerID = a.HashID(e.PlayerID)
+		e.ReportedID = a.HashID(e.ReportedID)
+		e.Name = ""
+		if e.SideMembers != nil {
+			members := make([]string, len(e.SideMembers))
+			for j, id := range e.SideMembers {
+				members[j] = a.HashID(id)
+			}
+			e.SideMembers = members
+		}
+		if e.Type == "join_side" {
+			e.UserAge = AgeBin(e.UserAge)
+			e.UserGender = genderLabel(e.UserGender)
+			e.UserCountry = a.Country(e.UserCountry)
+		}
+	}
+}
+
+// Demographics is the tuple of fields that might pick a player out.
+type Demographics struct {
+	Age     string `json:"age"`
+	Gender  string `json:"gender"`
+	Country string `json:"country"`
+	Native  bool   `json:"native"`
+}
+
+// KViolation is a demographic tuple shared by fewer than K players.
+type KViolation struct {
+	Demographics
+	Players   []string `json:"players"` // their IDs, as released
+	GameIDs   []string `json:"game_ids"`
+	Records   int      `json:"records"` // join events with the tuple
+	Threshold int      `json:"threshold"`
+}
+
+// KReport sums up a k-anonymity check.
+type KReport struct {
+	K          int          `json:"k"`
+	Players    int          `json:"players"`
+	Tuples     int          `json:"tuples"`
+	Violations []KViolation `json:"violations"`
+}
+
+// KAnonymity checks that every demographic tuple in the games is
+// shared by at least k players, reporting the tuples that aren't.
+// It is meant to be run on anonymized games. Withdrawn players have
+// no demographics left, so they aren't counted.
+func KAnonymity(games []*Game, k int) KReport {
+	if k <= 0 {
+		k = defaultK
+	}
+	players := map[Demographics]map[string]bool{}
+	gameIDs := map[Demographics]map[string]bool{}
+	records := map[Demographics]int{}
+	seen := map[string]bool{}
+	for _, g := range games {
+		for _, e := range g.Events {
+			if e.Type != "join_side" || e.PlayerID == "" || withdrawn(e.PlayerID) {
+				continue
+			}
+			d := Demographics{e.UserAge, e.UserGender, e.UserCountry, e.UserNativeSpeaker}
+			if players[d] == nil {
+				players[d] = map[string]bool{}
+				gameIDs[d] = map[string]bool{}
+			}
+			players[d][e.PlayerID] = true
+			gameIDs[d][g.GameID] = true
+			records[d]++
+			seen[e.PlayerID] = true
+		}
+	}
+
+	r := KReport{K: k, Players: len(seen), Tuples: len(players), Violations: []KViolation{}}
+	for d, ids := range players {
+		if len(ids) >= k {
+			continue
+		}
+		v := KViolation{Demographics: d, Records: records[d], Threshold: k}
+		for id := range ids {
+			v.Players = append(v.Players, id)
+		}
+		for id := range gameIDs[d] {
+			v.GameIDs = append(v.GameIDs, id)
+		}
+		sort.Strings(v.Players)
+		sort.Strings(v.GameIDs)
+		r.Violations = append(r.Violations, v)
+	}
+	sort.Slice(r.Violations, func(i, j int) bool {
+		a, b := r.Violations[i], r.Violations[j]
+		if len(a.Players) != len(b.Players) {
+			return len(a.Players) < len(b.Players)
+		}
+		return a.Players[0] < b.Players[0]
+	})
+	return r
+}
+
+// LoadRegions reads a country to region map from a CSV file
+// with country and region columns.
+func LoadRegions(filename string) (map[string]string, error) {
+	regions := map[string]string{}
+	err := readCSV(filename, []string{"country", "region"}, func(row []string) error {
+		regions[row[0]] = row[1]
+		return nil
+	})
+	return regions, err
+}
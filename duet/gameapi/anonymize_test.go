@@ -0,0 +1,73 @@
+package gameapi
+
+import "testing"
+
+func TestAgeBin(t *testing.T) {
+	for age, want := range map[string]string{
+		"": "unknown", "abc": "unknown", "16": "under 18", "18": "18-24", " 24 ": "18-24",
+		"25": "25-34", "34": "25-34", "35": "35-44", "64": "55-64", "70": "65+",
+	} {
+		if got := AgeBin(age); got != want {
+			t.Errorf("AgeBin(%q) = %q, want %q", age, got, want)
+		}
+	}
+}
+
+func TestAnonymize(t *testing.T) {
+	join := func(id, name, age, country string) Event {
+		return Event{Type: "join_side", PlayerID: id, Name: name, UserAge: age, UserGender: "Female", UserCountry: country}
+	}
+	games := []*Game{
+		{GameID: "g1", GameState: GameState{Events: []Event{
+			join("a", "Ann", "27", "Canada"), join("b", "Bea", "29", "canada"),
+			{Type: "chat", PlayerID: "a", Name: "Ann", SideMembers: []string{"a", "c"}},
+		}}},
+		{GameID: "g2", GameState: GameState{Events: []Event{join("c", "Cy", "40", "Fiji")}}},
+	}
+	a, err := NewAnonymizer(games, AnonymizeOptions{Salt: "release-1", K: 2, Regions: map[string]string{"Fiji": "Oceania"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewAnonymizer(games, AnonymizeOptions{}); err == nil {
+		t.Error("Expected a salt to be required")
+	}
+	other, _ := NewAnonymizer(games, AnonymizeOptions{Salt: "release-2"})
+	if a.HashID("a") == other.HashID("a") || a.HashID("a") == "a" {
+		t.Error("Expected IDs to be hashed with the release's salt")
+	}
+	if a.HashID("withdrawn-1") != "withdrawn-1" {
+		t.Error("Expected a withdrawn player's stand-in to be kept")
+	}
+
+	for _, g := range games {
+		a.Anonymize(g)
+	}
+	e := games[0].Events[0]
+	if e.PlayerID != a.HashID("a") || e.Name != "" || e.UserAge != "25-34" || e.UserGender != "female" || e.UserCountry != "Canada" {
+		t.Errorf("Unexpected anonymized join %+v", e)
+	}
+	if chat := games[0].Events[2]; chat.Name != "" || chat.SideMembers[1] != a.HashID("c") {
+		t.Errorf("Unexpected anonymized chat %+v", chat)
+	}
+	if got := games[1].Events[0].UserCountry; got != "Oceania" {
+		t.Errorf("Expected a rare country to become its region, got %q", got)
+	}
+
+	r := KAnonymity(games, 2)
+	if r.Players != 3 || r.Tuples != 2 || len(r.Violations) != 1 {
+		t.Fatalf("Unexpected report %+v", r)
+	}
+	if v := r.Violations[0]; v.Country != "Oceania" || v.Players[0] != a.HashID("c") || v.GameIDs[0] != "g2" {
+		t.Errorf("Unexpected violation %+v", v)
+	}
+}
+
+func TestLoadRegions(t *testing.T) {
+	regions, err := LoadRegions("../regions/countries.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if regions["India"] != "Asia" || regions["United States"] != "Northern America" || regions["Fiji"] != "Oceania" {
+		t.Errorf("Unexpected regions %v", regions)
+	}
+}
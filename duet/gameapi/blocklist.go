@@ -0,0 +1,166 @@
+package gameapi
+
+import (
+	"codenamesgreen/dictionary-master"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// Blocklist policies say what happens to rationales and messages
+// with a blocked word. Clue words are always rejected, since a
+// masked clue can't be played.
+const (
+	BlockReject = "reject" // turn the submission away
+	BlockMask   = "mask"   // keep it with the blocked words starred out
+)
+
+// Blocklist screens what players type for offensive or
+// sensitive words before it reaches the event log.
+type Blocklist struct {
+	Policy string
+	words  dictionary.Interface
+}
+
+// NewBlocklist makes a blocklist of the given words, leaving out
+// any that are allowed, such as words on a study's boards.
+func NewBlocklist(words dictionary.Interface, policy string, allow ...string) *Blocklist {
+	if policy != BlockMask {
+		policy = BlockReject
+	}
+	allowed := dictionary.WithWords(allow...)
+	kept := dictionary.Filter(words, func(w string) bool {
+		return strings.TrimSpace(w) != "" && !allowed.Contains(w)
+	})
+	// Filter keeps the source's spelling; WithWords makes the
+	// lookups case insensitive whatever the source was.
+	return &Blocklist{Policy: policy, words: dictionary.WithWords(kept.Words()...)}
+}
+
+// LoadBlocklist reads a blocklist from a file with one word per line.
+func LoadBlocklist(filename, policy string) (*Blocklist, error) {
+	d, err := dictionary.Load(filename)
+	if err != nil {
+		return nil, err
+	}
+	return NewBlocklist(d, policy), nil
+}
+
+// DefaultBlocklist loads blocklist.txt, rejecting blocked words,
+// if the file exists.
+func DefaultBlocklist() (*Blocklist, error) {
+	const filename = "blocklist.txt"
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		return nil, nil
+	}
+	return LoadBlocklist(filename, BlockReject)
+}
+
+// tokenSpans returns the start and end byte offsets of
+// the words in s.
+func tokenSpans(s string) [][2]int {
+	var spans [][2]int
+	start := -1
+	for i, c := range s {
+		inWord := unicode.IsLetter(c) || unicode.IsMark(c) || unicode.IsDigit(c)
+		switch {
+		case inWord && start < 0:
+			start = i
+		case !inWord && start >= 0:
+			spans = append(spans, [2]int{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, [2]int{start, len(s)})
+	}
+	return spans
+}
+
+// Blocked returns the blocked words in s, in the order they
+// appear. A nil blocklist blocks nothing.
+func (b *Blocklist) Blocked(s string) []string {
+	if b == nil {
+		return nil
+	}
+	var blocked []string
+	for _, sp := range tokenSpans(s) {
+		if w := s[sp[0]:sp[1]]; b.words.Contains(w) {
+			blocked = append(blocked, w)
+		}
+	}
+	return blocked
+}
+
+// Mask stars out the blocked words in s.
+func (b *Blocklist) Mask(s string) string {
+	if b == nil {
+		return s
+	}
+	var out strings.Builder
+	last := 0
+	for _, sp := range tokenSpans(s) {
+		w := s[sp[0]:sp[1]]
+		if !b.words.Contains(w) {
+			continue
+		}
+		out.WriteString(s[last:sp[0]])
+		out.WriteString(strings.Repeat("*", len([]rune(w))))
+		last = sp[1]
+	}
+	out.WriteString(s[last:])
+	return out.String()
+}
+
+// Screen applies the policy to free text. It returns the text to
+// keep, or false if the text must be turned away.
+func (b *Blocklist) Screen(s string) (string, bool) {
+	if len(b.Blocked(s)) == 0 {
+		return s, true
+	}
+	if b.Policy == BlockMask {
+		return b.Mask(s), true
+	}
+	return s, false
+}
+
+// RedactEvents stars out blocked words in the clues, rationales
+// and messages of an event log, whatever the policy was when the
+// events were logged. It's meant to be run before logs are
+// exported, since the list may have grown since.
+func (b *Blocklist) RedactEvents(evts []Event) []Event {
+	if b == nil {
+		return evts
+	}
+	out := make([]Event, len(evts))
+	for i, e := range evts {
+		switch e.Type {
+		case "chat":
+			// Targets (1-5) are board words; the clue and
+			// rationales (6-10) are what players typed.
+			e.Message = b.maskMessage(e.Message, 0, 6, 7, 8, 9, 10)
+		case "clue", "message":
+			e.Message = b.maskMessage(e.Message, 0)
+		case "report":
+			e.Message = b.maskMessage(e.Message, 1)
+		}
+		e.Rationale = b.Mask(e.Rationale)
+		out[i] = e
+	}
+	return out
+}
+
+// maskMessage returns a copy of an event message with the
+// blocked words starred out of the given parts.
+func (b *Blocklist) maskMessage(msg []string, parts ...int) []string {
+	if msg == nil {
+		return nil
+	}
+	msg = append([]string(nil), msg...)
+	for _, j := range parts {
+		if j < len(msg) {
+			msg[j] = b.Mask(msg[j])
+		}
+	}
+	return msg
+}
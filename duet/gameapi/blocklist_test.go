@@ -0,0 +1,76 @@
+package gameapi
+
+import (
+	"codenamesgreen/dictionary-master"
+	"reflect"
+	"testing"
+)
+
+func TestBlocklist(t *testing.T) {
+	b := NewBlocklist(dictionary.WithWords("darn", "heck", "drat"), BlockMask, "drat")
+
+	if got := b.Blocked("Darn it, heck! Drat."); !reflect.DeepEqual(got, []string{"Darn", "heck"}) {
+		t.Errorf("Blocked = %q", got)
+	}
+	if got := b.Mask("Darn it, heck! Drat."); got != "**** it, ****! Drat." {
+		t.Errorf("Mask = %q", got)
+	}
+	if got, ok := b.Screen("darned good"); !ok || got != "darned good" {
+		t.Errorf("Expected only whole words to be blocked, got %q", got)
+	}
+
+	evts := []Event{
+		{Type: "chat", Message: []string{"heck", "darn", "", "", "", "", "what the darn", "", "", "", ""}},
+		{Type: "guess", Rationale: "oh heck no"},
+	}
+	redacted := b.RedactEvents(evts)
+	if got := redacted[0].Message; got[0] != "****" || got[1] != "darn" || got[6] != "what the ****" {
+		t.Errorf("Expected the clue and rationale masked but not the target, got %q", got)
+	}
+	if redacted[1].Rationale != "oh **** no" {
+		t.Errorf("Rationale = %q", redacted[1].Rationale)
+	}
+	if evts[0].Message[0] != "heck" {
+		t.Error("Expected the original log to be left alone")
+	}
+
+	var none *Blocklist
+	if got, ok := none.Screen("heck"); !ok || got != "heck" {
+		t.Error("Expected a nil blocklist to allow everything")
+	}
+}
+
+func TestBlocklistHandlers(t *testing.T) {
+	h := newTestHandler(t, Config{
+		Blocklist: NewBlocklist(dictionary.WithWords("heck"), BlockReject),
+	})
+
+	var game struct {
+		GameID string `json:"game_id"`
+		State  struct {
+			Seed string `json:"seed"`
+		} `json:"state"`
+	}
+	post(t, h, "/new-game", `{"player_id": "a", "name": "a"}`, &game)
+	post(t, h, "/new-game", `{"player_id": "b", "name": "b"}`, nil)
+	ids := `"game_id": "` + game.GameID + `", "seed": "` + game.State.Seed + `", "player_id": "a", "name": "a", "team": 1`
+
+	if status := post(t, h, "/message", `{`+ids+`, "text": "what the heck"}`, nil); status != 400 {
+		t.Errorf("Expected a blocked message to be rejected, got %d", status)
+	}
+	if status := post(t, h, "/guess", `{`+ids+`, "index": 0, "rationale": "heck if I know"}`, nil); status != 400 {
+		t.Errorf("Expected a blocked rationale to be rejected, got %d", status)
+	}
+	g := h.games[game.GameID]
+	target := g.Words[indexOf(g.OneLayout, Green)]
+	post(t, h, "/chat", `{`+ids+`, "message": ["heck", "`+target+`", "", "", "", "", "one two three", "", "", "", ""]}`, nil)
+	if last := g.Events[len(g.Events)-1]; last.Type != "chat_error" || last.ErrorMessage != "That clue word isn't allowed. Please choose a different clue!" {
+		t.Errorf("Expected a blocked clue to be turned away, got %+v", last)
+	}
+
+	h.blocklist.Policy = BlockMask
+	post(t, h, "/message", `{`+ids+`, "text": "what the heck"}`, nil)
+	if last := g.Events[len(g.Events)-1]; last.Type != "message" || last.Message[0] != "what the ****" {
+		t.Errorf("Expected a masked message, got %+v", last)
+	}
+}
@@ -0,0 +1,527 @@
+package gameapi
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Model answers the dataset tasks for a bot: given a task's
+// name and its base_text, in the format of data/, it returns
+// the output the task's CSVs would hold.
+type Model interface {
+	Complete(ctx context.Context, task, baseText string) (string, error)
+}
+
+// modelRequest is what a bot sends its model, over HTTP or as
+// one line of its standard input.
+type modelRequest struct {
+	ID       int    `json:"id,omitempty"`
+	Task     string `json:"task"`
+	BaseText string `json:"base_text"`
+}
+
+type modelReply struct {
+	ID     int    `json:"id,omitempty"`
+	Output string `json:"output"`
+}
+
+// HTTPModel is a model served over HTTP. Each task is POSTed to
+// URL as {"task": ..., "base_text": ...} and the model replies
+// with {"output": ...}.
+type HTTPModel struct {
+	URL    string
+	Client *http.Client // http.DefaultClient if nil
+}
+
+func (m HTTPModel) Complete(ctx context.Context, task, baseText string) (string, error) {
+	b, err := json.Marshal(modelRequest{Task: task, BaseText: baseText})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", m.URL, bytes.NewReader(b))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := m.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("model replied %s", resp.Status)
+	}
+	var reply modelReply
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return "", fmt.Errorf("decoding the model's reply: %v", err)
+	}
+	return reply.Output, nil
+}
+
+// LineModel is a model that reads tasks from its standard input
+// and writes outputs to its standard output, a line each. Each
+// task is a line of JSON, {"id": n, "task": ..., "base_text": ...},
+// and the model answers with {"id": n, "output": ...} or simply
+// the output as plain text. Replies with the id of a task that
+// already timed out are skipped, so a slow model doesn't fall
+// out of step; plain text replies can't be told apart that way.
+type LineModel struct {
+	mu     sync.Mutex
+	w      io.Writer
+	lines  chan string
+	err    error // why lines was closed
+	lastID int
+}
+
+// NewLineModel returns a model that writes tasks to w and reads
+// its replies from r, typically a subprocess's pipes.
+func NewLineModel(r io.Reader, w io.Writer) *LineModel {
+	m := &LineModel{w: w, lines: make(chan string)}
+	go func() {
+		sc := bufio.NewScanner(r)
+		sc.Buffer(nil, 1<<20)
+		for sc.Scan() {
+			m.lines <- sc.Text()
+		}
+		m.err = sc.Err()
+		if m.err == nil {
+			m.err = io.EOF
+		}
+		close(m.lines)
+	}()
+	return m
+}
+
+func (m *LineModel) Complete(ctx context.Context, task, baseText string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastID++
+	id := m.lastID
+	b, err := json.Marshal(modelRequest{ID: id, Task: task, BaseText: baseText})
+	if err != nil {
+		return "", err
+	}
+	if _, err := m.w.Write(append(b, '\n')); err != nil {
+		return "", err
+	}
+	for {
+		select {
+		case line, ok := <-m.lines:
+			if !ok {
+				return "", fmt.Errorf("model stopped replying: %v", m.err)
+			}
+			var reply modelReply
+			if json.Unmarshal([]byte(line), &reply) != nil {
+				return line, nil
+			}
+			if reply.ID == 0 || reply.ID == id {
+				return reply.Output, nil
+			}
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+}
+
+// What a bot does when its model fails, times out or replies
+// with something it can't play.
+const (
+	// FallbackRandom picks targets, clues and guesses at random.
+	FallbackRandom = "random"
+	// FallbackPass ends the turn instead of guessing when the
+	// rules allow it. Clues can't be passed on, so those are
+	// still picked at random.
+	FallbackPass = "pass"
+)
+
+// RoleBot is the role on a bot's join_side events in Duet games,
+// set when it asks for a game with "bot": true.
+const RoleBot = "bot"
+
+// IsBot reports whether the player joined the game as a bot.
+func (gs *GameState) IsBot(playerID string) bool {
+	for _, e := range gs.Events {
+		if e.Type == EventJoinSide && e.PlayerID == playerID && e.Role == RoleBot {
+			return true
+		}
+	}
+	return false
+}
+
+// HasBot reports whether a bot played in the game.
+func (gs *GameState) HasBot() bool {
+	for _, e := range gs.Events {
+		if e.Type == EventJoinSide && e.Role == RoleBot {
+			return true
+		}
+	}
+	return false
+}
+
+// Which games to keep by whether a bot played in them, for
+// exports and statistics.
+const (
+	BotsInclude = "include"
+	BotsExclude = "exclude" // only games between people
+	BotsOnly    = "only"    // only games a bot played in
+)
+
+// BotFilter returns whether to keep a game under the filter, one
+// of BotsInclude, BotsExclude and BotsOnly.
+func BotFilter(filter string) (func(*GameState) bool, error) {
+	switch filter {
+	case BotsInclude:
+		return func(*GameState) bool { return true }, nil
+	case BotsExclude:
+		return func(gs *GameState) bool { return !gs.HasBot() }, nil
+	case BotsOnly:
+		return (*GameState).HasBot, nil
+	}
+	return nil, fmt.Errorf("unknown bot filter %q; use include, exclude or only", filter)
+}
+
+// Side returns the side the game's events have the player on,
+// or 0 if they don't hold one.
+func (gs *GameState) Side(playerID string) int {
+	side := 0
+	for _, e := range gs.Events {
+		if e.PlayerID != playerID {
+			continue
+		}
+		switch e.Type {
+		case EventJoinSide:
+			side = e.Team
+		case EventPlayerLeft, EventRequeued:
+			side = 0
+		}
+	}
+	return side
+}
+
+// LastEvent returns the number of the latest event in a client's
+// copy of a game, to poll /events from. Events hidden from the
+// player, such as other players' reports, leave gaps in the
+// numbers, so it can be more than len(Events).
+func (gs *GameState) LastEvent() int {
+	if len(gs.Events) == 0 {
+		return 0
+	}
+	return gs.Events[len(gs.Events)-1].Number
+}
+
+// CatchUp adds the events from a poll of /events that a client's
+// copy of a game doesn't have yet.
+func (gs *GameState) CatchUp(evts []Event) {
+	last := gs.LastEvent()
+	for _, e := range evts {
+		if e.Number > last {
+			gs.Events = append(gs.Events, e)
+			last = e.Number
+		}
+	}
+}
+
+// DefaultBotTimeout is how long a bot waits for each answer
+// from its model.
+const DefaultBotTimeout = 15 * time.Second
+
+// fallbackRationale explains the targets and guesses a bot
+// picked without its model. It has the three words /chat asks
+// of a rationale.
+const fallbackRationale = "picked at random"
+
+// Bot plays one side of a Duet game with a Model, turning the
+// game into the dataset's tasks and their outputs back into moves.
+type Bot struct {
+	Model    Model
+	PlayerID string
+	Team     int
+	Timeout  time.Duration // for each answer; DefaultBotTimeout if zero
+	Fallback string        // FallbackRandom if empty
+	Clues    []string      // the words a fallback clue is drawn from
+	Rand     *rand.Rand    // seeded from the clock if nil
+}
+
+// BotMove is a move a bot wants to make, to be sent to the
+// endpoint for its type.
+type BotMove struct {
+	Type      string   `json:"type"`              // EventChat, EventGuess or EventEndTurn
+	Message   []string `json:"message,omitempty"` // a clue, as /chat takes it
+	Index     int      `json:"index"`
+	Rationale string   `json:"rationale,omitempty"`
+	Fallback  bool     `json:"fallback,omitempty"` // part of the move didn't come from the model
+	Err       error    `json:"-"`                  // why, if the model failed
+}
+
+// botTurn is where a game stands for one side.
+type botTurn struct {
+	s *DuetState
+	// since is the event that last passed the turn to this side
+	// or away from it, and clues the last clue from each side.
+	since       int
+	clues       [3]Event
+	guesses     []string        // guessed by this side since the other's last clue
+	tried       map[string]bool // every word this side guessed, counted or not
+	chatErrors  int             // this side's rejected clues since the turn passed
+	firstClueOK bool
+}
+
+func (b *Bot) turn(g *Game) botTurn {
+	t := botTurn{s: g.newDuetState(), tried: map[string]bool{}}
+	for _, e := range g.Events {
+		turn := t.s.Turn
+		applied := t.s.apply(e)
+		switch {
+		case turn != t.s.Turn && turn != 0:
+			t.since, t.chatErrors = e.Number, 0
+		case e.Type == EventChatError && e.PlayerID == b.PlayerID:
+			t.chatErrors++
+		}
+		if e.Team != 1 && e.Team != 2 {
+			continue
+		}
+		if e.Type == EventChat {
+			t.clues[e.Team] = e
+			if e.Team != b.Team {
+				t.guesses = nil
+			}
+		}
+		if e.Type == EventGuess && e.Team == b.Team && e.Index >= 0 && e.Index < len(g.Words) {
+			t.tried[normalizeWord(g.Words[e.Index])] = true
+			if applied {
+				t.guesses = append(t.guesses, strings.ToLower(g.Words[e.Index]))
+			}
+		}
+	}
+	t.firstClueOK = g.FirstClue == 0 || g.FirstClue == b.Team || g.firstClueSide() != 0
+	return t
+}
+
+// Next returns the bot's next move in g, asking its model as it
+// goes, or false if it's the other side's move or the game is
+// over. It doesn't change g: the caller sends the move and
+// calls Next again once the game's events include it.
+func (b *Bot) Next(ctx context.Context, g *Game) (BotMove, bool) {
+	if g.Mode == ModeClassic || g.Outcome != "" || b.Team != 1 && b.Team != 2 {
+		return BotMove{}, false
+	}
+	t := b.turn(g)
+	if t.s.Outcome != "" {
+		return BotMove{}, false
+	}
+	me, other := b.Team, otherTeam(b.Team)
+
+	// Give a clue whenever the other side has the turn and has
+	// none from us since it passed to them.
+	if t.s.Turn != me && t.s.hasHiddenGreens(me) && t.clues[me].Number <= t.since && t.firstClueOK {
+		return b.clue(ctx, g, t), true
+	}
+
+	// Otherwise guess for the other side's clue, as many times
+	// as it had targets, then end the turn. A clue from before
+	// the turn passed to us was already guessed for.
+	clue := t.clues[other]
+	if t.s.Turn == other || clue.Number == 0 || t.s.Turn == me && clue.Number <= t.since {
+		return BotMove{}, false
+	}
+	if t.s.Turn == me && len(t.guesses) >= clue.Num_target_words {
+		return BotMove{Type: EventEndTurn}, true
+	}
+	return b.guess(ctx, g, t)
+}
+
+func (b *Bot) clue(ctx context.Context, g *Game, t botTurn) BotMove {
+	move := BotMove{Type: EventChat}
+	board := t.s.board(g.Words, b.Team)
+
+	// A clue the server turned down is likely to be turned down
+	// again, so after one the fallback takes over.
+	var targets []string
+	var clue string
+	if t.chatErrors == 0 {
+		out, err := b.ask(ctx, &Record{Task: TaskTargetSelection, Board: board})
+		targets = pickWords(out, board.Green, 5)
+		if len(targets) == 0 {
+			move.Err = orBadReply(err, TaskTargetSelection, out)
+		} else {
+			out, err = b.ask(ctx, &Record{Task: TaskClueGeneration, Board: board, Targets: targets})
+			if clue = clueWord(out, g.Words); clue == "" {
+				move.Err = orBadReply(err, TaskClueGeneration, out)
+			}
+		}
+	}
+	if clue == "" {
+		move.Fallback = true
+		targets = []string{board.Green[b.rand().Intn(len(board.Green))]}
+		clue = b.fallbackClue(g.Words)
+	}
+
+	chat := ChatEvent{Clue: clue, Rationales: make([]string, 5)}
+	for i, target := range targets {
+		chat.Targets[i] = target
+		if move.Fallback {
+			chat.Rationales[i] = fallbackRationale
+			continue
+		}
+		out, err := b.ask(ctx, &Record{Task: TaskTargetRationale, Targets: targets, Clue: clue, Target: target})
+		if chat.Rationales[i] = rationale(out); chat.Rationales[i] == "" {
+			chat.Rationales[i] = fallbackRationale
+			move.Fallback, move.Err = true, orBadReply(err, TaskTargetRationale, out)
+		}
+	}
+	move.Message = NewEvent(chat).Message
+	return move
+}
+
+func (b *Bot) guess(ctx context.Context, g *Game, t botTurn) (BotMove, bool) {
+	me, other := b.Team, otherTeam(b.Team)
+	clue := t.clues[other].Message[0]
+	board := t.s.board(g.Words, other)
+	move := BotMove{Type: EventGuess}
+
+	// The server takes each guess only once, so a word guessed
+	// out of turn can't be guessed again.
+	var open []string
+	for _, w := range board.Remaining {
+		if !t.tried[normalizeWord(w)] {
+			open = append(open, w)
+		}
+	}
+	if len(open) == 0 {
+		return BotMove{Type: EventEndTurn}, t.s.Turn == me
+	}
+
+	out, err := b.ask(ctx, &Record{Task: TaskGenerateGuess, Board: board, Clue: clue})
+	picked := pickWords(out, open, 1)
+	if len(picked) == 0 {
+		move.Fallback, move.Err = true, orBadReply(err, TaskGenerateGuess, out)
+		// Ending the turn takes a guess first.
+		if b.Fallback == FallbackPass && t.s.Turn == me {
+			return BotMove{Type: EventEndTurn, Fallback: true, Err: move.Err}, true
+		}
+		picked = []string{open[b.rand().Intn(len(open))]}
+		move.Rationale = fallbackRationale
+	}
+	for i, w := range g.Words {
+		if strings.EqualFold(w, picked[0]) {
+			move.Index = i
+			break
+		}
+	}
+	if !move.Fallback {
+		guesses := append(append([]string{}, t.guesses...), picked[0])
+		out, _ := b.ask(ctx, &Record{Task: TaskGuessRationale, Guesses: guesses, Clue: clue, Guess: picked[0]})
+		move.Rationale = rationale(out)
+	}
+	return move, true
+}
+
+// ask puts one task to the model, giving up after the bot's timeout.
+func (b *Bot) ask(ctx context.Context, r *Record) (string, error) {
+	timeout := b.Timeout
+	if timeout == 0 {
+		timeout = DefaultBotTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return b.Model.Complete(ctx, r.Task, r.baseText())
+}
+
+func (b *Bot) rand() *rand.Rand {
+	if b.Rand == nil {
+		b.Rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return b.Rand
+}
+
+// fallbackClue draws a clue from the bot's clue words that isn't
+// on the board.
+func (b *Bot) fallbackClue(words []string) string {
+	var candidates []string
+	for _, w := range b.Clues {
+		if w = clueWord(w, words); w != "" {
+			candidates = append(candidates, w)
+		}
+	}
+	if len(candidates) == 0 {
+		return "pass"
+	}
+	return candidates[b.rand().Intn(len(candidates))]
+}
+
+// pickWords returns up to n distinct words from a model's output,
+// a comma-separated list like the task CSVs', that are among
+// allowed. Anything else in the output is ignored.
+func pickWords(out string, allowed []string, n int) []string {
+	ok := map[string]bool{}
+	for _, w := range allowed {
+		ok[normalizeWord(w)] = true
+	}
+	var words []string
+	for _, w := range strings.Split(out, ",") {
+		w = normalizeWord(strings.Trim(w, " '\"[]."))
+		if ok[w] && len(words) < n {
+			words = append(words, w)
+			delete(ok, w)
+		}
+	}
+	return words
+}
+
+// clueWord returns the first word of a model's output as a clue,
+// or "" if it isn't a word or is on the board.
+func clueWord(out string, board []string) string {
+	fields := strings.Fields(strings.ToLower(out))
+	if len(fields) == 0 {
+		return ""
+	}
+	w := strings.TrimFunc(fields[0], func(c rune) bool { return !isLetter(c) })
+	if w == "" || !isWord(w) {
+		return ""
+	}
+	for _, bw := range board {
+		if strings.EqualFold(bw, w) {
+			return ""
+		}
+	}
+	return w
+}
+
+// rationale returns a model's output as a rationale, or "" if it
+// hasn't the three words /chat asks for.
+func rationale(out string) string {
+	out = strings.Join(strings.Fields(out), " ")
+	n := 0
+	for _, w := range strings.Fields(out) {
+		if isWord(w) {
+			n++
+		}
+	}
+	if n < 3 {
+		return ""
+	}
+	return out
+}
+
+var errBadReply = errors.New("unusable reply")
+
+func orBadReply(err error, task, out string) error {
+	if err != nil {
+		return fmt.Errorf("%s: %w", task, err)
+	}
+	return fmt.Errorf("%s: %w %q", task, errBadReply, out)
+}
@@ -0,0 +1,347 @@
+package gameapi
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// modelFunc lets a function stand in for a model.
+type modelFunc func(ctx context.Context, task, baseText string) (string, error)
+
+func (f modelFunc) Complete(ctx context.Context, task, baseText string) (string, error) {
+	return f(ctx, task, baseText)
+}
+
+func botGame() *Game {
+	g := &Game{
+		Words:     []string{"apple", "bear", "cat", "dog", "egg"},
+		OneLayout: []Color{Green, Tan, Green, Black, Tan},
+		TwoLayout: []Color{Green, Green, Tan, Tan, Black},
+	}
+	g.Events = []Event{
+		{Number: 1, Type: EventJoinSide, Team: 1, PlayerID: "bot"},
+		{Number: 2, Type: EventJoinSide, Team: 2, PlayerID: "b"},
+	}
+	return g
+}
+
+func addBotEvent(g *Game, team int, playerID string, p Payload) {
+	e := NewEvent(p)
+	e.Number, e.Team, e.PlayerID = len(g.Events)+1, team, playerID
+	g.Events = append(g.Events, e)
+}
+
+func TestBotPlaysDuet(t *testing.T) {
+	asked := map[string]string{}
+	model := modelFunc(func(ctx context.Context, task, baseText string) (string, error) {
+		asked[task] = baseText
+		switch task {
+		case TaskTargetSelection:
+			return "cat, dog, apple", nil
+		case TaskClueGeneration:
+			return "Fruit!", nil
+		case TaskTargetRationale:
+			return "both are round things", nil
+		case TaskGenerateGuess:
+			return "bear", nil
+		}
+		return "bears are animals", nil
+	})
+	bot := &Bot{Model: model, PlayerID: "bot", Team: 1}
+	g := botGame()
+	ctx := context.Background()
+
+	move, ok := bot.Next(ctx, g)
+	if !ok || move.Type != EventChat || move.Fallback {
+		t.Fatalf("Expected the bot to open with a clue, got %+v", move)
+	}
+	if want := "green: ['apple', 'cat'], black: ['dog'], tan: ['bear', 'egg']"; asked[TaskTargetSelection] != want {
+		t.Errorf("target selection base_text = %q, want %q", asked[TaskTargetSelection], want)
+	}
+	if want := "black: ['dog'], tan: ['bear', 'egg'], targets: ['cat', 'apple']"; asked[TaskClueGeneration] != want {
+		t.Errorf("clue generation base_text = %q, want %q", asked[TaskClueGeneration], want)
+	}
+	want := []string{"fruit", "cat", "apple", "", "", "", "both are round things", "both are round things", "", "", ""}
+	if !reflect.DeepEqual(move.Message, want) {
+		t.Errorf("Message = %q, want %q", move.Message, want)
+	}
+	addBotEvent(g, 1, "bot", ChatEvent{Clue: "fruit", Targets: [5]string{"cat", "apple"}, NumTargets: 2})
+
+	// Nothing to do until the other side gives a clue.
+	if move, ok := bot.Next(ctx, g); ok {
+		t.Fatalf("Expected the bot to wait, got %+v", move)
+	}
+	addBotEvent(g, 2, "b", ChatEvent{Clue: "animal", Targets: [5]string{"bear"}, NumTargets: 1})
+
+	move, ok = bot.Next(ctx, g)
+	if !ok || move.Type != EventGuess || move.Index != 1 || move.Rationale != "bears are animals" {
+		t.Fatalf("Expected the bot to guess bear, got %+v", move)
+	}
+	if want := "remaining: ['apple', 'bear', 'cat', 'dog', 'egg'], hint: animal"; asked[TaskGenerateGuess] != want {
+		t.Errorf("generate guess base_text = %q, want %q", asked[TaskGenerateGuess], want)
+	}
+	addBotEvent(g, 1, "bot", GuessEvent{Index: 1})
+
+	// One target, one guess.
+	move, ok = bot.Next(ctx, g)
+	if !ok || move.Type != EventEndTurn {
+		t.Fatalf("Expected the bot to end its turn, got %+v", move)
+	}
+	addBotEvent(g, 1, "bot", EndTurnEvent{})
+
+	// The turn passed to the other side, who need a new clue.
+	move, ok = bot.Next(ctx, g)
+	if !ok || move.Type != EventChat {
+		t.Fatalf("Expected the bot to give another clue, got %+v", move)
+	}
+}
+
+func TestBotFallback(t *testing.T) {
+	slow := modelFunc(func(ctx context.Context, task, baseText string) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	})
+	bot := &Bot{
+		Model: slow, PlayerID: "bot", Team: 1, Timeout: 10 * time.Millisecond,
+		Clues: []string{"apple", "fruit"}, Rand: rand.New(rand.NewSource(1)),
+	}
+	g := botGame()
+	ctx := context.Background()
+
+	move, ok := bot.Next(ctx, g)
+	if !ok || move.Type != EventChat || !move.Fallback || !errors.Is(move.Err, context.DeadlineExceeded) {
+		t.Fatalf("Expected a fallback clue after a timeout, got %+v (%v)", move, move.Err)
+	}
+	if move.Message[0] != "fruit" || move.Message[6] != fallbackRationale {
+		t.Errorf("Expected a clue off the board with a rationale, got %q", move.Message)
+	}
+	if target := move.Message[1]; target != "apple" && target != "cat" {
+		t.Errorf("Expected a green target, got %q", target)
+	}
+
+	// A clue the server turned down is retried without the model.
+	addBotEvent(g, 1, "bot", ChatErrorEvent{"That clue word isn't allowed."})
+	bot.Model = modelFunc(func(context.Context, string, string) (string, error) {
+		t.Error("Expected the model not to be asked again")
+		return "", nil
+	})
+	if move, _ := bot.Next(ctx, g); !move.Fallback {
+		t.Errorf("Expected a fallback clue, got %+v", move)
+	}
+	addBotEvent(g, 1, "bot", ChatEvent{Clue: "fruit", Targets: [5]string{"apple"}, NumTargets: 1})
+	addBotEvent(g, 2, "b", ChatEvent{Clue: "animal", Targets: [5]string{"bear"}, NumTargets: 2})
+
+	// Guesses off the board fall back to a random one, and with
+	// FallbackPass to ending the turn once a guess was made.
+	bot.Model = modelFunc(func(context.Context, string, string) (string, error) {
+		return "zebra", nil
+	})
+	bot.Fallback = FallbackPass
+	move, ok = bot.Next(ctx, g)
+	if !ok || move.Type != EventGuess || !move.Fallback || !errors.Is(move.Err, errBadReply) {
+		t.Fatalf("Expected a random first guess, got %+v", move)
+	}
+	addBotEvent(g, 1, "bot", GuessEvent{Index: 1})
+	if move, _ := bot.Next(ctx, g); move.Type != EventEndTurn || !move.Fallback {
+		t.Errorf("Expected the bot to pass, got %+v", move)
+	}
+}
+
+func TestBotSkipsIgnoredGuesses(t *testing.T) {
+	model := modelFunc(func(context.Context, string, string) (string, error) {
+		return "bear", nil
+	})
+	bot := &Bot{Model: model, PlayerID: "bot", Team: 1, Rand: rand.New(rand.NewSource(1))}
+	g := botGame()
+	addBotEvent(g, 1, "bot", ChatEvent{Clue: "fruit", Targets: [5]string{"cat"}, NumTargets: 1})
+	addBotEvent(g, 2, "b", ChatEvent{Clue: "animal", Targets: [5]string{"bear"}, NumTargets: 1})
+	addBotEvent(g, 2, "b", GuessEvent{Index: 0})
+	// Out of turn, so it doesn't count, but the server won't take it twice.
+	addBotEvent(g, 1, "bot", GuessEvent{Index: 1})
+	addBotEvent(g, 2, "b", EndTurnEvent{})
+	addBotEvent(g, 2, "b", ChatEvent{Clue: "animal", Targets: [5]string{"bear"}, NumTargets: 1})
+
+	move, ok := bot.Next(context.Background(), g)
+	if !ok || move.Type != EventGuess || move.Index == 1 || !move.Fallback {
+		t.Errorf("Expected a fallback guess other than bear, got %+v", move)
+	}
+}
+
+func TestModelTransports(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		var body modelRequest
+		json.NewDecoder(req.Body).Decode(&body)
+		writeJSON(rw, modelReply{Output: body.Task + ": " + body.BaseText})
+	}))
+	defer srv.Close()
+	out, err := HTTPModel{URL: srv.URL}.Complete(context.Background(), TaskGenerateGuess, "hint: fruit")
+	if err != nil || out != "generate_guess_task: hint: fruit" {
+		t.Errorf("HTTPModel = %q, %v", out, err)
+	}
+
+	// A line model that only answers the first task once asked
+	// the second, then answers in plain text.
+	tasksR, tasksW := io.Pipe()
+	repliesR, repliesW := io.Pipe()
+	go func() {
+		sc := bufio.NewScanner(tasksR)
+		for n := 1; sc.Scan(); n++ {
+			switch n {
+			case 2:
+				io.WriteString(repliesW, `{"id": 1, "output": "late"}`+"\n")
+				io.WriteString(repliesW, `{"id": 2, "output": "field"}`+"\n")
+			case 3:
+				io.WriteString(repliesW, "sub\n")
+			}
+		}
+	}()
+	m := NewLineModel(repliesR, tasksW)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := m.Complete(ctx, TaskGenerateGuess, "hint: football"); err == nil {
+		t.Error("Expected the first task to time out")
+	}
+	for _, want := range []string{"field", "sub"} {
+		if out, err := m.Complete(context.Background(), TaskGenerateGuess, "hint: football"); err != nil || out != want {
+			t.Errorf("LineModel = %q, %v, want %q", out, err, want)
+		}
+	}
+}
+
+func TestBotJoinsAsBot(t *testing.T) {
+	h := newTestHandler(t, Config{})
+
+	var game struct {
+		GameID string `json:"game_id"`
+	}
+	post(t, h, "/new-game", `{"player_id": "a", "name": "a", "team": 1}`, &game)
+	g := h.games[game.GameID]
+
+	// A bot asking for the game by its ID takes its seat straight
+	// away, marked as a bot, rather than when it first polls.
+	if code := post(t, h, "/new-game", `{"game_id": "`+game.GameID+`", "player_id": "bot", "name": "Bot", "bot": true}`, nil); code != 200 {
+		t.Fatalf("Expected the bot to join, got %d", code)
+	}
+	if side := g.Side("bot"); side != 2 {
+		t.Fatalf("Expected the bot on side 2, got %d", side)
+	}
+	if j := g.joinEvent("bot"); j.Role != RoleBot {
+		t.Errorf("Expected the bot's join to have the bot role, got %+v", j)
+	}
+	if !g.IsBot("bot") || g.IsBot("a") || !g.HasBot() {
+		t.Error("Expected only the bot to count as one")
+	}
+	if errs := g.Validate(); len(errs) != 0 {
+		t.Errorf("Expected the bot's join to validate, got %v", errs)
+	}
+
+	// A bot paired like anyone else is marked too.
+	post(t, h, "/new-game", `{"player_id": "bot2", "name": "Bot", "bot": true}`, &game)
+	if g := h.games[game.GameID]; !g.IsBot("bot2") || g.Side("bot2") == 0 {
+		t.Error("Expected the paired bot to be seated as a bot")
+	}
+
+	g.addEvent(Event{Type: EventPlayerLeft, PlayerID: "bot", Team: 2})
+	if side := g.Side("bot"); side != 0 {
+		t.Errorf("Expected the bot to have no side after leaving, got %d", side)
+	}
+}
+
+func TestBotFilters(t *testing.T) {
+	people := exportGame("people", "a", "b")
+	bots := exportGame("bots", "bot", "b")
+	bots.Events[0].Role = RoleBot
+
+	for filter, want := range map[string][]bool{
+		BotsInclude: {true, true},
+		BotsExclude: {true, false},
+		BotsOnly:    {false, true},
+	} {
+		keep, err := BotFilter(filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := []bool{keep(&people.GameState), keep(&bots.GameState)}; !reflect.DeepEqual(got, want) {
+			t.Errorf("BotFilter(%q) kept %v, want %v", filter, got, want)
+		}
+	}
+	if _, err := BotFilter("some"); err == nil {
+		t.Error("Expected an unknown filter to be an error")
+	}
+
+	if m := people.Metrics(); m.Bot || m.Clues[0].Bot {
+		t.Errorf("Expected no bot in %+v", m)
+	}
+	if m := bots.Metrics(); !m.Bot || !m.Clues[0].Bot {
+		t.Errorf("Expected the bot's clue to be marked in %+v", m)
+	}
+	if r := bots.Records()[0]; !r.Giver.Bot || r.Guesser.Bot {
+		t.Errorf("Expected only the giver marked as a bot, got %+v and %+v", r.Giver, r.Guesser)
+	}
+	if p := pairing(bots.demographics(), "bot", 1); p.Giver != "bot" {
+		t.Errorf("Expected a bot giver to be paired as a bot, got %+v", p)
+	}
+}
+
+func TestBotCatchesUpPastHiddenEvents(t *testing.T) {
+	h := newTestHandler(t, Config{})
+	var game struct {
+		GameID string `json:"game_id"`
+	}
+	post(t, h, "/new-game", `{"player_id": "a", "name": "a", "team": 1}`, &game)
+	post(t, h, "/new-game", `{"game_id": "`+game.GameID+`", "player_id": "bot", "name": "Bot", "bot": true}`, nil)
+	g := h.games[game.GameID]
+	seed, _ := json.Marshal(g.Seed)
+	poll := func(copy *Game) GameUpdate {
+		var update GameUpdate
+		post(t, h, "/events", fmt.Sprintf(`{"game_id": %q, "seed": %s, "player_id": "bot", "name": "Bot", "team": 2, "last_event": %d}`,
+			game.GameID, seed, copy.LastEvent()), &update)
+		return update
+	}
+
+	var raw json.RawMessage
+	post(t, h, "/game", `{"game_id": "`+game.GameID+`", "player_id": "bot"}`, &raw)
+	var copy *Game
+	if err := ReadGames(bytes.NewReader(raw), func(read *Game) error {
+		copy = read
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The bot never sees a's report, so its copy of the game
+	// falls one event short of the server's.
+	post(t, h, "/report", `{"game_id": "`+game.GameID+`", "seed": `+string(seed)+`, "player_id": "a", "name": "a", "category": "other"}`, nil)
+	g.addEvent(Event{Type: EventChat, Team: 1, PlayerID: "a", Name: "a", Message: []string{"clue", g.Words[0]}, Num_target_words: 1})
+	update := poll(copy)
+	copy.CatchUp(update.Events)
+	if copy.LastEvent() != len(g.Events) || len(copy.Events) != len(g.Events)-1 {
+		t.Fatalf("Expected the bot's copy to skip only the report, got %+v", copy.Events)
+	}
+	copy.CatchUp(update.Events) // a repeated poll adds nothing
+
+	g.addEvent(Event{Type: EventGuess, Team: 2, PlayerID: "bot", Name: "Bot", Index: 0})
+	next := poll(copy)
+	if len(next.Events) != 1 || next.Events[0].Type != EventGuess {
+		t.Fatalf("Expected only the guess to be new, got %+v", next.Events)
+	}
+	copy.CatchUp(next.Events)
+	counts := map[string]int{}
+	for _, e := range copy.Events {
+		counts[e.Type]++
+	}
+	if counts[EventChat] != 1 || counts[EventGuess] != 1 || counts[EventReport] != 0 {
+		t.Errorf("Expected one clue and one guess, got %v", counts)
+	}
+}
@@ -0,0 +1,632 @@
+package gameapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Game modes. Games stored before modes existed have an empty
+// mode and are Duet games.
+const (
+	ModeDuet    = "duet"
+	ModeClassic = "classic"
+)
+
+// Teams and roles in a classic game. Red and blue reuse the team
+// numbers of Duet's sides one and two, so classic events have the
+// same shape as Duet events.
+const (
+	RedTeam  = 1
+	BlueTeam = 2
+
+	Spymaster = "spymaster"
+	Operative = "operative"
+)
+
+// classicBoardSize is the number of cards on a classic board: nine
+// for the starting team, eight for the other team, seven bystanders
+// and one assassin.
+const classicBoardSize = 25
+
+func teamColor(team int) Color {
+	if team == RedTeam {
+		return Red
+	}
+	return Blue
+}
+
+func otherTeam(team int) int {
+	if team == RedTeam {
+		return BlueTeam
+	}
+	return RedTeam
+}
+
+func reconstructClassicGame(state GameState, gameId string, gen generator) (*Game, error) {
+	if err := checkWordSet(state.WordSet, classicBoardSize); err != nil {
+		return nil, err
+	}
+	g := &Game{
+		GameState: state,
+		GameID:    gameId,
+	}
+
+	rnd := gen.newRand(int64(state.Seed))
+	var err error
+	g.Words, err = state.boardWords(gen, rnd, classicBoardSize)
+	if err != nil {
+		return nil, err
+	}
+	g.StartingTeam = RedTeam + rnd.Intn(2)
+
+	// The starting team has one more agent to find.
+	var key []Color
+	for i := 0; i < 9; i++ {
+		key = append(key, teamColor(g.StartingTeam))
+	}
+	for i := 0; i < 8; i++ {
+		key = append(key, teamColor(otherTeam(g.StartingTeam)))
+	}
+	for i := 0; i < 7; i++ {
+		key = append(key, Tan)
+	}
+	key = append(key, Black)
+
+	perm := rnd.Perm(classicBoardSize)
+	g.Key = make([]Color, classicBoardSize)
+	for i, c := range key {
+		g.Key[perm[i]] = c
+	}
+	return g, nil
+}
+
+type seat struct {
+	Team int    `json:"team"`
+	Role string `json:"role"`
+}
+
+// ClassicState is the state of a classic game, derived by
+// replaying its events.
+type ClassicState struct {
+	Turn        int         `json:"turn"`
+	Clue        string      `json:"clue,omitempty"`
+	Number      int         `json:"number"`
+	Guesses     int         `json:"guesses"`
+	GuessesLeft int         `json:"guesses_left"` // -1 after a zero clue: unlimited
+	Revealed    []bool      `json:"revealed"`
+	Remaining   map[int]int `json:"remaining"`
+	Winner      int         `json:"winner,omitempty"`
+
+	seats map[string]seat
+}
+
+func (g *Game) classicState() *ClassicState {
+	s := &ClassicState{
+		Turn:      g.StartingTeam,
+		Revealed:  make([]bool, len(g.Key)),
+		Remaining: map[int]int{RedTeam: 0, BlueTeam: 0},
+		seats:     make(map[string]seat),
+	}
+	for _, c := range g.Key {
+		switch c {
+		case Red:
+			s.Remaining[RedTeam]++
+		case Blue:
+			s.Remaining[BlueTeam]++
+		}
+	}
+	for _, e := range g.Events {
+		s.apply(g.Key, e)
+	}
+	return s
+}
+
+// apply updates the state with an event that has already been
+// checked against the rules.
+func (s *ClassicState) apply(key []Color, e Event) {
+	if p, err := e.Payload(); err == nil {
+		p.classic(s, key, e)
+	}
+}
+
+// Each payload applies itself to a classic game, so a new event
+// type doesn't build until the rules say what it does.
+
+func (p JoinSideEvent) classic(s *ClassicState, key []Color, e Event) {
+	if p.Role != "" {
+		s.seats[e.PlayerID] = seat{Team: e.Team, Role: p.Role}
+	}
+}
+
+func (PlayerLeftEvent) classic(s *ClassicState, key []Color, e Event) {
+	delete(s.seats, e.PlayerID)
+}
+
+func (p ClueEvent) classic(s *ClassicState, key []Color, e Event) {
+	s.Clue = p.Word
+	s.Number = p.Number
+	s.Guesses = 0
+	s.GuessesLeft = p.Number + 1
+	if p.Number == 0 {
+		s.GuessesLeft = -1
+	}
+}
+
+func (p GuessEvent) classic(s *ClassicState, key []Color, e Event) {
+	s.reveal(key, e.Team, p.Index)
+}
+
+func (EndTurnEvent) classic(s *ClassicState, key []Color, e Event) {
+	s.endTurn()
+}
+
+// None of these change a classic game's board or turn.
+func (ChangeNameEvent) classic(*ClassicState, []Color, Event)         {}
+func (PlayerDisconnectedEvent) classic(*ClassicState, []Color, Event) {}
+func (PlayerReconnectedEvent) classic(*ClassicState, []Color, Event)  {}
+func (AbandonedEvent) classic(*ClassicState, []Color, Event)          {}
+func (RequeuedEvent) classic(*ClassicState, []Color, Event)           {}
+func (ChatEvent) classic(*ClassicState, []Color, Event)               {}
+func (ChatErrorEvent) classic(*ClassicState, []Color, Event)          {}
+func (GameOverEvent) classic(*ClassicState, []Color, Event)           {}
+func (GameTimeoutEvent) classic(*ClassicState, []Color, Event)        {}
+func (TurnTimeoutEvent) classic(*ClassicState, []Color, Event)        {}
+func (ClockWarningEvent) classic(*ClassicState, []Color, Event)       {}
+func (RematchEvent) classic(*ClassicState, []Color, Event)            {}
+func (RematchRequestEvent) classic(*ClassicState, []Color, Event)     {}
+func (ReportEvent) classic(*ClassicState, []Color, Event)             {}
+func (MessageEvent) classic(*ClassicState, []Color, Event)            {}
+
+func (s *ClassicState) reveal(key []Color, team, index int) {
+	s.Revealed[index] = true
+	s.Guesses++
+	c := key[index]
+	switch c {
+	case Black:
+		s.Winner = otherTeam(team)
+		return
+	case Red, Blue:
+		owner := RedTeam
+		if c == Blue {
+			owner = BlueTeam
+		}
+		s.Remaining[owner]--
+		if s.Remaining[owner] == 0 {
+			s.Winner = owner
+			return
+		}
+	}
+
+	if c != teamColor(team) {
+		s.endTurn()
+		return
+	}
+	if s.GuessesLeft > 0 {
+		s.GuessesLeft--
+		if s.GuessesLeft == 0 {
+			s.endTurn()
+		}
+	}
+}
+
+func (s *ClassicState) endTurn() {
+	s.Turn = otherTeam(s.Turn)
+	s.Clue = ""
+	s.Number = 0
+	s.Guesses = 0
+	s.GuessesLeft = 0
+}
+
+// ready reports whether both teams have a spymaster
+// and at least one operative.
+func (s *ClassicState) ready() bool {
+	var spymasters, operatives [3]int
+	for _, st := range s.seats {
+		if st.Role == Spymaster {
+			spymasters[st.Team]++
+		} else {
+			operatives[st.Team]++
+		}
+	}
+	return spymasters[RedTeam] == 1 && spymasters[BlueTeam] == 1 &&
+		operatives[RedTeam] > 0 && operatives[BlueTeam] > 0
+}
+
+// classicError is a move the classic rules don't allow.
+type classicError struct {
+	code    string
+	message string
+}
+
+func (e classicError) Error() string {
+	return e.message
+}
+
+func (g *Game) takeSeat(playerID, name string, team int, role string, when time.Time, userAge, userGender, userCountry string, userNativeSpeaker bool) error {
+	if team != RedTeam && team != BlueTeam {
+		return classicError{"bad_team", "Pick the red (1) or blue (2) team."}
+	}
+	if role != Spymaster && role != Operative {
+		return classicError{"bad_role", "Pick the spymaster or operative role."}
+	}
+
+	s := g.classicState()
+	if cur, ok := s.seats[playerID]; ok && cur.Team == team && cur.Role == role {
+		g.markSeen(playerID, name, team, when)
+		return nil
+	}
+	if g.rolesLocked(playerID) {
+		return classicError{"roles_locked", "Seats can't change once the first clue is given."}
+	}
+	if role == Spymaster {
+		for id, st := range s.seats {
+			if id != playerID && st.Team == team && st.Role == Spymaster {
+				return classicError{"seat_taken", "That team already has a spymaster."}
+			}
+		}
+	}
+
+	g.players[playerID] = Player{Team: team, Role: role, Name: name, LastSeen: when}
+	g.addEvent(Event{
+		Type:              "join_side",
+		PlayerID:          playerID,
+		Name:              name,
+		Team:              team,
+		Role:              role,
+		UserAge:           userAge,
+		UserGender:        userGender,
+		UserCountry:       userCountry,
+		UserNativeSpeaker: userNativeSpeaker,
+	})
+	return nil
+}
+
+// rolesLocked reports whether playerID has held a seat in a game
+// that has had its first clue. From then on they keep it, so a
+// spymaster who has seen the key can't turn operative.
+func (g *Game) rolesLocked(playerID string) bool {
+	clued, seated := false, false
+	for _, e := range g.Events {
+		switch {
+		case e.Type == EventClue:
+			clued = true
+		case e.Type == EventJoinSide && e.PlayerID == playerID && e.Role != "":
+			seated = true
+		}
+	}
+	return clued && seated
+}
+
+// currentTurn checks that the game is under way, that playerID
+// holds role on the team whose turn it is, and returns the state.
+func (g *Game) currentTurn(playerID, role string) (*ClassicState, seat, error) {
+	s := g.classicState()
+	st, ok := s.seats[playerID]
+	switch {
+	case s.Winner != 0:
+		return s, st, classicError{"game_over", "The game is over."}
+	case !s.ready():
+		return s, st, classicError{"game_not_ready", "Both teams need a spymaster and an operative."}
+	case !ok || st.Role != role:
+		return s, st, classicError{"wrong_role", fmt.Sprintf("Only a %s can do that.", role)}
+	case st.Team != s.Turn:
+		return s, st, classicError{"not_your_turn", "It's the other team's turn."}
+	}
+	return s, st, nil
+}
+
+func (g *Game) classicClue(playerID, name, word string, number int, when time.Time) error {
+	s, st, err := g.currentTurn(playerID, Spymaster)
+	if err != nil {
+		return err
+	}
+	if s.Clue != "" {
+		return classicError{"clue_given", "Your team already has a clue this turn."}
+	}
+	word = strings.TrimSpace(word)
+	if len(strings.Fields(word)) != 1 || !isWord(word) {
+		return classicError{"bad_clue", "A clue must be a single word."}
+	}
+	if number < 0 || number > 9 {
+		return classicError{"bad_clue", "A clue's number must be between 0 and 9."}
+	}
+	for i, w := range g.Words {
+		if !s.Revealed[i] && strings.EqualFold(w, word) {
+			return classicError{"bad_clue", "The clue can't be a word on the board."}
+		}
+	}
+
+	g.markSeen(playerID, name, st.Team, when)
+	g.addEvent(Event{
+		Type:             "clue",
+		Team:             st.Team,
+		Role:             Spymaster,
+		PlayerID:         playerID,
+		Name:             name,
+		Message:          []string{word},
+		Num_target_words: number,
+	})
+	return nil
+}
+
+func (g *Game) classicGuess(playerID, name string, index int, rationale string, when time.Time) error {
+	s, st, err := g.currentTurn(playerID, Operative)
+	if err != nil {
+		return err
+	}
+	if s.Clue == "" {
+		return classicError{"no_clue", "Wait for your spymaster's clue."}
+	}
+	if index < 0 || index >= len(g.Key) {
+		return classicError{"bad_index", "There's no card there."}
+	}
+	if s.Revealed[index] {
+		return classicError{"already_revealed", "That card has already been revealed."}
+	}
+
+	evt := Event{
+		Type:      "guess",
+		Team:      st.Team,
+		Role:      Operative,
+		Index:     index,
+		PlayerID:  playerID,
+		Name:      name,
+		Rationale: rationale,
+	}
+	g.markSeen(playerID, name, st.Team, when)
+	g.addEvent(evt)
+	s.apply(g.Key, evt)
+	if s.Winner != 0 {
+		g.addEvent(Event{Type: "game_over", Team: s.Winner})
+	}
+	return nil
+}
+
+func (g *Game) classicEndTurn(playerID, name string, when time.Time) error {
+	s, st, err := g.currentTurn(playerID, Operative)
+	if err != nil {
+		return err
+	}
+	if s.Clue == "" || s.Guesses == 0 {
+		return classicError{"must_guess", "Make at least one guess before ending the turn."}
+	}
+	g.markSeen(playerID, name, st.Team, when)
+	g.addEvent(Event{
+		Type:     "end_turn",
+		Team:     st.Team,
+		Role:     Operative,
+		PlayerID: playerID,
+		Name:     name,
+	})
+	return nil
+}
+
+// classicView is what a classic player sees of a game. Only
+// spymasters are sent the key.
+type classicView struct {
+	GameID       string        `json:"game_id"`
+	Mode         string        `json:"mode"`
+	Seed         Seed          `json:"seed"`
+	Words        []string      `json:"words"`
+	Events       []Event       `json:"events"`
+	StartingTeam int           `json:"starting_team"`
+	Key          []Color       `json:"key,omitempty"`
+	State        *ClassicState `json:"classic_state"`
+}
+
+func (g *Game) classicViewFor(playerID string) classicView {
+	s := g.classicState()
+	v := classicView{
+		GameID:       g.GameID,
+		Mode:         ModeClassic,
+		Seed:         g.Seed,
+		Words:        g.Words,
+		Events:       withoutReports(playerID, g.Events),
+		StartingTeam: g.StartingTeam,
+		State:        s,
+	}
+	if s.seats[playerID].Role == Spymaster || s.Winner != 0 {
+		v.Key = g.Key
+	}
+	return v
+}
+
+// gameView is a Duet game with the events a player may see.
+type gameView struct {
+	*Game
+	State GameState `json:"state"`
+}
+
+// playerView is the game as a response sends it to a player.
+// Classic games go through classicViewFor, so operatives never
+// see the key, and neither mode shows others' reports.
+func (g *Game) playerView(playerID string) interface{} {
+	if g.Mode == ModeClassic {
+		return g.classicViewFor(playerID)
+	}
+	state := g.GameState
+	state.Events = g.eventsFor(playerID, g.Events)
+	return gameView{g, state}
+}
+
+func writeClassicError(rw http.ResponseWriter, err error) {
+	if ce, ok := err.(classicError); ok {
+		writeError(rw, ce.code, ce.message, 400)
+		return
+	}
+	writeError(rw, "internal_error", err.Error(), 500)
+}
+
+// POST /new-classic-game
+// create a classic game, seating its creator on the chosen team and role
+func (h *handler) handleNewClassicGame(rw http.ResponseWriter, req *http.Request) {
+	var body struct {
+		Words             []string `json:"words,omitempty"`
+		WordList          string   `json:"word_list,omitempty"`
+		WordListVersion   string   `json:"word_list_version,omitempty"`
+		PlayerID          string   `json:"player_id"`
+		Name              string   `json:"name"`
+		Team              int      `json:"team"`
+		Role              string   `json:"role"`
+		UserAge           string   `json:"user_age"`
+		UserGender        string   `json:"user_gender"`
+		UserCountry       string   `json:"user_country"`
+		UserNativeSpeaker bool     `json:"user_native_speaker"`
+	}
+
+	err := json.NewDecoder(req.Body).Decode(&body)
+	if err != nil || body.PlayerID == "" {
+		writeError(rw, "malformed_body", "Unable to parse request body.", 400)
+		return
+	}
+
+	words, listName, ok := h.wordsFor(body.Words, body.WordList, body.WordListVersion)
+	if !ok {
+		writeError(rw, "unknown_word_list", "No word list has that name or version.", 404)
+		return
+	}
+	if len(words) < classicBoardSize {
+		writeError(rw, "too_few_words",
+			fmt.Sprintf("A word list must have at least %d words.", classicBoardSize), 400)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	state := NewState(h.rand.Int63(), words)
+	state.WordList = listName
+	state.Mode = ModeClassic
+	g, err := ReconstructGame(state, randomString(8))
+	if err != nil {
+		writeError(rw, "bad_word_list", err.Error(), 400)
+		return
+	}
+	g.CreatedAt = time.Now()
+	err = g.takeSeat(body.PlayerID, body.Name, body.Team, body.Role, time.Now(),
+		body.UserAge, body.UserGender, body.UserCountry, body.UserNativeSpeaker)
+	if err != nil {
+		writeClassicError(rw, err)
+		return
+	}
+	h.games[g.GameID] = g
+	writeJSON(rw, g.classicViewFor(body.PlayerID))
+}
+
+// POST /join-classic-game
+// take (or change) a seat in a classic game
+func (h *handler) handleJoinClassicGame(rw http.ResponseWriter, req *http.Request) {
+	var body struct {
+		GameID            string `json:"game_id"`
+		PlayerID          string `json:"player_id"`
+		Name              string `json:"name"`
+		Team              int    `json:"team"`
+		Role              string `json:"role"`
+		UserAge           string `json:"user_age"`
+		UserGender        string `json:"user_gender"`
+		UserCountry       string `json:"user_country"`
+		UserNativeSpeaker bool   `json:"user_native_speaker"`
+	}
+
+	err := json.NewDecoder(req.Body).Decode(&body)
+	if err != nil || body.GameID == "" || body.PlayerID == "" {
+		writeError(rw, "malformed_body", "Unable to parse request body.", 400)
+		return
+	}
+
+	g, ok := h.classicGame(rw, body.GameID)
+	if !ok {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	err = g.takeSeat(body.PlayerID, body.Name, body.Team, body.Role, time.Now(),
+		body.UserAge, body.UserGender, body.UserCountry, body.UserNativeSpeaker)
+	if err != nil {
+		writeClassicError(rw, err)
+		return
+	}
+	writeJSON(rw, g.classicViewFor(body.PlayerID))
+}
+
+// POST /clue
+// a classic spymaster gives their team a clue word and number
+func (h *handler) handleClue(rw http.ResponseWriter, req *http.Request) {
+	var body struct {
+		GameID   string `json:"game_id"`
+		Seed     Seed   `json:"seed"`
+		PlayerID string `json:"player_id"`
+		Name     string `json:"name"`
+		Word     string `json:"word"`
+		Number   int    `json:"number"`
+	}
+
+	err := json.NewDecoder(req.Body).Decode(&body)
+	if err != nil || body.GameID == "" || body.PlayerID == "" {
+		writeError(rw, "malformed_body", "Unable to parse request body.", 400)
+		return
+	}
+
+	g, ok := h.classicGame(rw, body.GameID)
+	if !ok {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if body.Seed != g.Seed {
+		writeError(rw, "bad_seed", "Request intended for a different game seed.", 400)
+		return
+	}
+	if len(h.blocklist.Blocked(body.Word)) > 0 {
+		writeError(rw, "blocked_word", "That clue word isn't allowed.", 400)
+		return
+	}
+	if err := g.classicClue(body.PlayerID, body.Name, body.Word, body.Number, time.Now()); err != nil {
+		writeClassicError(rw, err)
+		return
+	}
+	writeJSON(rw, map[string]string{"status": "ok"})
+}
+
+// POST /classic-game
+// get a classic game as the given player sees it
+func (h *handler) handleClassicGame(rw http.ResponseWriter, req *http.Request) {
+	var body struct {
+		GameID   string `json:"game_id"`
+		PlayerID string `json:"player_id"`
+	}
+
+	err := json.NewDecoder(req.Body).Decode(&body)
+	if err != nil || body.GameID == "" {
+		writeError(rw, "malformed_body", "Unable to parse request body.", 400)
+		return
+	}
+
+	g, ok := h.classicGame(rw, body.GameID)
+	if !ok {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	writeJSON(rw, g.classicViewFor(body.PlayerID))
+}
+
+// classicGame looks up a classic game, writing an error
+// response if there isn't one with that ID.
+func (h *handler) classicGame(rw http.ResponseWriter, gameID string) (*Game, bool) {
+	h.mu.Lock()
+	g, ok := h.games[gameID]
+	h.mu.Unlock()
+	if !ok {
+		writeError(rw, "not_found", "Game not found", 404)
+		return nil, false
+	}
+	if g.Mode != ModeClassic {
+		writeError(rw, "wrong_mode", "That isn't a classic game.", 400)
+		return nil, false
+	}
+	return g, true
+}
@@ -0,0 +1,190 @@
+package gameapi
+
+import (
+	"testing"
+	"time"
+)
+
+func newClassicTestGame(t *testing.T) *Game {
+	state := NewState(7, numberedWords(40))
+	state.Mode = ModeClassic
+	g, err := ReconstructGame(state, "classic")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seats := []struct {
+		id   string
+		team int
+		role string
+	}{
+		{"red-spy", RedTeam, Spymaster},
+		{"red-op", RedTeam, Operative},
+		{"blue-spy", BlueTeam, Spymaster},
+		{"blue-op", BlueTeam, Operative},
+	}
+	for _, s := range seats {
+		if err := g.takeSeat(s.id, s.id, s.team, s.role, time.Now(), "", "", "", false); err != nil {
+			t.Fatalf("seating %s: %s", s.id, err)
+		}
+	}
+	return g
+}
+
+// cardOf returns the index of the first card of color c.
+func cardOf(g *Game, c Color) int {
+	for i, k := range g.Key {
+		if k == c {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestClassicKey(t *testing.T) {
+	g := newClassicTestGame(t)
+	counts := map[Color]int{}
+	for _, c := range g.Key {
+		counts[c]++
+	}
+	start, other := teamColor(g.StartingTeam), teamColor(otherTeam(g.StartingTeam))
+	if counts[start] != 9 || counts[other] != 8 || counts[Tan] != 7 || counts[Black] != 1 {
+		t.Errorf("Expected a 9/8/7/1 key, got %v", counts)
+	}
+}
+
+func TestClassicTurns(t *testing.T) {
+	g := newClassicTestGame(t)
+	team := g.StartingTeam
+	spy, op, otherSpy := "red-spy", "red-op", "blue-spy"
+	if team == BlueTeam {
+		spy, op, otherSpy = "blue-spy", "blue-op", "red-spy"
+	}
+	now := time.Now()
+
+	if err := g.takeSeat("intruder", "x", team, Spymaster, now, "", "", "", false); err == nil {
+		t.Error("Expected a second spymaster on one team to be rejected")
+	}
+	if err := g.classicGuess(op, op, 0, "", now); err == nil {
+		t.Error("Expected a guess before any clue to be rejected")
+	}
+	if err := g.classicClue(otherSpy, otherSpy, "ocean", 2, now); err == nil {
+		t.Error("Expected a clue out of turn to be rejected")
+	}
+	if err := g.classicClue(spy, spy, g.Words[0], 2, now); err == nil {
+		t.Error("Expected a clue matching a board word to be rejected")
+	}
+	if err := g.classicClue(spy, spy, "ocean", 2, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.classicEndTurn(op, op, now); err == nil {
+		t.Error("Expected ending the turn before guessing to be rejected")
+	}
+
+	own := cardOf(g, teamColor(team))
+	if err := g.classicGuess(op, op, own, "", now); err != nil {
+		t.Fatal(err)
+	}
+	if s := g.classicState(); s.Turn != team || s.GuessesLeft != 2 {
+		t.Errorf("Expected %d to keep guessing with 2 guesses left, got turn %d with %d left", team, s.Turn, s.GuessesLeft)
+	}
+	if err := g.classicGuess(op, op, own, "", now); err == nil {
+		t.Error("Expected guessing a revealed card to be rejected")
+	}
+
+	if err := g.classicGuess(op, op, cardOf(g, Tan), "", now); err != nil {
+		t.Fatal(err)
+	}
+	if s := g.classicState(); s.Turn != otherTeam(team) || s.Clue != "" {
+		t.Errorf("Expected a bystander to pass the turn, got turn %d with clue %q", s.Turn, s.Clue)
+	}
+
+	if err := g.classicClue(otherSpy, otherSpy, "forest", 0, now); err != nil {
+		t.Fatal(err)
+	}
+	otherOp := "red-op"
+	if team == RedTeam {
+		otherOp = "blue-op"
+	}
+	if err := g.classicGuess(otherOp, otherOp, cardOf(g, Black), "", now); err != nil {
+		t.Fatal(err)
+	}
+	if s := g.classicState(); s.Winner != team {
+		t.Errorf("Expected the assassin to hand %d the win, got winner %d", team, s.Winner)
+	}
+	if last := g.Events[len(g.Events)-1]; last.Type != "game_over" || last.Team != team {
+		t.Errorf("Expected a game_over event for %d, got %+v", team, last)
+	}
+}
+
+func TestClassicKeyStaysHidden(t *testing.T) {
+	h := newTestHandler(t, Config{})
+	g := newClassicTestGame(t)
+	h.games[g.GameID] = g
+
+	for _, req := range []struct{ path, body string }{
+		{"/game", `{"game_id": "classic"}`},
+		{"/game", `{"game_id": "classic", "player_id": "red-op"}`},
+		{"/new-game", `{"game_id": "classic", "player_id": "red-op"}`},
+		{"/new-game", `{"player_id": "red-op"}`},
+	} {
+		var resp map[string]interface{}
+		post(t, h, req.path, req.body, &resp)
+		if _, ok := resp["key"]; ok {
+			t.Errorf("%s %s: an operative was sent the key", req.path, req.body)
+		}
+	}
+	var resp map[string]interface{}
+	post(t, h, "/game", `{"game_id": "classic", "player_id": "red-spy"}`, &resp)
+	if _, ok := resp["key"]; !ok {
+		t.Error("Expected the spymaster to be sent the key")
+	}
+}
+
+func TestClassicRolesLock(t *testing.T) {
+	g := newClassicTestGame(t)
+	now := time.Now()
+	spy := "red-spy"
+	if g.StartingTeam == BlueTeam {
+		spy = "blue-spy"
+	}
+	if err := g.classicClue(spy, spy, "ocean", 2, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.takeSeat(spy, spy, g.StartingTeam, Operative, now, "", "", "", false); err == nil {
+		t.Error("Expected a spymaster not to turn operative after the first clue")
+	}
+	if err := g.takeSeat("late", "late", g.StartingTeam, Operative, now, "", "", "", false); err != nil {
+		t.Errorf("Expected a new operative to join, got %v", err)
+	}
+}
+
+func TestClassicPollsKeepSeats(t *testing.T) {
+	g := newClassicTestGame(t)
+	now := time.Now()
+	spy := "red-spy"
+	if g.StartingTeam == BlueTeam {
+		spy = "blue-spy"
+	}
+	if err := g.classicClue(spy, spy, "ocean", 2, now); err != nil {
+		t.Fatal(err)
+	}
+	joins := len(g.Events)
+
+	// Polling with the other team, or without a seat, goes
+	// through markSeen, which must leave classic seats alone.
+	g.markSeen("red-op", "red-op", BlueTeam, now)
+	g.markSeen("stranger", "stranger", RedTeam, now)
+	if p := g.players["red-op"]; p.Team != RedTeam || p.Role != Operative {
+		t.Errorf("Expected the operative to stay red, got %+v", p)
+	}
+	if _, ok := g.players["stranger"]; ok {
+		t.Error("Expected a poll not to seat a new player")
+	}
+	if len(g.Events) != joins {
+		t.Errorf("Expected no new events, got %+v", g.Events[joins:])
+	}
+	if st := g.classicState().seats["red-op"]; st.Team != RedTeam {
+		t.Errorf("Expected the operative's seat to stay red, got %+v", st)
+	}
+}
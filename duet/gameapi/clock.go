@@ -0,0 +1,161 @@
+package gameapi
+
+import "time"
+
+// Clock limits how long a Duet game and each of its turns may
+// take. A turn runs from the moment the guessing side changes, so
+// it covers both the clue and the guesses. The first turn runs
+// from when both sides are seated to the first guess. The game
+// clock starts with the first clue. Zero turns a limit off.
+type Clock struct {
+	TurnSeconds int `json:"turn_seconds,omitempty"`
+	GameSeconds int `json:"game_seconds,omitempty"`
+	WarnSeconds int `json:"warn_seconds,omitempty"` // warn this long before either clock runs out
+}
+
+func (c *Clock) orZero() Clock {
+	if c == nil {
+		return Clock{}
+	}
+	return *c
+}
+
+func (c Clock) valid() bool {
+	return c.TurnSeconds >= 0 && c.GameSeconds >= 0 && c.WarnSeconds >= 0
+}
+
+func seconds(n int) time.Duration {
+	return time.Duration(n) * time.Second
+}
+
+// clockState is where a game's clocks stand. It's worked out
+// again from the events when a game is reconstructed, so the
+// clocks carry on after a restart.
+type clockState struct {
+	seated     [3]bool // sides that have had a player
+	turn       int
+	turnStart  time.Time
+	gameStart  time.Time
+	turnWarned bool
+	gameWarned bool
+}
+
+// track moves the clocks on past an event made at when, after
+// which turn is the side guessing.
+func (c *clockState) track(e Event, turn int, when time.Time) {
+	switch e.Type {
+	case "join_side":
+		if e.Team == 1 || e.Team == 2 {
+			c.seated[e.Team] = true
+		}
+	case "chat":
+		if c.gameStart.IsZero() {
+			c.gameStart = when
+		}
+	case "clock_warning":
+		if part(e.Message, 0) == "game" {
+			c.gameWarned = true
+		} else {
+			c.turnWarned = true
+		}
+	case "turn_timeout":
+		c.turnStart = when
+		c.turnWarned = false
+	}
+	if (c.turnStart.IsZero() && c.seated[1] && c.seated[2]) || turn != c.turn {
+		c.turn = turn
+		c.turnStart = when
+		c.turnWarned = false
+	}
+}
+
+// restoreClock replays g's events to find where its clocks stand.
+func (g *Game) restoreClock() {
+	g.clock = clockState{}
+	s := g.newDuetState()
+	for _, e := range g.Events {
+		s.apply(e)
+		g.clock.track(e, s.Turn, time.Unix(e.Time, 0))
+	}
+}
+
+// addEvent records an event with the time left on the game's
+// clocks, then restarts the turn clock if the event started the
+// game or passed the turn.
+func (g *Game) addEvent(evt Event) {
+	if g.Clock == nil {
+		g.GameState.addEvent(evt)
+		return
+	}
+	now := time.Now()
+	evt.TurnMsLeft, evt.GameMsLeft = g.timeLeft(now)
+	g.GameState.addEvent(evt)
+	g.clock.track(evt, g.duetState().Turn, now)
+}
+
+// timeLeft returns the milliseconds left on the clocks that
+// are running.
+func (g *Game) timeLeft(now time.Time) (turn, game *int64) {
+	left := func(start time.Time, limit int) *int64 {
+		ms := (seconds(limit) - now.Sub(start)).Nanoseconds() / int64(time.Millisecond)
+		if ms < 0 {
+			ms = 0
+		}
+		return &ms
+	}
+	if g.Clock.TurnSeconds > 0 && !g.clock.turnStart.IsZero() {
+		turn = left(g.clock.turnStart, g.Clock.TurnSeconds)
+	}
+	if g.Clock.GameSeconds > 0 && !g.clock.gameStart.IsZero() {
+		game = left(g.clock.gameStart, g.Clock.GameSeconds)
+	}
+	return turn, game
+}
+
+// checkClock warns players about clocks running low, and
+// enforces any that have run out. A turn that runs out costs the
+// guessing side a timer token, as if they had ended it themselves.
+func (g *Game) checkClock(now time.Time) {
+	if g.Clock == nil || g.Outcome != "" || g.duetState().Outcome != "" {
+		return
+	}
+	c := *g.Clock
+	warn := seconds(c.WarnSeconds)
+
+	if c.GameSeconds > 0 && !g.clock.gameStart.IsZero() {
+		end := g.clock.gameStart.Add(seconds(c.GameSeconds))
+		if !now.Before(end) {
+			g.Outcome = OutcomeTimeout
+			g.addEvent(Event{Type: "game_timeout"})
+			return
+		}
+		if c.WarnSeconds > 0 && !g.clock.gameWarned && !now.Before(end.Add(-warn)) {
+			g.clock.gameWarned = true
+			g.addEvent(Event{Type: "clock_warning", Message: []string{"game"}})
+		}
+	}
+
+	if c.TurnSeconds > 0 && !g.clock.turnStart.IsZero() {
+		team := g.clock.turn
+		end := g.clock.turnStart.Add(seconds(c.TurnSeconds))
+		if !now.Before(end) {
+			if team == 0 {
+				// Before the first guess there's no turn to pass,
+				// so running out only starts the clock again.
+				g.addEvent(Event{Type: "turn_timeout", Team: g.FirstClue})
+			} else {
+				g.addEvent(Event{Type: "turn_timeout", Team: team})
+				g.addEvent(Event{Type: "end_turn", Team: team, Name: "Clock"})
+			}
+			// The turn only stays with the side when the other side
+			// has nothing left to guess; its clock starts again.
+			g.clock.turnStart = now
+			g.clock.turnWarned = false
+			return
+		}
+		if c.WarnSeconds > 0 && !g.clock.turnWarned && !now.Before(end.Add(-warn)) {
+			g.clock.turnWarned = true
+			g.addEvent(Event{Type: "clock_warning", Team: team, Message: []string{"turn"}})
+		}
+	}
+}
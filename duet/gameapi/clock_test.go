@@ -0,0 +1,112 @@
+package gameapi
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClocks(t *testing.T) {
+	state := NewState(8, numberedWords(40))
+	state.Clock = &Clock{TurnSeconds: 60, GameSeconds: 600, WarnSeconds: 10}
+	g, err := ReconstructGame(state, "clocked")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	g.markSeen("a", "a", 1, now)
+	g.markSeen("b", "b", 2, now)
+	if g.clock.turnStart.IsZero() {
+		t.Fatal("Expected the first turn to be timed once both sides were seated")
+	}
+	g.addEvent(Event{Type: "chat", Team: 2, PlayerID: "b", Message: []string{"clue", "target"}})
+	if clue := g.Events[len(g.Events)-1]; clue.TurnMsLeft == nil || clue.GameMsLeft != nil {
+		t.Errorf("Expected the first clue to record the turn clock only, got %+v", clue)
+	}
+	g.guess("a", "a", 1, indexOf(g.TwoLayout, Green), "", now)
+
+	guess := g.Events[len(g.Events)-1]
+	if guess.GameMsLeft == nil || *guess.GameMsLeft > 600000 || *guess.GameMsLeft < 590000 || guess.TurnMsLeft == nil {
+		t.Errorf("Expected the guess to record both clocks, got %+v", guess)
+	}
+	if g.clock.turn != 1 {
+		t.Fatalf("Expected side 1's turn to be timed, got %d", g.clock.turn)
+	}
+
+	start := g.clock.turnStart
+	g.checkClock(start.Add(55 * time.Second))
+	g.checkClock(start.Add(56 * time.Second))
+	if last := g.Events[len(g.Events)-1]; last.Type != "clock_warning" || last.Message[0] != "turn" || last.Team != 1 {
+		t.Errorf("Expected one warning for side 1's turn, got %+v", last)
+	}
+
+	g.checkClock(start.Add(61 * time.Second))
+	n := len(g.Events)
+	if g.Events[n-2].Type != "turn_timeout" || g.Events[n-1].Type != "end_turn" || g.Events[n-1].Team != 1 {
+		t.Errorf("Expected a timeout ending side 1's turn, got %+v", g.Events[n-2:])
+	}
+	if s := g.duetState(); s.Tokens != 1 || s.Turn != 2 {
+		t.Errorf("Expected the timeout to cost a token and pass the turn, got %+v", s)
+	}
+
+	g.checkClock(g.clock.gameStart.Add(601 * time.Second))
+	if g.Outcome != OutcomeTimeout || g.duetState().Outcome != OutcomeTimeout {
+		t.Errorf("Expected the game clock to end the game, got %q", g.Outcome)
+	}
+}
+
+func TestClocksOutliveRestarts(t *testing.T) {
+	state := NewState(8, numberedWords(40))
+	state.Clock = &Clock{TurnSeconds: 60, GameSeconds: 600, WarnSeconds: 10}
+	g, err := ReconstructGame(state, "clocked")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	g.markSeen("a", "a", 1, now)
+	g.markSeen("b", "b", 2, now)
+	g.checkClock(g.clock.turnStart.Add(55 * time.Second))
+	g.addEvent(Event{Type: "chat", Team: 2, PlayerID: "b", Message: []string{"clue", "target"}})
+	g.guess("a", "a", 1, indexOf(g.TwoLayout, Green), "", now)
+
+	restored, err := ReconstructGame(g.GameState, "clocked")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := restored.clock
+	if c.turn != 1 || c.turnWarned || !c.seated[1] || !c.seated[2] {
+		t.Errorf("Expected side 1's turn to be timed afresh, got %+v", c)
+	}
+	if !c.gameStart.Equal(time.Unix(g.Events[len(g.Events)-2].Time, 0)) {
+		t.Errorf("Expected the game clock to start with the first clue, got %v", c.gameStart)
+	}
+	if time.Since(c.turnStart) > 2*time.Second {
+		t.Errorf("Expected the turn clock to carry on from the guess, got %v", c.turnStart)
+	}
+
+	// Running out before the first guess restarts the first turn.
+	opening, err := ReconstructGame(NewState(8, numberedWords(40)), "opening")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opening.Clock = state.Clock
+	opening.markSeen("a", "a", 1, now)
+	opening.markSeen("b", "b", 2, now)
+	start := opening.clock.turnStart
+	opening.checkClock(start.Add(61 * time.Second))
+	if last := opening.Events[len(opening.Events)-1]; last.Type != "turn_timeout" || opening.duetState().Tokens != 0 {
+		t.Errorf("Expected a timeout without a token, got %+v", last)
+	}
+	if !opening.clock.turnStart.Equal(start.Add(61 * time.Second)) {
+		t.Errorf("Expected the first turn to start again, got %v", opening.clock.turnStart)
+	}
+}
+
+// indexOf returns the index of the first cell of color c.
+func indexOf(layout []Color, c Color) int {
+	for i, x := range layout {
+		if x == c {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,454 @@
+package gameapi
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// BoardConstraints control how related, ambiguous and frequent the
+// words on a board are. Zero values leave a property unconstrained.
+type BoardConstraints struct {
+	// MaxRelatedness is the highest similarity allowed between
+	// any two words on the board.
+	MaxRelatedness float64 `json:"max_relatedness,omitempty"`
+
+	// AmbiguousWords is the exact number of culturally ambiguous
+	// words (like FOOTBALL) the board must contain.
+	AmbiguousWords int `json:"ambiguous_words,omitempty"`
+
+	// FrequencyBands splits the word set into this many equally
+	// sized frequency bands and draws the same number of words
+	// from each, give or take one.
+	FrequencyBands int `json:"frequency_bands,omitempty"`
+
+	// NoNearDuplicates rejects pairs of words where one contains
+	// the other or they're a single edit apart, like LIGHT and
+	// LIGHTS or LIGHT and NIGHT.
+	NoNearDuplicates bool `json:"no_near_duplicates,omitempty"`
+}
+
+func (c *BoardConstraints) orZero() BoardConstraints {
+	if c == nil {
+		return BoardConstraints{}
+	}
+	return *c
+}
+
+// constraints returns the constraints the game's board was
+// generated under.
+func (gs *GameState) constraints() BoardConstraints {
+	if gs.Constraints == nil {
+		return BoardConstraints{}
+	}
+	return gs.Constraints.Constraints
+}
+
+func (c BoardConstraints) usesMetadata() bool {
+	return c.MaxRelatedness > 0 || c.AmbiguousWords > 0 || c.FrequencyBands > 0
+}
+
+// ConstraintReport records the constraints a board was generated
+// under and how well the board meets them.
+type ConstraintReport struct {
+	Constraints    BoardConstraints `json:"constraints"`
+	MaxRelatedness float64          `json:"max_relatedness"`
+	AmbiguousWords int              `json:"ambiguous_words"`
+	FrequencyBands []int            `json:"frequency_bands,omitempty"`
+	NearDuplicates [][2]string      `json:"near_duplicates,omitempty"`
+	Violations     []string         `json:"violations,omitempty"`
+	Satisfied      bool             `json:"satisfied"`
+	Attempts       int              `json:"attempts"`
+}
+
+// WordMetadata is what the constrained board generator knows about
+// words: their frequency, whether they're culturally ambiguous, and
+// how related pairs of words are. Words are keyed in upper case,
+// like the words in word lists.
+type WordMetadata struct {
+	Frequency  map[string]float64
+	Ambiguous  map[string]bool
+	Similarity map[[2]string]float64
+}
+
+// LoadWordMetadata reads word metadata from a CSV file with the
+// columns word, frequency and ambiguous, and pairwise similarities
+// from a CSV file with the columns word1, word2 and similarity.
+// Either filename may be empty.
+func LoadWordMetadata(wordsFile, similarityFile string) (*WordMetadata, error) {
+	m := &WordMetadata{
+		Frequency:  make(map[string]float64),
+		Ambiguous:  make(map[string]bool),
+		Similarity: make(map[[2]string]float64),
+	}
+	if wordsFile != "" {
+		err := readCSV(wordsFile, []string{"word", "frequency", "ambiguous"}, func(row []string) error {
+			w := strings.ToUpper(strings.TrimSpace(row[0]))
+			if row[1] != "" {
+				f, err := strconv.ParseFloat(row[1], 64)
+				if err != nil {
+					return err
+				}
+				m.Frequency[w] = f
+			}
+			switch strings.ToLower(row[2]) {
+			case "1", "true", "yes":
+				m.Ambiguous[w] = true
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if similarityFile != "" {
+		err := readCSV(similarityFile, []string{"word1", "word2", "similarity"}, func(row []string) error {
+			s, err := strconv.ParseFloat(row[2], 64)
+			if err != nil {
+				return err
+			}
+			m.Similarity[wordPair(row[0], row[1])] = s
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// DefaultWordMetadata loads wordmeta/words.csv and
+// wordmeta/similarity.csv. It returns nil if neither exists.
+func DefaultWordMetadata() (*WordMetadata, error) {
+	wordsFile, similarityFile := "wordmeta/words.csv", "wordmeta/similarity.csv"
+	if _, err := os.Stat(wordsFile); os.IsNotExist(err) {
+		wordsFile = ""
+	}
+	if _, err := os.Stat(similarityFile); os.IsNotExist(err) {
+		similarityFile = ""
+	}
+	if wordsFile == "" && similarityFile == "" {
+		return nil, nil
+	}
+	return LoadWordMetadata(wordsFile, similarityFile)
+}
+
+// readCSV calls fn with each row's values for the named columns.
+func readCSV(filename string, columns []string, fn func([]string) error) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	header, err := r.Read()
+	if err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	idx := make([]int, len(columns))
+	for i, col := range columns {
+		idx[i] = -1
+		for j, h := range header {
+			if strings.EqualFold(strings.TrimSpace(h), col) {
+				idx[i] = j
+			}
+		}
+		if idx[i] < 0 {
+			return fmt.Errorf("%s: missing column %q", filename, col)
+		}
+	}
+
+	row := make([]string, len(columns))
+	for line := 2; ; line++ {
+		rec, err := r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", filename, err)
+		}
+		for i, j := range idx {
+			row[i] = strings.TrimSpace(rec[j])
+		}
+		if err := fn(row); err != nil {
+			return fmt.Errorf("%s:%d: %w", filename, line, err)
+		}
+	}
+}
+
+func wordPair(a, b string) [2]string {
+	a, b = strings.ToUpper(strings.TrimSpace(a)), strings.ToUpper(strings.TrimSpace(b))
+	if b < a {
+		a, b = b, a
+	}
+	return [2]string{a, b}
+}
+
+// similarity returns how related two words are,
+// or 0 when the metadata doesn't say.
+func (m *WordMetadata) similarity(a, b string) float64 {
+	if m == nil {
+		return 0
+	}
+	return m.Similarity[wordPair(a, b)]
+}
+
+// nearDuplicate reports whether one word contains the other or
+// they're one insertion, deletion or substitution apart.
+func nearDuplicate(a, b string) bool {
+	a, b = strings.ToUpper(a), strings.ToUpper(b)
+	if strings.Contains(a, b) || strings.Contains(b, a) {
+		return true
+	}
+	if len(a) < len(b) {
+		a, b = b, a
+	}
+	switch len(a) - len(b) {
+	case 0:
+		diff := 0
+		for i := range a {
+			if a[i] != b[i] {
+				diff++
+			}
+		}
+		return diff <= 1
+	case 1:
+		for i := range b {
+			if a[i] != b[i] {
+				return a[i+1:] == b[i:]
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// boardSearch generates boards that meet a set of constraints.
+type boardSearch struct {
+	meta        *WordMetadata
+	constraints BoardConstraints
+	pool        []string       // candidate words, sorted
+	band        map[string]int // frequency band of each candidate
+}
+
+// maxBoardAttempts bounds the randomized search for a board
+// meeting every constraint.
+const maxBoardAttempts = 200
+
+func newBoardSearch(meta *WordMetadata, c BoardConstraints, wordSet []string) (*boardSearch, error) {
+	if c.usesMetadata() && meta == nil {
+		return nil, fmt.Errorf("no word metadata is loaded")
+	}
+	if c.MaxRelatedness < 0 || c.AmbiguousWords < 0 || c.FrequencyBands < 0 {
+		return nil, fmt.Errorf("constraints can't be negative")
+	}
+
+	s := &boardSearch{meta: meta, constraints: c, band: make(map[string]int)}
+	seen := make(map[string]bool, len(wordSet))
+	for _, w := range wordSet {
+		if seen[w] {
+			continue
+		}
+		seen[w] = true
+		// Frequency bands need a frequency for every word drawn.
+		if c.FrequencyBands > 0 {
+			if _, ok := meta.Frequency[strings.ToUpper(w)]; !ok {
+				continue
+			}
+		}
+		s.pool = append(s.pool, w)
+	}
+	sort.Strings(s.pool)
+
+	if c.FrequencyBands > 0 {
+		byFreq := append([]string(nil), s.pool...)
+		sort.SliceStable(byFreq, func(i, j int) bool {
+			return meta.Frequency[strings.ToUpper(byFreq[i])] < meta.Frequency[strings.ToUpper(byFreq[j])]
+		})
+		for i, w := range byFreq {
+			s.band[w] = i * c.FrequencyBands / len(byFreq)
+		}
+	}
+	return s, nil
+}
+
+func (s *boardSearch) ambiguous(w string) bool {
+	return s.meta != nil && s.meta.Ambiguous[strings.ToUpper(w)]
+}
+
+// compatible reports whether w can join the board
+// without breaking a pairwise constraint.
+func (s *boardSearch) compatible(board []string, w string) bool {
+	for _, b := range board {
+		if s.constraints.MaxRelatedness > 0 && s.meta.similarity(b, w) > s.constraints.MaxRelatedness {
+			return false
+		}
+		if s.constraints.NoNearDuplicates && nearDuplicate(b, w) {
+			return false
+		}
+	}
+	return true
+}
+
+// attempt greedily builds one board from a random ordering of the
+// pool. When it gets stuck it fills the remaining cells regardless
+// of the constraints, leaving the report to record the violations.
+func (s *boardSearch) attempt(rnd boardRand, n int) []string {
+	order := make([]string, len(s.pool))
+	for i, j := range rnd.Perm(len(s.pool)) {
+		order[i] = s.pool[j]
+	}
+
+	c := s.constraints
+	quota := make([]int, c.FrequencyBands)
+	for i := range quota {
+		quota[i] = n / c.FrequencyBands
+		if i < n%c.FrequencyBands {
+			quota[i]++
+		}
+	}
+	// Bands are filled in a random order so the extra words
+	// from an uneven split don't always land in the same bands.
+	if len(quota) > 0 {
+		shuffled := make([]int, len(quota))
+		for i, j := range rnd.Perm(len(quota)) {
+			shuffled[i] = quota[j]
+		}
+		quota = shuffled
+	}
+
+	var board []string
+	used := make(map[string]bool, n)
+	add := func(wantAmbiguous bool) {
+		for _, w := range order {
+			if len(board) == n || (wantAmbiguous && countAmbiguous(s, board) == c.AmbiguousWords) {
+				return
+			}
+			if used[w] || !s.compatible(board, w) {
+				continue
+			}
+			if c.AmbiguousWords > 0 && s.ambiguous(w) != wantAmbiguous {
+				continue
+			}
+			if len(quota) > 0 {
+				if quota[s.band[w]] == 0 {
+					continue
+				}
+				quota[s.band[w]]--
+			}
+			board = append(board, w)
+			used[w] = true
+		}
+	}
+	if c.AmbiguousWords > 0 {
+		add(true)
+	}
+	add(false)
+
+	for _, w := range order {
+		if len(board) == n {
+			break
+		}
+		if !used[w] {
+			board = append(board, w)
+			used[w] = true
+		}
+	}
+	return board
+}
+
+func countAmbiguous(s *boardSearch, board []string) int {
+	n := 0
+	for _, w := range board {
+		if s.ambiguous(w) {
+			n++
+		}
+	}
+	return n
+}
+
+// report measures a board against the constraints.
+func (s *boardSearch) report(board []string) *ConstraintReport {
+	c := s.constraints
+	r := &ConstraintReport{Constraints: c, AmbiguousWords: countAmbiguous(s, board)}
+	for i, a := range board {
+		for _, b := range board[i+1:] {
+			if sim := s.meta.similarity(a, b); sim > r.MaxRelatedness {
+				r.MaxRelatedness = sim
+			}
+			if nearDuplicate(a, b) {
+				r.NearDuplicates = append(r.NearDuplicates, [2]string{a, b})
+			}
+		}
+	}
+	if c.MaxRelatedness > 0 && r.MaxRelatedness > c.MaxRelatedness {
+		r.Violations = append(r.Violations, fmt.Sprintf("two words are %.3g related, above %.3g", r.MaxRelatedness, c.MaxRelatedness))
+	}
+	if c.AmbiguousWords > 0 && r.AmbiguousWords != c.AmbiguousWords {
+		r.Violations = append(r.Violations, fmt.Sprintf("%d ambiguous words instead of %d", r.AmbiguousWords, c.AmbiguousWords))
+	}
+	if c.FrequencyBands > 0 {
+		r.FrequencyBands = make([]int, c.FrequencyBands)
+		for _, w := range board {
+			r.FrequencyBands[s.band[w]]++
+		}
+		lo, hi := len(board)/c.FrequencyBands, (len(board)+c.FrequencyBands-1)/c.FrequencyBands
+		for band, count := range r.FrequencyBands {
+			if count < lo || count > hi {
+				r.Violations = append(r.Violations, fmt.Sprintf("frequency band %d has %d words, not %d-%d", band, count, lo, hi))
+			}
+		}
+	}
+	if c.NoNearDuplicates && len(r.NearDuplicates) > 0 {
+		r.Violations = append(r.Violations, fmt.Sprintf("%d pairs of near-duplicate words", len(r.NearDuplicates)))
+	}
+	r.Satisfied = len(r.Violations) == 0
+	return r
+}
+
+// constrainBoard picks the words for a new game's board under
+// the constraints, recording the report in the state.
+func (h *handler) constrainBoard(state *GameState, c BoardConstraints) error {
+	gen, err := state.generator()
+	if err != nil {
+		return err
+	}
+	state.Board, state.Constraints, err = generateConstrainedBoard(h.wordMeta, c,
+		state.WordSet, state.layout().Size(), gen.newRand(int64(state.Seed)))
+	return err
+}
+
+// generateConstrainedBoard searches for n words meeting the
+// constraints. If no attempt meets all of them, it returns the
+// board with the fewest violations; the report says which.
+func generateConstrainedBoard(meta *WordMetadata, c BoardConstraints, wordSet []string, n int, rnd boardRand) ([]string, *ConstraintReport, error) {
+	s, err := newBoardSearch(meta, c, wordSet)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(s.pool) < n {
+		return nil, nil, fmt.Errorf("only %d words are usable under these constraints, a board needs %d", len(s.pool), n)
+	}
+
+	var best []string
+	var bestReport *ConstraintReport
+	attempts := 0
+	for attempts < maxBoardAttempts {
+		attempts++
+		board := s.attempt(rnd, n)
+		r := s.report(board)
+		if bestReport == nil || len(r.Violations) < len(bestReport.Violations) {
+			best, bestReport = board, r
+		}
+		if r.Satisfied {
+			break
+		}
+	}
+	bestReport.Attempts = attempts
+	return best, bestReport, nil
+}
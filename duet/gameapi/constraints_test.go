@@ -0,0 +1,113 @@
+package gameapi
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func loadTestMetadata(t *testing.T) (*WordMetadata, []string) {
+	meta, err := LoadWordMetadata("testdata/wordmeta/words.csv", "testdata/wordmeta/similarity.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var words []string
+	for w := range meta.Frequency {
+		words = append(words, w)
+	}
+	sort.Strings(words)
+	return meta, words
+}
+
+func TestNearDuplicate(t *testing.T) {
+	var testCases = []struct {
+		a, b string
+		near bool
+	}{
+		{"light", "LIGHTS", true},
+		{"light", "night", true},
+		{"spy", "spying", true},
+		{"lights", "night", false},
+		{"ocean", "river", false},
+		{"boot", "foot", true},
+		{"boot", "boats", false},
+	}
+	for _, tc := range testCases {
+		if near := nearDuplicate(tc.a, tc.b); near != tc.near {
+			t.Errorf("nearDuplicate(%q, %q) = %t, expected %t", tc.a, tc.b, near, tc.near)
+		}
+	}
+}
+
+func TestConstrainedBoard(t *testing.T) {
+	meta, words := loadTestMetadata(t)
+	c := BoardConstraints{
+		MaxRelatedness:   0.5,
+		AmbiguousWords:   2,
+		FrequencyBands:   2,
+		NoNearDuplicates: true,
+	}
+
+	board, report, err := generateConstrainedBoard(meta, c, words, 16, newSplitMix64(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Satisfied || len(report.Violations) > 0 {
+		t.Fatalf("Expected the constraints to be satisfied, got %+v", report)
+	}
+	if len(board) != 16 {
+		t.Fatalf("Expected 16 words, got %v", board)
+	}
+
+	ambiguous := 0
+	for i, a := range board {
+		if meta.Ambiguous[strings.ToUpper(a)] {
+			ambiguous++
+		}
+		for _, b := range board[i+1:] {
+			if s := meta.similarity(a, b); s > c.MaxRelatedness {
+				t.Errorf("%s and %s are %.2f related", a, b, s)
+			}
+			if nearDuplicate(a, b) {
+				t.Errorf("%s and %s are near duplicates", a, b)
+			}
+		}
+	}
+	if ambiguous != 2 {
+		t.Errorf("Expected 2 ambiguous words, got %d in %v", ambiguous, board)
+	}
+	if !reflect.DeepEqual(report.FrequencyBands, []int{8, 8}) {
+		t.Errorf("Expected 8 words from each frequency band, got %v", report.FrequencyBands)
+	}
+
+	// The stored board is what the game is rebuilt from.
+	state := NewState(3, words)
+	state.Layout = &Layout{Name: "pilot", Rows: 4, Cols: 4, Key: []KeyGroup{{Green, Green, 6}, {Tan, Tan, 10}}}
+	state.Board, state.Constraints = board, report
+	g, err := ReconstructGame(state, "constrained")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(g.Words, board) {
+		t.Errorf("Expected the game to use the generated board %v, got %v", board, g.Words)
+	}
+}
+
+func TestUnsatisfiableConstraints(t *testing.T) {
+	meta, words := loadTestMetadata(t)
+	board, report, err := generateConstrainedBoard(meta, BoardConstraints{AmbiguousWords: 10}, words, 16, newSplitMix64(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Satisfied || len(report.Violations) != 1 || report.Attempts != maxBoardAttempts {
+		t.Errorf("Expected one violation after every attempt, got %+v", report)
+	}
+	if len(board) != 16 {
+		t.Errorf("Expected a full board anyway, got %v", board)
+	}
+
+	if _, _, err := generateConstrainedBoard(nil, BoardConstraints{AmbiguousWords: 1}, words, 16, newSplitMix64(3)); err == nil {
+		t.Error("Expected constraints needing metadata to fail without it")
+	}
+}
@@ -0,0 +1,184 @@
+package gameapi
+
+// duetTokens is the number of timer tokens in a Duet game. The
+// game is lost when a side would need a tenth.
+const duetTokens = 9
+
+// Game outcomes.
+const (
+	OutcomeWon       = "won"
+	OutcomeLost      = "lost"        // someone found an assassin
+	OutcomeTimeout   = "out_of_time" // the timer tokens ran out
+	OutcomeAbandoned = "abandoned"   // a player stopped playing
+)
+
+// DuetState is the state of a Duet game, derived by replaying its
+// events with the rules the client applies in Game.elm.
+type DuetState struct {
+	Turn      int    `json:"turn"` // the side guessing; 0 before the first guess
+	Tokens    int    `json:"tokens"`
+	Remaining int    `json:"remaining"` // greens left to find
+	Outcome   string `json:"outcome,omitempty"`
+
+	one, two []Color
+	// exposed[1] marks the cells revealed on side one's key,
+	// which side two guesses from, and exposed[2] the reverse.
+	exposed [3][]bool
+}
+
+func (g *Game) duetState() *DuetState {
+	s := g.newDuetState()
+	for _, e := range g.Events {
+		s.apply(e)
+	}
+	s.Remaining = s.remainingGreens()
+	if g.Outcome != "" && s.Outcome == "" {
+		s.Outcome = g.Outcome
+	}
+	return s
+}
+
+// newDuetState returns the state of g before any events.
+func (g *Game) newDuetState() *DuetState {
+	return &DuetState{
+		one:     g.OneLayout,
+		two:     g.TwoLayout,
+		exposed: [3][]bool{nil, make([]bool, len(g.OneLayout)), make([]bool, len(g.TwoLayout))},
+	}
+}
+
+func (s *DuetState) key(team int) []Color {
+	if team == 1 {
+		return s.one
+	}
+	return s.two
+}
+
+// apply updates the state with one event, reporting whether it
+// was a move that counted. Moves the client would ignore are
+// ignored here too, as are events that don't fit their type,
+// which only ReadGames loads and Validate reports.
+func (s *DuetState) apply(e Event) bool {
+	if s.Outcome != "" {
+		return false
+	}
+	p, err := e.Payload()
+	if err != nil || !p.duet(s, e) {
+		return false
+	}
+	s.checkOutcome()
+	return true
+}
+
+// Each payload applies itself to a Duet game, so a new event type
+// doesn't build until the rules say what it does.
+
+func (p GuessEvent) duet(s *DuetState, e Event) bool {
+	if e.Team != 1 && e.Team != 2 || p.Index < 0 || p.Index >= len(s.one) || s.Turn == otherTeam(e.Team) {
+		return false
+	}
+	s.guess(e.Team, p.Index)
+	return true
+}
+
+func (EndTurnEvent) duet(s *DuetState, e Event) bool {
+	if s.Turn != e.Team || s.Turn == 0 {
+		return false
+	}
+	s.Tokens++
+	if s.hasHiddenGreens(s.Turn) {
+		s.Turn = otherTeam(s.Turn)
+	}
+	return true
+}
+
+func (AbandonedEvent) duet(s *DuetState, e Event) bool {
+	s.Outcome = OutcomeAbandoned
+	return false
+}
+
+func (GameTimeoutEvent) duet(s *DuetState, e Event) bool {
+	s.Outcome = OutcomeTimeout
+	return false
+}
+
+// None of these reveal words or pass the turn.
+func (JoinSideEvent) duet(*DuetState, Event) bool           { return false }
+func (ChangeNameEvent) duet(*DuetState, Event) bool         { return false }
+func (PlayerLeftEvent) duet(*DuetState, Event) bool         { return false }
+func (PlayerDisconnectedEvent) duet(*DuetState, Event) bool { return false }
+func (PlayerReconnectedEvent) duet(*DuetState, Event) bool  { return false }
+func (RequeuedEvent) duet(*DuetState, Event) bool           { return false }
+func (ChatEvent) duet(*DuetState, Event) bool               { return false }
+func (ChatErrorEvent) duet(*DuetState, Event) bool          { return false }
+func (ClueEvent) duet(*DuetState, Event) bool               { return false }
+func (GameOverEvent) duet(*DuetState, Event) bool           { return false }
+func (TurnTimeoutEvent) duet(*DuetState, Event) bool        { return false }
+func (ClockWarningEvent) duet(*DuetState, Event) bool       { return false }
+func (RematchEvent) duet(*DuetState, Event) bool            { return false }
+func (RematchRequestEvent) duet(*DuetState, Event) bool     { return false }
+func (ReportEvent) duet(*DuetState, Event) bool             { return false }
+func (MessageEvent) duet(*DuetState, Event) bool            { return false }
+
+// guess reveals a cell on the key of the side giving clues
+// to the team guessing.
+func (s *DuetState) guess(team, index int) {
+	other := otherTeam(team)
+	s.exposed[other][index] = true
+	switch s.key(other)[index] {
+	case Tan:
+		s.Tokens++
+		if s.hasHiddenGreens(team) {
+			s.Turn = other
+		} else {
+			s.Turn = team
+		}
+	case Green:
+		if s.hasHiddenGreens(other) {
+			s.Turn = team
+		} else {
+			s.Turn = other
+			s.Tokens++
+		}
+	case Black:
+		s.Outcome = OutcomeLost
+	}
+}
+
+// greenFound reports whether a cell shows a green to both sides.
+func (s *DuetState) greenFound(i int) bool {
+	return (s.exposed[1][i] && s.one[i] == Green) || (s.exposed[2][i] && s.two[i] == Green)
+}
+
+// hasHiddenGreens reports whether the side's key has a green
+// that no one has found yet.
+func (s *DuetState) hasHiddenGreens(team int) bool {
+	for i, c := range s.key(team) {
+		if c == Green && !s.greenFound(i) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *DuetState) remainingGreens() int {
+	n := 0
+	for i := range s.one {
+		if (s.one[i] == Green || s.two[i] == Green) && !s.greenFound(i) {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *DuetState) checkOutcome() {
+	if s.Outcome != "" || s.Turn == 0 {
+		return
+	}
+	switch {
+	case s.remainingGreens() == 0:
+		s.Outcome = OutcomeWon
+	case s.Tokens > duetTokens:
+		s.Outcome = OutcomeTimeout
+	}
+}
@@ -0,0 +1,46 @@
+package gameapi
+
+import "testing"
+
+func TestDuetRules(t *testing.T) {
+	g := &Game{
+		OneLayout: []Color{Green, Tan, Green, Black},
+		TwoLayout: []Color{Green, Green, Tan, Tan},
+	}
+	steps := []struct {
+		evt       Event
+		turn      int
+		tokens    int
+		remaining int
+		outcome   string
+	}{
+		{Event{Type: "end_turn", Team: 1}, 0, 0, 3, ""},           // no one is guessing yet
+		{Event{Type: "guess", Team: 1, Index: 0}, 1, 0, 2, ""},    // green, keep guessing
+		{Event{Type: "guess", Team: 1, Index: 2}, 2, 1, 2, ""},    // tan, the turn passes
+		{Event{Type: "guess", Team: 1, Index: 1}, 2, 1, 2, ""},    // out of turn, ignored
+		{Event{Type: "guess", Team: 2, Index: 2}, 1, 2, 1, ""},    // side one's last green
+		{Event{Type: "guess", Team: 1, Index: 1}, 2, 3, 0, "won"}, // the last green passes the turn
+		{Event{Type: "guess", Team: 2, Index: 3}, 2, 3, 0, "won"}, // too late to lose
+	}
+	for i, step := range steps {
+		g.Events = append(g.Events, step.evt)
+		s := g.duetState()
+		if s.Turn != step.turn || s.Tokens != step.tokens || s.Remaining != step.remaining || s.Outcome != step.outcome {
+			t.Errorf("step %d: expected turn %d, %d tokens, %d remaining, outcome %q; got %+v",
+				i, step.turn, step.tokens, step.remaining, step.outcome, s)
+		}
+	}
+
+	g.Events = []Event{{Type: "guess", Team: 2, Index: 3}}
+	if s := g.duetState(); s.Outcome != OutcomeLost {
+		t.Errorf("Expected an assassin to lose the game, got %+v", s)
+	}
+
+	g.Events = []Event{{Type: "guess", Team: 1, Index: 0}}
+	for i := 0; i < duetTokens+1; i++ {
+		g.Events = append(g.Events, Event{Type: "end_turn", Team: 1 + i%2})
+	}
+	if s := g.duetState(); s.Outcome != OutcomeTimeout || s.Tokens != duetTokens+1 {
+		t.Errorf("Expected the game to run out of time, got %+v", s)
+	}
+}
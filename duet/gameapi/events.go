@@ -0,0 +1,421 @@
+package gameapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Event types.
+const (
+	EventJoinSide           = "join_side"
+	EventChangeName         = "change_name"
+	EventPlayerLeft         = "player_left"
+	EventPlayerDisconnected = "player_disconnected"
+	EventPlayerReconnected  = "player_reconnected"
+	EventAbandoned          = "abandoned"
+	EventRequeued           = "requeued"
+	EventChat               = "chat"
+	EventChatError          = "chat_error"
+	EventGuess              = "guess"
+	EventEndTurn            = "end_turn"
+	EventClue               = "clue" // classic games only
+	EventGameOver           = "game_over"
+	EventGameTimeout        = "game_timeout"
+	EventTurnTimeout        = "turn_timeout"
+	EventClockWarning       = "clock_warning"
+	EventRematch            = "rematch"
+	EventRematchRequest     = "rematch_request"
+	EventReport             = "report"
+	EventMessage            = "message"
+)
+
+// EventTypes lists every event type the server writes.
+var EventTypes = []string{
+	EventJoinSide, EventChangeName, EventPlayerLeft, EventPlayerDisconnected,
+	EventPlayerReconnected, EventAbandoned, EventRequeued, EventChat, EventChatError,
+	EventGuess, EventEndTurn, EventClue, EventGameOver, EventGameTimeout,
+	EventTurnTimeout, EventClockWarning, EventRematch, EventRematchRequest,
+	EventReport, EventMessage,
+}
+
+// Payload is what an event carries beyond what every event has:
+// its number, time, player, name and side. Each event type has
+// its own payload, which Event.Payload returns.
+//
+// On the wire, events stay a single flat object with every field,
+// which is what the client's decoder in Api.elm expects.
+type Payload interface {
+	EventType() string
+	// fill writes the payload into an event's fields.
+	fill(e *Event)
+	// duet and classic apply the payload to a game's state in
+	// each mode. Every payload has to have both, so the rules
+	// handle every event type.
+	duet(s *DuetState, e Event) bool
+	classic(s *ClassicState, key []Color, e Event)
+}
+
+// JoinSideEvent is a player taking a seat, with the background
+// they gave. Role is the seat's role in classic games, and
+// RoleBot for a bot in Duet games.
+type JoinSideEvent struct {
+	Role          string
+	Age           string
+	Gender        string
+	Country       string
+	NativeSpeaker bool
+}
+
+// ChatEvent is a Duet clue: one word, up to five targets on the
+// giver's key and a rationale for each. Blank targets are left in
+// place, so Targets[i] goes with Rationales[i].
+type ChatEvent struct {
+	Clue         string
+	Targets      [5]string
+	Rationales   []string
+	NumTargets   int
+	OneSeenWords []string // words side two had guessed when the clue was given
+	TwoSeenWords []string // words side one had guessed
+}
+
+// ChatErrorEvent is a clue the server turned down.
+type ChatErrorEvent struct{ Message string }
+
+// GuessEvent is a guess. Role is only set in classic games.
+type GuessEvent struct {
+	Index     int
+	Rationale string
+	Role      string
+}
+
+// EndTurnEvent is a side passing. Role is only set in classic games.
+type EndTurnEvent struct{ Role string }
+
+// ClueEvent is a classic spymaster's clue.
+type ClueEvent struct {
+	Word   string
+	Number int
+	Role   string
+}
+
+// ClockWarningEvent says a clock is about to run out.
+type ClockWarningEvent struct {
+	Clock string // "game" or "turn"
+}
+
+// RematchEvent points to a game's rematch.
+type RematchEvent struct{ NextGameID string }
+
+// RematchRequestEvent is a player asking for a rematch.
+type RematchRequestEvent struct{ Kind string }
+
+// RequeuedEvent points a player to the game they were moved to.
+type RequeuedEvent struct{ NextGameID string }
+
+// ReportEvent is a player's report about another.
+type ReportEvent struct {
+	Category   string
+	Text       string
+	ReportedID string
+}
+
+// MessageEvent is free text between partners.
+type MessageEvent struct {
+	Text  string
+	Phase string
+}
+
+// Events that carry nothing beyond the envelope.
+type (
+	ChangeNameEvent         struct{}
+	PlayerLeftEvent         struct{}
+	PlayerDisconnectedEvent struct{}
+	PlayerReconnectedEvent  struct{}
+	AbandonedEvent          struct{}
+	GameOverEvent           struct{}
+	GameTimeoutEvent        struct{}
+	TurnTimeoutEvent        struct{}
+)
+
+func (JoinSideEvent) EventType() string           { return EventJoinSide }
+func (ChangeNameEvent) EventType() string         { return EventChangeName }
+func (PlayerLeftEvent) EventType() string         { return EventPlayerLeft }
+func (PlayerDisconnectedEvent) EventType() string { return EventPlayerDisconnected }
+func (PlayerReconnectedEvent) EventType() string  { return EventPlayerReconnected }
+func (AbandonedEvent) EventType() string          { return EventAbandoned }
+func (RequeuedEvent) EventType() string           { return EventRequeued }
+func (ChatEvent) EventType() string               { return EventChat }
+func (ChatErrorEvent) EventType() string          { return EventChatError }
+func (GuessEvent) EventType() string              { return EventGuess }
+func (EndTurnEvent) EventType() string            { return EventEndTurn }
+func (ClueEvent) EventType() string               { return EventClue }
+func (GameOverEvent) EventType() string           { return EventGameOver }
+func (GameTimeoutEvent) EventType() string        { return EventGameTimeout }
+func (TurnTimeoutEvent) EventType() string        { return EventTurnTimeout }
+func (ClockWarningEvent) EventType() string       { return EventClockWarning }
+func (RematchEvent) EventType() string            { return EventRematch }
+func (RematchRequestEvent) EventType() string     { return EventRematchRequest }
+func (ReportEvent) EventType() string             { return EventReport }
+func (MessageEvent) EventType() string            { return EventMessage }
+
+func (p JoinSideEvent) fill(e *Event) {
+	e.Role = p.Role
+	e.UserAge, e.UserGender, e.UserCountry, e.UserNativeSpeaker = p.Age, p.Gender, p.Country, p.NativeSpeaker
+}
+
+func (p ChatEvent) fill(e *Event) {
+	e.Message = append(append([]string{p.Clue}, p.Targets[:]...), p.Rationales...)
+	e.Num_target_words = p.NumTargets
+	e.OneSeenWords, e.TwoSeenWords = p.OneSeenWords, p.TwoSeenWords
+}
+
+func (p ChatErrorEvent) fill(e *Event) { e.ErrorMessage = p.Message }
+
+func (p GuessEvent) fill(e *Event) {
+	e.Index, e.Rationale, e.Role = p.Index, p.Rationale, p.Role
+}
+
+func (p EndTurnEvent) fill(e *Event)        { e.Role = p.Role }
+func (p ClockWarningEvent) fill(e *Event)   { e.Message = []string{p.Clock} }
+func (p RematchEvent) fill(e *Event)        { e.Message = []string{p.NextGameID} }
+func (p RematchRequestEvent) fill(e *Event) { e.Message = []string{p.Kind} }
+func (p RequeuedEvent) fill(e *Event)       { e.Message = []string{p.NextGameID} }
+func (p MessageEvent) fill(e *Event)        { e.Message = []string{p.Text, p.Phase} }
+
+func (p ClueEvent) fill(e *Event) {
+	e.Message, e.Num_target_words, e.Role = []string{p.Word}, p.Number, p.Role
+}
+
+func (p ReportEvent) fill(e *Event) {
+	e.Message, e.ReportedID = []string{p.Category, p.Text}, p.ReportedID
+}
+
+func (ChangeNameEvent) fill(*Event)         {}
+func (PlayerLeftEvent) fill(*Event)         {}
+func (PlayerDisconnectedEvent) fill(*Event) {}
+func (PlayerReconnectedEvent) fill(*Event)  {}
+func (AbandonedEvent) fill(*Event)          {}
+func (GameOverEvent) fill(*Event)           {}
+func (GameTimeoutEvent) fill(*Event)        {}
+func (TurnTimeoutEvent) fill(*Event)        {}
+
+// NewEvent returns an event carrying p, for the caller to fill
+// in the player and side.
+func NewEvent(p Payload) Event {
+	e := Event{Type: p.EventType()}
+	p.fill(&e)
+	return e
+}
+
+// EventError is an event that doesn't fit its type.
+type EventError struct {
+	Number int
+	Type   string
+	Field  string // the JSON name of a field the type doesn't carry; empty if the type is unknown
+}
+
+func (err *EventError) Error() string {
+	if err.Field == "" {
+		return fmt.Sprintf("event %d: unknown event type %q", err.Number, err.Type)
+	}
+	return fmt.Sprintf("event %d: %s events don't carry %s", err.Number, err.Type, err.Field)
+}
+
+// part returns a message part, or "" past the end.
+func part(msg []string, i int) string {
+	if i < len(msg) {
+		return msg[i]
+	}
+	return ""
+}
+
+// Payload returns the payload of an event's type, and an error if
+// the event is of an unknown type or sets fields its type doesn't
+// carry.
+func (e Event) Payload() (Payload, error) {
+	var p Payload
+	switch e.Type {
+	case EventJoinSide:
+		p = JoinSideEvent{e.Role, e.UserAge, e.UserGender, e.UserCountry, e.UserNativeSpeaker}
+	case EventChat:
+		c := ChatEvent{Clue: part(e.Message, 0), NumTargets: e.Num_target_words,
+			OneSeenWords: e.OneSeenWords, TwoSeenWords: e.TwoSeenWords}
+		for i := range c.Targets {
+			c.Targets[i] = part(e.Message, i+1)
+		}
+		if len(e.Message) > 6 {
+			c.Rationales = e.Message[6:]
+		}
+		p = c
+	case EventChatError:
+		p = ChatErrorEvent{e.ErrorMessage}
+	case EventGuess:
+		p = GuessEvent{e.Index, e.Rationale, e.Role}
+	case EventEndTurn:
+		p = EndTurnEvent{e.Role}
+	case EventClue:
+		p = ClueEvent{part(e.Message, 0), e.Num_target_words, e.Role}
+	case EventClockWarning:
+		p = ClockWarningEvent{part(e.Message, 0)}
+	case EventRematch:
+		p = RematchEvent{part(e.Message, 0)}
+	case EventRematchRequest:
+		p = RematchRequestEvent{part(e.Message, 0)}
+	case EventRequeued:
+		p = RequeuedEvent{part(e.Message, 0)}
+	case EventReport:
+		p = ReportEvent{part(e.Message, 0), part(e.Message, 1), e.ReportedID}
+	case EventMessage:
+		p = MessageEvent{part(e.Message, 0), part(e.Message, 1)}
+	case EventChangeName:
+		p = ChangeNameEvent{}
+	case EventPlayerLeft:
+		p = PlayerLeftEvent{}
+	case EventPlayerDisconnected:
+		p = PlayerDisconnectedEvent{}
+	case EventPlayerReconnected:
+		p = PlayerReconnectedEvent{}
+	case EventAbandoned:
+		p = AbandonedEvent{}
+	case EventGameOver:
+		p = GameOverEvent{}
+	case EventGameTimeout:
+		p = GameTimeoutEvent{}
+	case EventTurnTimeout:
+		p = TurnTimeoutEvent{}
+	default:
+		return nil, &EventError{Number: e.Number, Type: e.Type}
+	}
+
+	// Anything the payload doesn't account for is a stray field.
+	want := e.envelope()
+	p.fill(&want)
+	if field := strayField(e, want); field != "" {
+		return p, &EventError{Number: e.Number, Type: e.Type, Field: field}
+	}
+	return p, nil
+}
+
+// envelope returns the fields every event has, whatever its type.
+func (e Event) envelope() Event {
+	return Event{
+		Number:      e.Number,
+		Type:        e.Type,
+		PlayerID:    e.PlayerID,
+		Name:        e.Name,
+		Team:        e.Team,
+		Time:        e.Time,
+		SideMembers: e.SideMembers,
+		TurnMsLeft:  e.TurnMsLeft,
+		GameMsLeft:  e.GameMsLeft,
+	}
+}
+
+// strayField returns the JSON name of the first field where got
+// differs from want. Empty lists count as missing ones, and blank
+// parts at the end of a message as no parts at all.
+func strayField(got, want Event) string {
+	gv, wv := reflect.ValueOf(got), reflect.ValueOf(want)
+	for i := 0; i < gv.NumField(); i++ {
+		if gv.Type().Field(i).PkgPath != "" {
+			continue // unexported
+		}
+		g, w := gv.Field(i).Interface(), wv.Field(i).Interface()
+		switch g := g.(type) {
+		case []string:
+			w := w.([]string)
+			if gv.Type().Field(i).Name == "Message" {
+				g, w = trimBlank(g), trimBlank(w)
+			}
+			if len(g) == 0 && len(w) == 0 || reflect.DeepEqual(g, w) {
+				continue
+			}
+		default:
+			if reflect.DeepEqual(g, w) {
+				continue
+			}
+		}
+		return strings.Split(gv.Type().Field(i).Tag.Get("json"), ",")[0]
+	}
+	return ""
+}
+
+func trimBlank(msg []string) []string {
+	for len(msg) > 0 && msg[len(msg)-1] == "" {
+		msg = msg[:len(msg)-1]
+	}
+	return msg
+}
+
+// eventJSON is Event without its JSON methods.
+type eventJSON Event
+
+// MarshalJSON writes every field, as the client expects, but
+// refuses an event that Check would report.
+func (e Event) MarshalJSON() ([]byte, error) {
+	if err := e.Check(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(eventJSON(e))
+}
+
+// UnmarshalJSON refuses unknown fields, unknown event types and
+// fields an event's type doesn't carry. ReadGames alone loads
+// such events, so that a log with one can still be checked.
+func (e *Event) UnmarshalJSON(b []byte) error {
+	ev, err := decodeEvent(b)
+	if err != nil {
+		return err
+	}
+	if err := ev.Check(); err != nil {
+		return err
+	}
+	*e = ev
+	return nil
+}
+
+// decodeEvent decodes an event whatever it holds. Fields the
+// Event type doesn't have are kept aside for Check to report.
+func decodeEvent(b []byte) (Event, error) {
+	var ej eventJSON
+	if err := json.Unmarshal(b, &ej); err != nil {
+		return Event{}, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return Event{}, err
+	}
+	for name := range fields {
+		if !eventFields[name] {
+			ej.unknown = append(ej.unknown, name)
+		}
+	}
+	sort.Strings(ej.unknown)
+	return Event(ej), nil
+}
+
+// eventFields holds the JSON names of Event's fields.
+var eventFields = func() map[string]bool {
+	names := map[string]bool{}
+	t := reflect.TypeOf(Event{})
+	for i := 0; i < t.NumField(); i++ {
+		if name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+			names[name] = true
+		}
+	}
+	return names
+}()
+
+// Check reports an event that no server would write: one of an
+// unknown type, one that sets fields its type doesn't carry, or
+// one that was decoded with fields events don't have.
+func (e Event) Check() error {
+	if len(e.unknown) > 0 {
+		return &EventError{Number: e.Number, Type: e.Type, Field: e.unknown[0]}
+	}
+	_, err := e.Payload()
+	return err
+}
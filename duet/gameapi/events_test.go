@@ -0,0 +1,128 @@
+package gameapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEventPayloads(t *testing.T) {
+	payloads := []Payload{
+		JoinSideEvent{Age: "30", Gender: "f", Country: "Canada", NativeSpeaker: true},
+		ChangeNameEvent{}, PlayerLeftEvent{}, PlayerDisconnectedEvent{}, PlayerReconnectedEvent{},
+		AbandonedEvent{}, RequeuedEvent{"next"},
+		ChatEvent{Clue: "fruit", Targets: [5]string{"apple", "", "pear"}, Rationales: []string{"red and round", "", "shaped like a bell"},
+			NumTargets: 2, OneSeenWords: []string{}, TwoSeenWords: []string{"cat"}},
+		ChatErrorEvent{"Please enter only ONE CLUE WORD"},
+		GuessEvent{Index: 3, Rationale: "it's a fruit"}, EndTurnEvent{},
+		ClueEvent{"fruit", 2, Spymaster}, GameOverEvent{}, GameTimeoutEvent{}, TurnTimeoutEvent{},
+		ClockWarningEvent{"turn"}, RematchEvent{"next"}, RematchRequestEvent{"same"},
+		ReportEvent{"other", "rude", "b"}, MessageEvent{"hi", PhasePlaying},
+	}
+	seen := map[string]bool{}
+	for _, p := range payloads {
+		seen[p.EventType()] = true
+		e := NewEvent(p)
+		e.Number, e.PlayerID, e.Team = 1, "a", 1
+		b, err := json.Marshal(e)
+		if err != nil {
+			t.Fatalf("%s: %v", e.Type, err)
+		}
+		var decoded Event
+		if err := json.Unmarshal(b, &decoded); err != nil {
+			t.Fatalf("%s: %v", e.Type, err)
+		}
+		got, err := decoded.Payload()
+		if err != nil || !reflect.DeepEqual(got, p) {
+			t.Errorf("%s: payload = %+v (%v), want %+v", e.Type, got, err, p)
+		}
+
+		// Every event still has the fields Api.elm decodes.
+		var fields map[string]interface{}
+		json.Unmarshal(b, &fields)
+		for _, f := range []string{"number", "type", "player_id", "name", "team", "index", "num_target_words",
+			"user_age", "user_gender", "user_native_speaker", "user_country", "error_message"} {
+			if _, ok := fields[f]; !ok {
+				t.Errorf("%s: the client needs %s", e.Type, f)
+			}
+		}
+	}
+	for _, typ := range EventTypes {
+		if !seen[typ] {
+			t.Errorf("No payload tested for %s", typ)
+		}
+	}
+}
+
+func TestCheckEvents(t *testing.T) {
+	for _, tt := range []struct {
+		json, err string
+	}{
+		{`{"number": 2, "type": "guess", "index": 1, "error_message": "oops"}`, "guess events don't carry error_message"},
+		{`{"number": 2, "type": "join_side", "message": ["hi"]}`, "join_side events don't carry message"},
+		{`{"number": 2, "type": "shrug"}`, `unknown event type "shrug"`},
+		{`{"number": 2, "type": "guess", "colour": "g"}`, "guess events don't carry colour"},
+	} {
+		var e Event
+		if err := json.Unmarshal([]byte(tt.json), &e); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Decoding %s: got %v, want %q", tt.json, err, tt.err)
+		}
+		// ReadGames still loads them, so a log can be checked.
+		e, err := decodeEvent([]byte(tt.json))
+		if err != nil {
+			t.Errorf("Loading %s: %v", tt.json, err)
+		}
+		if err := e.Check(); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Checking %s: got %v, want %q", tt.json, err, tt.err)
+		}
+	}
+	if _, err := json.Marshal(Event{Type: "end_turn", Index: 4}); err == nil {
+		t.Error("Expected an end_turn with an index not to be written")
+	}
+	var gs GameState
+	gs.changed = make(chan struct{})
+	gs.addEvent(Event{Type: "end_turn", Index: 4})
+	if len(gs.Events) != 0 {
+		t.Errorf("Expected addEvent to drop a bad event, got %+v", gs.Events)
+	}
+
+	// Blank parts at the end of a message are no parts at all,
+	// as when spectators are only shown the clue.
+	var e Event
+	if err := json.Unmarshal([]byte(`{"number": 1, "type": "chat", "message": ["fruit"]}`), &e); err != nil || e.Check() != nil {
+		t.Errorf("Expected a clue without targets to check out, got %v", e.Check())
+	}
+
+	// A game with bad events loads, and Validate reports them.
+	log := `{"game_id": "g", "state": {"seed": "1", "events": [
+		{"number": 1, "type": "shrug"},
+		{"number": 2, "type": "guess", "colour": "g"}]}}`
+	var games []*Game
+	err := ReadGames(strings.NewReader(log), func(g *Game) error {
+		games = append(games, g)
+		return nil
+	})
+	if err != nil || len(games) != 1 {
+		t.Fatalf("Expected the game to load, got %v", err)
+	}
+	kinds := map[string]int{}
+	for _, issue := range games[0].Validate() {
+		kinds[issue.Kind]++
+	}
+	if kinds[IssueUnknownType] != 1 || kinds[IssueStrayField] != 1 {
+		t.Errorf("Expected an unknown type and a stray field, got %v", kinds)
+	}
+}
+
+func TestRulesHandleEveryEvent(t *testing.T) {
+	g := &Game{OneLayout: []Color{Green}, TwoLayout: []Color{Green}, Key: []Color{Red}}
+	for _, typ := range EventTypes {
+		e := Event{Type: typ}
+		if typ == EventClue {
+			e.Message = []string{"fruit"}
+		}
+		g.newDuetState().apply(e)
+		g.classicState().apply(g.Key, e)
+	}
+}
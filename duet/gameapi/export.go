@@ -0,0 +1,496 @@
+package gameapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// The tasks a Duet game is broken into for the dataset, named
+// after the folders under data/.
+const (
+	TaskTargetSelection = "target_selection_task"
+	TaskClueGeneration  = "clue_generation_task"
+	TaskTargetRationale = "target_rationale_task"
+	TaskGenerateGuess   = "generate_guess_task"
+	TaskGuessRationale  = "guess_rationale_task"
+	TaskCorrectGuess    = "correct_guess_task"
+)
+
+// Tasks lists every dataset task.
+var Tasks = []string{
+	TaskTargetSelection, TaskClueGeneration, TaskTargetRationale,
+	TaskGenerateGuess, TaskGuessRationale, TaskCorrectGuess,
+}
+
+// PlayerInfo is a player's background, as they gave it on joining.
+type PlayerInfo struct {
+	PlayerID string `json:"player_id"`
+	Age      string `json:"age"`
+	Gender   string `json:"gender"`
+	Country  string `json:"country"`
+	Native   bool   `json:"native"`
+	Bot      bool   `json:"bot,omitempty"`
+}
+
+// Board is what the clue giver sees when they give a clue:
+// their key's words, less those already revealed on it.
+type Board struct {
+	Green     []string `json:"green"`
+	Black     []string `json:"black"`
+	Tan       []string `json:"tan"`
+	Remaining []string `json:"remaining"` // every word the guesser can still pick
+}
+
+// Record is one example of a dataset task.
+type Record struct {
+	ID        string     `json:"id"`
+	Task      string     `json:"task"`
+	GameID    string     `json:"game_id"`
+	Seed      Seed       `json:"seed"`
+	Giver     PlayerInfo `json:"giver"`
+	Guesser   PlayerInfo `json:"guesser"`
+	Board     Board      `json:"board"`
+	Clue      string     `json:"clue"`
+	Targets   []string   `json:"targets"`
+	Target    string     `json:"target,omitempty"`
+	Guesses   []string   `json:"guesses"` // the guesses made for the clue, so far
+	Guess     string     `json:"guess,omitempty"`
+	Rationale string     `json:"rationale,omitempty"`
+	BaseText  string     `json:"base_text"` // the input, in the format of data/
+	Output    string     `json:"output"`
+	Partial   bool       `json:"partial,omitempty"` // a player in the game withdrew
+}
+
+// pyList formats words the way the base_text columns do.
+func pyList(words []string) string {
+	quoted := make([]string, len(words))
+	for i, w := range words {
+		quoted[i] = "'" + strings.ToLower(w) + "'"
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+// baseText writes a record's input the way data/ does.
+func (r *Record) baseText() string {
+	lower := strings.ToLower
+	switch r.Task {
+	case TaskTargetSelection:
+		return fmt.Sprintf("green: %s, black: %s, tan: %s", pyList(r.Board.Green), pyList(r.Board.Black), pyList(r.Board.Tan))
+	case TaskClueGeneration:
+		return fmt.Sprintf("black: %s, tan: %s, targets: %s", pyList(r.Board.Black), pyList(r.Board.Tan), pyList(r.Targets))
+	case TaskTargetRationale:
+		return fmt.Sprintf("targets: %s, clue: %s, target: %s", pyList(r.Targets), lower(r.Clue), lower(r.Target))
+	case TaskGenerateGuess:
+		return fmt.Sprintf("remaining: %s, hint: %s", pyList(r.Board.Remaining), lower(r.Clue))
+	case TaskGuessRationale:
+		return fmt.Sprintf("guesses: %s, clue: %s, guess: %s", pyList(r.Guesses), lower(r.Clue), lower(r.Guess))
+	case TaskCorrectGuess:
+		return fmt.Sprintf("remaining: %s, rationale: %s, target: %s, hint: %s",
+			pyList(r.Board.Remaining), r.Rationale, lower(r.Target), lower(r.Clue))
+	}
+	return ""
+}
+
+func playerInfo(j Event) PlayerInfo {
+	return PlayerInfo{
+		PlayerID: j.PlayerID,
+		Age:      j.UserAge,
+		Gender:   j.UserGender,
+		Country:  j.UserCountry,
+		Native:   j.UserNativeSpeaker,
+		Bot:      j.Role == RoleBot,
+	}
+}
+
+// board returns what a side's clue giver sees.
+func (s *DuetState) board(words []string, team int) Board {
+	b := Board{Green: []string{}, Black: []string{}, Tan: []string{}, Remaining: []string{}}
+	for i, c := range s.key(team) {
+		if i >= len(words) || s.exposed[team][i] || s.greenFound(i) {
+			continue
+		}
+		b.Remaining = append(b.Remaining, words[i])
+		switch c {
+		case Green:
+			b.Green = append(b.Green, words[i])
+		case Black:
+			b.Black = append(b.Black, words[i])
+		default:
+			b.Tan = append(b.Tan, words[i])
+		}
+	}
+	return b
+}
+
+// exportClue is a clue being turned into records, with the
+// guesses made for it.
+type exportClue struct {
+	number     int // the clue's event number
+	team       int
+	base       Record
+	rationales []string // by target
+	guesses    []Event
+}
+
+// Records breaks a Duet game into examples of every dataset task.
+// Each clue gives one example of target selection, clue generation
+// and guess generation, one target rationale and correct guess
+// example per target, and one guess rationale example per guess.
+func (g *Game) Records() []Record {
+	joins := g.demographics()
+	s := g.newDuetState()
+	var clues []*exportClue
+	lastClue := [3]*exportClue{}
+	for _, e := range g.Events {
+		if e.Type == "chat" && (e.Team == 1 || e.Team == 2) && len(e.Message) > 0 {
+			if withdrawn(e.PlayerID) {
+				// The clue was scrubbed, so the guesses
+				// answering it can't be used either.
+				lastClue[e.Team] = nil
+				continue
+			}
+			c := &exportClue{number: e.Number, team: e.Team, base: Record{
+				GameID:  g.GameID,
+				Seed:    g.Seed,
+				Partial: g.Partial,
+				Giver:   playerInfo(joins[e.PlayerID]),
+				Board:   s.board(g.Words, e.Team),
+				Clue:    strings.TrimSpace(e.Message[0]),
+				Targets: []string{},
+			}}
+			c.base.Giver.PlayerID = e.PlayerID
+			for i := 1; i <= 5 && i < len(e.Message); i++ {
+				t := strings.TrimSpace(e.Message[i])
+				if t == "" {
+					continue
+				}
+				c.base.Targets = append(c.base.Targets, t)
+				rationale := ""
+				if i+5 < len(e.Message) {
+					rationale = strings.TrimSpace(e.Message[i+5])
+				}
+				c.rationales = append(c.rationales, rationale)
+			}
+			clues = append(clues, c)
+			lastClue[e.Team] = c
+			continue
+		}
+		if !s.apply(e) || e.Type != "guess" || e.Index >= len(g.Words) {
+			continue
+		}
+		if c := lastClue[otherTeam(e.Team)]; c != nil {
+			c.guesses = append(c.guesses, e)
+		}
+	}
+
+	var out []Record
+	add := func(c *exportClue, task string, n int, r Record, output string) {
+		r.ID = fmt.Sprintf("%s-%d-%s-%d", g.GameID, c.number, task, n)
+		r.Task = task
+		r.Output = output
+		r.BaseText = r.baseText()
+		out = append(out, r)
+	}
+	for _, c := range clues {
+		guessed := make([]string, len(c.guesses))
+		for i, e := range c.guesses {
+			guessed[i] = g.Words[e.Index]
+		}
+		r := c.base
+		r.Guesses = guessed
+		if len(c.guesses) > 0 {
+			r.Guesser = playerInfo(joins[c.guesses[0].PlayerID])
+			r.Guesser.PlayerID = c.guesses[0].PlayerID
+		} else {
+			// No one guessed; credit the first player on the other side.
+			for id, j := range joins {
+				if j.Team == otherTeam(c.team) && (r.Guesser.PlayerID == "" || id < r.Guesser.PlayerID) {
+					r.Guesser = playerInfo(j)
+				}
+			}
+		}
+
+		add(c, TaskTargetSelection, 0, r, strings.Join(lowered(r.Targets), ", "))
+		add(c, TaskClueGeneration, 0, r, strings.ToLower(r.Clue))
+		add(c, TaskGenerateGuess, 0, r, strings.Join(lowered(guessed), ", "))
+		for i, t := range r.Targets {
+			tr := r
+			tr.Target = t
+			tr.Rationale = c.rationales[i]
+			add(c, TaskTargetRationale, i, tr, tr.Rationale)
+			correct := "False"
+			for _, w := range guessed {
+				if strings.EqualFold(w, t) {
+					correct = "True"
+				}
+			}
+			add(c, TaskCorrectGuess, i, tr, correct)
+		}
+		for i, e := range c.guesses {
+			if withdrawn(e.PlayerID) {
+				continue
+			}
+			gr := r
+			gr.Guesser = playerInfo(joins[e.PlayerID])
+			gr.Guesser.PlayerID = e.PlayerID
+			gr.Guesses = guessed[:i+1]
+			gr.Guess = guessed[i]
+			gr.Rationale = e.Rationale
+			add(c, TaskGuessRationale, i, gr, e.Rationale)
+		}
+	}
+	return out
+}
+
+func lowered(words []string) []string {
+	out := make([]string, len(words))
+	for i, w := range words {
+		out[i] = strings.ToLower(w)
+	}
+	return out
+}
+
+// Ways to keep related records in the same split.
+const (
+	GroupByPlayer = "player" // players who ever shared a game
+	GroupByGame   = "game"
+	GroupBySeed   = "seed" // games on the same board: seed, generator, word list and layout
+)
+
+// Split names.
+const (
+	SplitTrain = "train"
+	SplitVal   = "val"
+	SplitTest  = "test"
+)
+
+// Splits lists the split names in order.
+var Splits = []string{SplitTrain, SplitVal, SplitTest}
+
+// Manifest records how an export was split, so it can be
+// made again.
+type Manifest struct {
+	SplitSeed    int64                     `json:"split_seed"`
+	GroupBy      string                    `json:"group_by"`
+	Fractions    map[string]float64        `json:"fractions"`
+	Games        int                       `json:"games"`
+	Partial      int                       `json:"partial_games"` // games a player withdrew from
+	Groups       map[string]int            `json:"groups"`        // by split
+	LargestGroup float64                   `json:"largest_group"` // share of the records in the biggest group
+	Counts       map[string]map[string]int `json:"counts"`        // by task, then split
+}
+
+// playerGroups joins the players who shared a game, so no player
+// ends up in two splits. It returns each player's group.
+func playerGroups(games []*Game) map[string]string {
+	parent := map[string]string{}
+	var find func(string) string
+	find = func(id string) string {
+		if p, ok := parent[id]; ok && p != id {
+			parent[id] = find(p)
+			return parent[id]
+		}
+		parent[id] = id
+		return id
+	}
+	for _, g := range games {
+		first := ""
+		for _, e := range g.Events {
+			if e.Type != "join_side" || e.PlayerID == "" || withdrawn(e.PlayerID) {
+				continue
+			}
+			if first == "" {
+				first = find(e.PlayerID)
+				continue
+			}
+			if a, b := find(first), find(e.PlayerID); a != b {
+				if a > b {
+					a, b = b, a
+				}
+				parent[b] = a
+			}
+		}
+	}
+	groups := make(map[string]string, len(parent))
+	for id := range parent {
+		groups[id] = find(id)
+	}
+	return groups
+}
+
+// boardID names the board a game was played on. A seed only
+// gives the same board with the same generator, word list and
+// layout.
+func (gs *GameState) boardID() string {
+	words := gs.WordListVersion
+	if words == "" {
+		words = gs.WordList
+	}
+	return fmt.Sprintf("%d/%s/%s/%d", gs.Generator, words, gs.layout().Name, gs.Seed)
+}
+
+// SplitRecords assigns each game's records to train, val or test,
+// keeping every group in a single split. Groups are shuffled with
+// the seed and then dealt out until each split has its fraction of
+// the records. fractions gives the train, val and test shares.
+// A group bigger than a split's share can leave that split empty,
+// so the manifest records the biggest group's share.
+func SplitRecords(games []*Game, groupBy string, seed int64, fractions [3]float64) (map[string][]Record, Manifest, error) {
+	var players map[string]string
+	switch groupBy {
+	case GroupByPlayer:
+		players = playerGroups(games)
+	case GroupByGame, GroupBySeed:
+	default:
+		return nil, Manifest{}, fmt.Errorf("unknown grouping %q; use player, game or seed", groupBy)
+	}
+	total := fractions[0] + fractions[1] + fractions[2]
+	if total <= 0 || fractions[0] < 0 || fractions[1] < 0 || fractions[2] < 0 {
+		return nil, Manifest{}, fmt.Errorf("bad split fractions %v", fractions)
+	}
+
+	byGroup := map[string][]Record{}
+	count := 0
+	m := Manifest{
+		SplitSeed: seed,
+		GroupBy:   groupBy,
+		Fractions: map[string]float64{},
+		Groups:    map[string]int{},
+		Counts:    map[string]map[string]int{},
+	}
+	for _, g := range games {
+		if g.Mode == ModeClassic {
+			continue
+		}
+		m.Games++
+		if g.Partial {
+			m.Partial++
+		}
+		board := g.boardID()
+		for _, r := range g.Records() {
+			var key string
+			switch groupBy {
+			case GroupByPlayer:
+				key = players[r.Giver.PlayerID]
+				if key == "" {
+					key = "game:" + r.GameID
+				}
+			case GroupByGame:
+				key = r.GameID
+			case GroupBySeed:
+				key = board
+			}
+			byGroup[key] = append(byGroup[key], r)
+			count++
+		}
+	}
+
+	keys := make([]string, 0, len(byGroup))
+	for k, records := range byGroup {
+		keys = append(keys, k)
+		if share := float64(len(records)) / float64(count); share > m.LargestGroup {
+			m.LargestGroup = share
+		}
+	}
+	sort.Strings(keys)
+	rand.New(rand.NewSource(seed)).Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+
+	out := map[string][]Record{}
+	for i, name := range Splits {
+		m.Fractions[name] = fractions[i] / total
+	}
+	// A split is full once the records dealt reach its cumulative share.
+	bounds := [2]float64{m.Fractions[SplitTrain], m.Fractions[SplitTrain] + m.Fractions[SplitVal]}
+	dealt, split := 0, 0
+	for _, k := range keys {
+		for split < 2 && float64(dealt) >= bounds[split]*float64(count) {
+			split++
+		}
+		name := Splits[split]
+		out[name] = append(out[name], byGroup[k]...)
+		m.Groups[name]++
+		for _, r := range byGroup[k] {
+			if m.Counts[r.Task] == nil {
+				m.Counts[r.Task] = map[string]int{}
+			}
+			m.Counts[r.Task][name]++
+		}
+		dealt += len(byGroup[k])
+	}
+	return out, m, nil
+}
+
+// ReadGames calls fn with each game JSON-encoded in r, such as
+// the /game endpoint returns. Games saved by older servers are
+// migrated to the current schema. Unlike anywhere else, events
+// that don't fit their type are loaded too, for Validate to
+// report.
+func ReadGames(r io.Reader, fn func(*Game) error) error {
+	dec := json.NewDecoder(r)
+	for {
+		var raw json.RawMessage
+		err := dec.Decode(&raw)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		b, err := migrateGame(raw)
+		if err != nil {
+			return err
+		}
+		g, err := readGame(b)
+		if err != nil {
+			return err
+		}
+		if err := fn(g); err != nil {
+			return err
+		}
+	}
+}
+
+// readGame decodes a game, loading its events whatever they hold.
+func readGame(b []byte) (*Game, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	var state map[string]json.RawMessage
+	if err := json.Unmarshal(fields["state"], &state); err != nil && fields["state"] != nil {
+		return nil, err
+	}
+	var raw []json.RawMessage
+	if evts, ok := state["events"]; ok {
+		if err := json.Unmarshal(evts, &raw); err != nil {
+			return nil, err
+		}
+		delete(state, "events")
+		var err error
+		if fields["state"], err = json.Marshal(state); err != nil {
+			return nil, err
+		}
+		if b, err = json.Marshal(fields); err != nil {
+			return nil, err
+		}
+	}
+	g := new(Game)
+	if err := json.Unmarshal(b, g); err != nil {
+		return nil, err
+	}
+	if raw != nil {
+		g.Events = make([]Event, len(raw))
+	}
+	for i, r := range raw {
+		e, err := decodeEvent(r)
+		if err != nil {
+			return nil, err
+		}
+		g.Events[i] = e
+	}
+	return g, nil
+}
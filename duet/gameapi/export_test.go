@@ -0,0 +1,117 @@
+package gameapi
+
+import (
+	"reflect"
+	"testing"
+)
+
+// exportGame returns a short Duet game between two players.
+func exportGame(id, giver, guesser string) *Game {
+	g := &Game{
+		GameID:    id,
+		Words:     []string{"Apple", "Bear", "Cat", "Dog"},
+		OneLayout: []Color{Green, Tan, Green, Black},
+		TwoLayout: []Color{Green, Green, Tan, Tan},
+	}
+	g.Events = []Event{
+		{Type: "join_side", PlayerID: giver, Team: 1, UserAge: "29", UserCountry: "Canada", UserNativeSpeaker: true},
+		{Type: "join_side", PlayerID: guesser, Team: 2, UserAge: "31", UserCountry: "India"},
+		{Type: "chat", PlayerID: giver, Team: 1, Number: 3, Num_target_words: 2,
+			Message: []string{"Fruit", "Apple", "Cat", "", "", "", "apples are fruit", "cats eat fruit", "", "", ""}},
+		{Type: "guess", PlayerID: guesser, Team: 2, Index: 0, Rationale: "apples grow on trees"},
+		{Type: "guess", PlayerID: guesser, Team: 2, Index: 1, Rationale: "bears eat berries"},
+	}
+	return g
+}
+
+func TestRecords(t *testing.T) {
+	records := exportGame("g", "a", "b").Records()
+	byTask := map[string][]Record{}
+	for _, r := range records {
+		byTask[r.Task] = append(byTask[r.Task], r)
+	}
+	want := map[string]int{
+		TaskTargetSelection: 1, TaskClueGeneration: 1, TaskGenerateGuess: 1,
+		TaskTargetRationale: 2, TaskCorrectGuess: 2, TaskGuessRationale: 2,
+	}
+	for task, n := range want {
+		if len(byTask[task]) != n {
+			t.Errorf("Expected %d %s records, got %d", n, task, len(byTask[task]))
+		}
+	}
+
+	r := byTask[TaskClueGeneration][0]
+	if r.BaseText != "black: ['dog'], tan: ['bear'], targets: ['apple', 'cat']" || r.Output != "fruit" {
+		t.Errorf("Unexpected clue generation record %q => %q", r.BaseText, r.Output)
+	}
+	if r.Giver.PlayerID != "a" || r.Giver.Country != "Canada" || !r.Giver.Native || r.Guesser.PlayerID != "b" {
+		t.Errorf("Unexpected players %+v %+v", r.Giver, r.Guesser)
+	}
+	if got := byTask[TaskGenerateGuess][0].Output; got != "apple, bear" {
+		t.Errorf("Expected the guesses as output, got %q", got)
+	}
+	if got := byTask[TaskCorrectGuess]; got[0].Output != "True" || got[1].Output != "False" {
+		t.Errorf("Expected apple guessed and cat not, got %q and %q", got[0].Output, got[1].Output)
+	}
+	gr := byTask[TaskGuessRationale][1]
+	if gr.BaseText != "guesses: ['apple', 'bear'], clue: fruit, guess: bear" || gr.Output != "bears eat berries" {
+		t.Errorf("Unexpected guess rationale record %q => %q", gr.BaseText, gr.Output)
+	}
+}
+
+func TestSplitBySeed(t *testing.T) {
+	games := []*Game{exportGame("g1", "a", "b"), exportGame("g2", "c", "d"), exportGame("g3", "e", "f")}
+	for _, g := range games {
+		g.Seed = 5
+	}
+	games[1].Layout = &Layout{Name: "other"}
+	_, m, err := SplitRecords(games, GroupBySeed, 7, [3]float64{1, 1, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if groups := m.Groups[SplitTrain] + m.Groups[SplitVal] + m.Groups[SplitTest]; groups != 2 {
+		t.Errorf("Expected the same seed on another layout to be another board, got %d groups", groups)
+	}
+}
+
+func TestSplitRecords(t *testing.T) {
+	games := []*Game{
+		exportGame("g1", "a", "b"), exportGame("g2", "b", "c"), // a, b and c are one group
+		exportGame("g3", "d", "e"), exportGame("g4", "f", "h"), exportGame("g5", "i", "j"),
+	}
+	splits, m, err := SplitRecords(games, GroupByPlayer, 7, [3]float64{3, 1, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	where := map[string]string{}
+	total := 0
+	for name, records := range splits {
+		total += len(records)
+		for _, r := range records {
+			for _, id := range []string{r.Giver.PlayerID, r.Guesser.PlayerID} {
+				if s, ok := where[id]; ok && s != name {
+					t.Errorf("Player %s is in both %s and %s", id, s, name)
+				}
+				where[id] = name
+			}
+		}
+	}
+	if total != 5*9 || m.Games != 5 || m.Groups[SplitTrain]+m.Groups[SplitVal]+m.Groups[SplitTest] != 4 {
+		t.Errorf("Unexpected manifest %+v for %d records", m, total)
+	}
+	if m.Fractions[SplitTrain] != 0.6 || m.SplitSeed != 7 || m.Counts[TaskCorrectGuess][SplitTrain]+m.Counts[TaskCorrectGuess][SplitVal]+m.Counts[TaskCorrectGuess][SplitTest] != 10 {
+		t.Errorf("Unexpected manifest %+v", m)
+	}
+
+	if m.LargestGroup != 0.4 {
+		t.Errorf("Expected the biggest group to hold 40%% of the records, got %v", m.LargestGroup)
+	}
+
+	again, _, _ := SplitRecords(games, GroupByPlayer, 7, [3]float64{3, 1, 1})
+	if !reflect.DeepEqual(again, splits) {
+		t.Error("Expected the same seed to give the same splits")
+	}
+	if _, _, err := SplitRecords(games, "board", 7, [3]float64{1, 0, 0}); err == nil {
+		t.Error("Expected an unknown grouping to fail")
+	}
+}
@@ -2,7 +2,9 @@ package gameapi
 
 import (
 	"encoding/json"
-	"math/rand"
+	"fmt"
+	"log"
+	"sort"
 	"strconv"
 	"sync"
 	"time"
@@ -14,6 +16,8 @@ const (
 	Tan Color = iota
 	Green
 	Black
+	Red
+	Blue
 )
 
 func (c Color) String() string {
@@ -22,6 +26,10 @@ func (c Color) String() string {
 		return "g"
 	case Black:
 		return "b"
+	case Red:
+		return "r"
+	case Blue:
+		return "u" // "b" is taken by black
 	default:
 		return "t"
 	}
@@ -31,6 +39,32 @@ func (c Color) MarshalJSON() ([]byte, error) {
 	return json.Marshal(c.String())
 }
 
+func (c *Color) UnmarshalJSON(b []byte) error {
+	var str string
+	if err := json.Unmarshal(b, &str); err != nil {
+		return err
+	}
+	switch str {
+	case "g":
+		*c = Green
+	case "b":
+		*c = Black
+	case "t":
+		*c = Tan
+	case "r":
+		*c = Red
+	case "u":
+		*c = Blue
+	default:
+		return fmt.Errorf("unknown color %q", str)
+	}
+	return nil
+}
+
+func (c Color) valid() bool {
+	return c == Tan || c == Green || c == Black
+}
+
 // Seed wraps an int64 with a custom JSON marshaller to marshal
 // it as a string. We use the full 64-bit range, but Javascript
 // Numbers aren't capable of representing the full range of 64-bit
@@ -55,12 +89,30 @@ func (s Seed) MarshalJSON() ([]byte, error) {
 // a Game's state. It's used to recreate games after
 // a process restart.
 type GameState struct {
-	mu      sync.Mutex        `json:"-"`
-	changed chan struct{}     `json:"-"`
-	players map[string]Player `json:"-"`
-	Seed    Seed              `json:"seed"`
-	Events  []Event           `json:"events"`
-	WordSet []string          `json:"word_set"`
+	changed         chan struct{}        `json:"-"`
+	players         map[string]Player    `json:"-"`
+	spectators      map[string]Spectator `json:"-"`
+	scrubbed        map[string]bool      `json:"-"` // players who withdrew, kept out of the game
+	SchemaVersion   int                  `json:"schema_version"`
+	Seed            Seed                 `json:"seed"`
+	Events          []Event              `json:"events"`
+	WordSet         []string             `json:"word_set"`
+	Mode            string               `json:"mode,omitempty"`
+	WordList        string               `json:"word_list,omitempty"`
+	WordListVersion string               `json:"word_list_version,omitempty"`
+	Layout          *Layout              `json:"layout,omitempty"`
+	Generator       int                  `json:"generator,omitempty"`
+	Board           []string             `json:"board,omitempty"`
+	Constraints     *ConstraintReport    `json:"constraints,omitempty"`
+	SideSize        int                  `json:"side_size,omitempty"` // players per side; 0 means one
+	SeriesID        string               `json:"series_id,omitempty"`
+	Round           int                  `json:"round,omitempty"`
+	PrevGameID      string               `json:"prev_game_id,omitempty"`
+	FirstClue       int                  `json:"first_clue,omitempty"` // side that gives the first clue; 0 means either
+	Private         bool                 `json:"private,omitempty"`    // only joined by code, never matched
+	Outcome         string               `json:"outcome,omitempty"`    // set when a game ends early
+	Clock           *Clock               `json:"clock,omitempty"`
+	Partial         bool                 `json:"partial,omitempty"` // a player withdrew and was scrubbed out
 }
 
 type Event struct {
@@ -81,12 +133,26 @@ type Event struct {
 	TwoSeenWords      []string `json:"two_seen_words"`
 	Time              int64    `json:"timestamp"`
 	Rationale         string   `json:"rationale"`
+	Role              string   `json:"role,omitempty"`
+	ReportedID        string   `json:"reported_id,omitempty"`
+
+	// SideMembers lists who was on the acting side when
+	// the event happened, if there was more than one.
+	SideMembers []string `json:"side_members,omitempty"`
+
+	// The time left on the game's clocks, if it has any running.
+	TurnMsLeft *int64 `json:"turn_ms_left,omitempty"`
+	GameMsLeft *int64 `json:"game_ms_left,omitempty"`
+
+	unknown []string // JSON fields it was decoded with that events don't have
 }
 
 type Player struct {
-	Team     int       `json:"team"`
-	Name     string    `json:"name"`
-	LastSeen time.Time `json:"last_seen"`
+	Team         int       `json:"team"`
+	Role         string    `json:"role,omitempty"`
+	Name         string    `json:"name"`
+	LastSeen     time.Time `json:"last_seen"`
+	Disconnected bool      `json:"disconnected,omitempty"`
 }
 
 func NewState(seed int64, words []string) GameState {
@@ -96,10 +162,15 @@ func NewState(seed int64, words []string) GameState {
 		Seed:    Seed(seed),
 		Events:  []Event{},
 		WordSet: words,
+
+		SchemaVersion:   CurrentSchemaVersion,
+		WordListVersion: WordListVersion(words),
+		Generator:       CurrentGenerator,
 	}
 }
 
 type Game struct {
+	mu           sync.Mutex `json:"-"`
 	GameState    `json:"state"`
 	CreatedAt    time.Time       `json:"created_at"`
 	Words        []string        `json:"words"`
@@ -108,6 +179,9 @@ type Game struct {
 	GameID       string          `json:"game_id"`
 	OneSeenWords map[string]bool `json:"one_seen_words"`
 	TwoSeenWords map[string]bool `json:"two_seen_words"`
+	Key          []Color         `json:"key,omitempty"`
+	StartingTeam int             `json:"starting_team,omitempty"`
+	clock        clockState
 }
 
 func (gs *GameState) notifyAll() {
@@ -115,8 +189,19 @@ func (gs *GameState) notifyAll() {
 	gs.changed = make(chan struct{})
 }
 
+// addEvent adds an event to the log. An event Check reports is
+// a bug in the server, and is dropped rather than written.
 func (gs *GameState) addEvent(evt Event) {
+	if err := evt.Check(); err != nil {
+		log.Printf("dropping event: %v", err)
+		return
+	}
 	evt.Number = len(gs.Events) + 1
+	if evt.Team != 0 && evt.Type != "join_side" && evt.Type != "player_left" {
+		if members := gs.sideMembers(evt.Team); len(members) > 1 {
+			evt.SideMembers = members
+		}
+	}
 	evt.Time = time.Now().Unix()
 	gs.Events = append(gs.Events, evt)
 	// Notify any waiting goroutines that the game state
@@ -135,22 +220,44 @@ func (gs *GameState) eventsSince(lastSeen int) (evts []Event, next chan struct{}
 	return evts, gs.changed
 }
 
-func (g *Game) markSeenWithUser(playerID, name string, team int, when time.Time, userAge string, userGender string, userCountry string, userNativeSpeaker bool) {
+// joinDetails is what a player sends about themselves with a
+// request that seats them in a Duet game.
+type joinDetails struct {
+	UserAge           string `json:"user_age"`
+	UserGender        string `json:"user_gender"`
+	UserCountry       string `json:"user_country"`
+	UserNativeSpeaker bool   `json:"user_native_speaker"`
+	Bot               bool   `json:"bot,omitempty"`
+}
+
+func (d joinDetails) join() JoinSideEvent {
+	j := JoinSideEvent{Age: d.UserAge, Gender: d.UserGender, Country: d.UserCountry, NativeSpeaker: d.UserNativeSpeaker}
+	if d.Bot {
+		j.Role = RoleBot
+	}
+	return j
+}
+
+// markSeenWithUser is markSeen for a player joining with the
+// background they gave, which goes on their join_side event.
+func (g *Game) markSeenWithUser(playerID, name string, team int, when time.Time, join JoinSideEvent) {
+	if s, ok := g.spectators[playerID]; ok {
+		s.LastSeen = when
+		g.spectators[playerID] = s
+		return
+	}
+	if g.released(playerID) {
+		return
+	}
 	p, ok := g.players[playerID]
 	if ok {
 		p.LastSeen = when
-		if team != 0 && p.Team != team {
+		g.reconnect(playerID, &p)
+		// Players may change sides until the first clue, but not
+		// once they've seen a key in play.
+		if team != 0 && p.Team != team && g.hasRoom(team) && (p.Team == 0 || g.firstClueSide() == 0) {
 			p.Team = team
-			g.addEvent(Event{
-				Type:              "join_side",
-				PlayerID:          playerID,
-				Name:              name,
-				Team:              team,
-				UserAge:           userAge,
-				UserGender:        userGender,
-				UserCountry:       userCountry,
-				UserNativeSpeaker: userNativeSpeaker,
-			})
+			g.addEvent(joinSide(playerID, name, team, join))
 		}
 		if name != p.Name && p.Name != "" {
 			p.Name = name
@@ -165,26 +272,38 @@ func (g *Game) markSeenWithUser(playerID, name string, team int, when time.Time,
 		return
 	}
 
+	if team != 0 && !g.hasRoom(team) {
+		team = 0 // the side is full
+	}
 	g.players[playerID] = Player{Team: team, Name: name, LastSeen: when}
 	if team != 0 {
-		g.addEvent(Event{
-			Type:              "join_side",
-			PlayerID:          playerID,
-			Name:              name,
-			Team:              team,
-			UserAge:           userAge,
-			UserGender:        userGender,
-			UserCountry:       userCountry,
-			UserNativeSpeaker: userNativeSpeaker,
-		})
+		g.addEvent(joinSide(playerID, name, team, join))
 	}
 }
 
+func joinSide(playerID, name string, team int, join JoinSideEvent) Event {
+	e := NewEvent(join)
+	e.PlayerID, e.Name, e.Team = playerID, name, team
+	return e
+}
+
 func (g *Game) markSeen(playerID, name string, team int, when time.Time) {
+	if s, ok := g.spectators[playerID]; ok {
+		s.LastSeen = when
+		g.spectators[playerID] = s
+		return
+	}
+	if g.released(playerID) {
+		return
+	}
 	p, ok := g.players[playerID]
 	if ok {
 		p.LastSeen = when
-		if team != 0 && p.Team != team {
+		g.reconnect(playerID, &p)
+		// Players may change sides until the first clue, but not
+		// once they've seen a key in play. Classic games change
+		// seats only through takeSeat.
+		if team != 0 && p.Team != team && g.Mode != ModeClassic && g.hasRoom(team) && (p.Team == 0 || g.firstClueSide() == 0) {
 			p.Team = team
 			g.addEvent(Event{
 				Type:     "join_side",
@@ -206,6 +325,14 @@ func (g *Game) markSeen(playerID, name string, team int, when time.Time) {
 		return
 	}
 
+	// Only takeSeat seats players in classic games, and only a
+	// join code seats them in private ones.
+	if g.Mode == ModeClassic || g.Private {
+		return
+	}
+	if team != 0 && !g.hasRoom(team) {
+		team = 0 // the side is full
+	}
 	g.players[playerID] = Player{Team: team, Name: name, LastSeen: when}
 	if team != 0 {
 		g.addEvent(Event{
@@ -217,6 +344,53 @@ func (g *Game) markSeen(playerID, name string, team int, when time.Time) {
 	}
 }
 
+func (gs *GameState) sideSize() int {
+	if gs.SideSize < 1 {
+		return 1
+	}
+	return gs.SideSize
+}
+
+// sideMembers returns the IDs of the players on a side, sorted.
+func (gs *GameState) sideMembers(team int) []string {
+	var ids []string
+	for id, p := range gs.players {
+		if p.Team == team {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// openSide returns the side a new player should join: the
+// preferred side if it has room, otherwise the emptier side with
+// room, or 0 if both sides are full.
+func (gs *GameState) openSide(preferred int) int {
+	var counts [3]int
+	for _, p := range gs.players {
+		if p.Team == 1 || p.Team == 2 {
+			counts[p.Team]++
+		}
+	}
+	if (preferred == 1 || preferred == 2) && counts[preferred] < gs.sideSize() {
+		return preferred
+	}
+	switch {
+	case counts[1] <= counts[2] && counts[1] < gs.sideSize():
+		return 1
+	case counts[2] < gs.sideSize():
+		return 2
+	}
+	return 0
+}
+
+// hasRoom reports whether another player may join a side.
+// Classic games limit seats by role instead, in takeSeat.
+func (gs *GameState) hasRoom(team int) bool {
+	return gs.Outcome == "" && (gs.Mode == ModeClassic || gs.openSide(team) == team)
+}
+
 func (g *Game) guess(playerID, name string, team, index int, rationale string, when time.Time) {
 	g.markSeen(playerID, name, team, when)
 
@@ -260,60 +434,70 @@ func (g *Game) pruneOldPlayers(now time.Time) (remaining int) {
 	return len(g.players)
 }
 
-func ReconstructGame(state GameState, gameId string) (g Game) {
-	g = Game{
+func ReconstructGame(state GameState, gameId string) (*Game, error) {
+	gen, err := state.generator()
+	if err != nil {
+		return nil, err
+	}
+	if state.Mode == ModeClassic {
+		return reconstructClassicGame(state, gameId, gen)
+	}
+
+	layout := state.layout()
+	cells := layout.cells()
+	if err := checkWordSet(state.WordSet, len(cells)); err != nil {
+		return nil, err
+	}
+	g := &Game{
 		GameState: state,
-		OneLayout: make([]Color, len(colorDistribution)),
-		TwoLayout: make([]Color, len(colorDistribution)),
+		OneLayout: make([]Color, len(cells)),
+		TwoLayout: make([]Color, len(cells)),
 		GameID:    gameId,
 	}
 
-	rnd := rand.New(rand.NewSource(int64(state.Seed)))
+	rnd := gen.newRand(int64(state.Seed))
 
-	// Pick 25 random words.
-	used := make(map[string]bool, len(colorDistribution))
-	for len(used) < len(colorDistribution) {
-		w := state.WordSet[rnd.Intn(len(state.WordSet))]
-		if !used[w] {
-			g.Words = append(g.Words, w)
-			used[w] = true
-		}
+	// Pick one random word per cell.
+	g.Words, err = state.boardWords(gen, rnd, len(cells))
+	if err != nil {
+		return nil, err
 	}
 
 	// Assign the colors for each team, according to the
-	// relative distribution in the rule book.
-	perm := rnd.Perm(len(colorDistribution))
-	for i, colors := range colorDistribution {
+	// relative distribution in the layout's key.
+	perm := rnd.Perm(len(cells))
+	for i, colors := range cells {
 		g.OneLayout[perm[i]] = colors[0]
 		g.TwoLayout[perm[i]] = colors[1]
 	}
-	return g
+	if g.Clock != nil {
+		g.restoreClock()
+	}
+	return g, nil
+}
+
+// boardWords returns the words for a board of n cells: the words
+// chosen when the game was created, if it was generated under
+// constraints, or else n words drawn from the word set.
+func (gs *GameState) boardWords(gen generator, rnd boardRand, n int) ([]string, error) {
+	if len(gs.Board) == 0 {
+		return gen.pickWords(rnd, gs.WordSet, n), nil
+	}
+	if len(gs.Board) != n {
+		return nil, fmt.Errorf("the stored board has %d words for %d cells", len(gs.Board), n)
+	}
+	return append([]string(nil), gs.Board...), nil
 }
 
-var colorDistribution = [25][2]Color{
-	{Black, Green},
-	{Tan, Green},
-	{Tan, Green},
-	{Tan, Green},
-	{Tan, Green},
-	{Tan, Green},
-	{Green, Green},
-	{Green, Green},
-	{Green, Green},
-	{Green, Tan},
-	{Green, Tan},
-	{Green, Tan},
-	{Green, Tan},
-	{Green, Tan},
-	{Green, Black},
-	{Tan, Black},
-	{Black, Black},
-	{Tan, Tan},
-	{Tan, Tan},
-	{Tan, Tan},
-	{Tan, Tan},
-	{Tan, Tan},
-	{Tan, Tan},
-	{Tan, Tan},
-	{Black, Tan},
+// checkWordSet makes sure there are enough distinct words
+// to fill a board of n cells.
+func checkWordSet(wordSet []string, n int) error {
+	distinct := make(map[string]bool, len(wordSet))
+	for _, w := range wordSet {
+		distinct[w] = true
+	}
+	if len(distinct) < n {
+		return fmt.Errorf("a board of %d cells needs %d distinct words, the word set has %d", n, n, len(distinct))
+	}
+	return nil
 }
@@ -0,0 +1,46 @@
+package gameapi
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSharedSides(t *testing.T) {
+	state := NewState(5, numberedWords(40))
+	state.SideSize = 2
+	g, err := ReconstructGame(state, "shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+
+	var sides []int
+	for _, id := range []string{"a", "b", "c", "d"} {
+		team := g.openSide(0)
+		sides = append(sides, team)
+		g.markSeen(id, id, team, now)
+	}
+	if !reflect.DeepEqual(sides, []int{1, 2, 1, 2}) {
+		t.Errorf("Expected players to alternate sides, got %v", sides)
+	}
+	if team := g.openSide(1); team != 0 {
+		t.Errorf("Expected both sides to be full, got side %d", team)
+	}
+
+	g.markSeen("e", "e", 1, now)
+	if p := g.players["e"]; p.Team != 0 {
+		t.Errorf("Expected a player to be kept off a full side, got side %d", p.Team)
+	}
+	g.watch("f", "f", ViewNone, now)
+	g.markSeen("f", "f", 2, now)
+	if p, ok := g.players["f"]; ok || !g.spectating("f") {
+		t.Errorf("Expected a spectator to stay out of the players, got %+v", p)
+	}
+
+	g.guess("c", "c", 1, 3, "", now)
+	last := g.Events[len(g.Events)-1]
+	if last.PlayerID != "c" || !reflect.DeepEqual(last.SideMembers, []string{"a", "c"}) {
+		t.Errorf("Expected the guess to record c acting for a and c, got %+v", last)
+	}
+}
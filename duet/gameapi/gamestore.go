@@ -0,0 +1,209 @@
+package gameapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StoredGame is a game as the game store keeps it: enough
+// to rebuild it with ReconstructGame.
+type StoredGame struct {
+	GameID    string    `json:"game_id"`
+	CreatedAt time.Time `json:"created_at"`
+	State     GameState `json:"state"`
+}
+
+// gameStore keeps games after they leave h.games, and knows which
+// games each player joined. When dir is set, each game is written
+// to dir/<game id>.json as it changes, and the games written by
+// earlier runs are indexed at startup.
+type gameStore struct {
+	dir string
+
+	mu      sync.Mutex
+	saved   map[string]int             // events saved, by game ID
+	players map[string]map[string]bool // game IDs, by player ID
+}
+
+func newGameStore(dir string) (*gameStore, error) {
+	s := &gameStore{
+		dir:     dir,
+		saved:   make(map[string]int),
+		players: make(map[string]map[string]bool),
+	}
+	if dir == "" {
+		return s, nil
+	}
+	matches, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range matches {
+		sg, err := readStoredGame(m)
+		if err != nil {
+			return nil, err
+		}
+		s.saved[sg.GameID] = len(sg.State.Events)
+		s.index(sg.GameID, sg.State.Events)
+	}
+	return s, nil
+}
+
+func readStoredGame(filename string) (StoredGame, error) {
+	var sg StoredGame
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return sg, err
+	}
+	if b, err = migrateGame(b); err != nil {
+		return sg, fmt.Errorf("%s: %v", filename, err)
+	}
+	if err := json.Unmarshal(b, &sg); err != nil {
+		return sg, err
+	}
+	if sg.GameID == "" {
+		sg.GameID = strings.TrimSuffix(filepath.Base(filename), ".json")
+	}
+	return sg, nil
+}
+
+// index records the players who joined a game. The caller holds s.mu.
+func (s *gameStore) index(gameID string, evts []Event) {
+	for _, e := range evts {
+		if e.Type != "join_side" || e.PlayerID == "" {
+			continue
+		}
+		if s.players[e.PlayerID] == nil {
+			s.players[e.PlayerID] = make(map[string]bool)
+		}
+		s.players[e.PlayerID][gameID] = true
+	}
+}
+
+// save writes g out if it has changed since it was last saved.
+// The caller holds g.mu.
+func (s *gameStore) save(g *Game) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.saved[g.GameID] == len(g.Events) {
+		return nil
+	}
+	return s.write(g)
+}
+
+// rewrite writes g out even if no events were added, such as
+// after events were scrubbed. The caller holds g.mu.
+func (s *gameStore) rewrite(g *Game) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.write(g)
+}
+
+// write writes g out. The caller holds g.mu and s.mu.
+func (s *gameStore) write(g *Game) error {
+	s.index(g.GameID, g.Events[s.saved[g.GameID]:])
+	if s.dir != "" {
+		b, err := json.Marshal(StoredGame{GameID: g.GameID, CreatedAt: g.CreatedAt, State: g.GameState})
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(s.dir, 0755); err != nil {
+			return err
+		}
+		// Write a new file and rename it, so a crash never
+		// leaves half a game behind.
+		name := filepath.Join(s.dir, g.GameID+".json")
+		if err := ioutil.WriteFile(name+".tmp", b, 0644); err != nil {
+			return err
+		}
+		if err := os.Rename(name+".tmp", name); err != nil {
+			return err
+		}
+	}
+	s.saved[g.GameID] = len(g.Events)
+	return nil
+}
+
+// load rebuilds a stored game.
+func (s *gameStore) load(gameID string) (*Game, error) {
+	if s.dir == "" {
+		return nil, os.ErrNotExist
+	}
+	sg, err := readStoredGame(filepath.Join(s.dir, gameID+".json"))
+	if err != nil {
+		return nil, err
+	}
+	g, err := ReconstructGame(sg.State, sg.GameID)
+	if err != nil {
+		return nil, err
+	}
+	g.CreatedAt = sg.CreatedAt
+	return g, nil
+}
+
+// forget drops a player from the index, once they've been
+// scrubbed from their games.
+func (s *gameStore) forget(playerID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.players, playerID)
+}
+
+// gamesOf returns the IDs of the stored games a player joined.
+func (s *gameStore) gamesOf(playerID string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, 0, len(s.players[playerID]))
+	for id := range s.players[playerID] {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// over reports whether g has ended. The caller holds g.mu.
+func (g *Game) over() bool {
+	switch {
+	case g.Outcome != "":
+		return true
+	case g.Mode == ModeClassic:
+		return g.classicState().Winner != 0
+	}
+	return g.duetState().Outcome != ""
+}
+
+// saveIfOver saves g as soon as it ends, rather than on the next
+// tick, so a finished game is never lost to a restart. The caller
+// holds g.mu.
+func (h *handler) saveIfOver(g *Game) {
+	if !g.over() {
+		return
+	}
+	if err := h.store.save(g); err != nil {
+		log.Printf("saving game %s: %s", g.GameID, err)
+	}
+}
+
+// saveGames writes out the games that have changed.
+func (h *handler) saveGames() {
+	h.mu.Lock()
+	games := make([]*Game, 0, len(h.games))
+	for _, g := range h.games {
+		games = append(games, g)
+	}
+	h.mu.Unlock()
+
+	for _, g := range games {
+		g.mu.Lock()
+		if err := h.store.save(g); err != nil {
+			log.Printf("saving game %s: %s", g.GameID, err)
+		}
+		g.mu.Unlock()
+	}
+}
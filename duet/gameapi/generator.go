@@ -0,0 +1,133 @@
+package gameapi
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Board generator versions. A game's board is regenerated from its
+// seed, word set and generator version every time it's loaded, and
+// published datasets refer to boards by seed, so a version's output
+// must never change once it has been used. New sampling procedures
+// get a new version instead.
+const (
+	// GeneratorLegacy is math/rand's Go 1 generator, frozen in
+	// legacyrand.go, drawing words from the word set as given.
+	// Games stored before generators were versioned use it.
+	GeneratorLegacy = 0
+
+	// GeneratorSplitMix64 is the SplitMix64 generator drawing
+	// words from the sorted, de-duplicated word set, so the order
+	// a word list happens to be stored in doesn't affect boards.
+	GeneratorSplitMix64 = 1
+
+	// CurrentGenerator is used for new games.
+	CurrentGenerator = GeneratorSplitMix64
+)
+
+// boardRand is the randomness a board generator draws on.
+type boardRand interface {
+	// Intn returns a number in [0, n).
+	Intn(n int) int
+	// Perm returns a permutation of [0, n).
+	Perm(n int) []int
+}
+
+type generator struct {
+	newRand   func(seed int64) boardRand
+	pickWords func(rnd boardRand, wordSet []string, n int) []string
+}
+
+var generators = map[int]generator{
+	GeneratorLegacy:     {newRand: newLegacyRand, pickWords: pickWordsLegacy},
+	GeneratorSplitMix64: {newRand: newSplitMix64, pickWords: pickWordsSorted},
+}
+
+// generator returns the board generator the game was created with.
+func (gs *GameState) generator() (generator, error) {
+	gen, ok := generators[gs.Generator]
+	if !ok {
+		return generator{}, fmt.Errorf("unknown board generator version %d", gs.Generator)
+	}
+	return gen, nil
+}
+
+// pickWordsLegacy draws n distinct words by repeatedly picking
+// from the whole word set and skipping repeats.
+func pickWordsLegacy(rnd boardRand, wordSet []string, n int) []string {
+	words := make([]string, 0, n)
+	used := make(map[string]bool, n)
+	for len(used) < n {
+		w := wordSet[rnd.Intn(len(wordSet))]
+		if !used[w] {
+			words = append(words, w)
+			used[w] = true
+		}
+	}
+	return words
+}
+
+// pickWordsSorted sorts and de-duplicates the word set, then draws
+// n words with the first n steps of a Fisher-Yates shuffle.
+func pickWordsSorted(rnd boardRand, wordSet []string, n int) []string {
+	pool := make([]string, 0, len(wordSet))
+	seen := make(map[string]bool, len(wordSet))
+	for _, w := range wordSet {
+		if !seen[w] {
+			pool = append(pool, w)
+			seen[w] = true
+		}
+	}
+	sort.Strings(pool)
+
+	for i := 0; i < n; i++ {
+		j := i + rnd.Intn(len(pool)-i)
+		pool[i], pool[j] = pool[j], pool[i]
+	}
+	return pool[:n]
+}
+
+// splitMix64 is Steele, Lea and Flood's SplitMix64 generator.
+type splitMix64 struct {
+	state uint64
+}
+
+func newSplitMix64(seed int64) boardRand {
+	return &splitMix64{state: uint64(seed)}
+}
+
+func (r *splitMix64) next() uint64 {
+	r.state += 0x9e3779b97f4a7c15
+	z := r.state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// Intn uses rejection sampling so that every result is equally
+// likely: values below 2^64 mod n are redrawn.
+func (r *splitMix64) Intn(n int) int {
+	if n <= 0 {
+		panic("invalid argument to Intn")
+	}
+	un := uint64(n)
+	threshold := -un % un
+	for {
+		if v := r.next(); v >= threshold {
+			return int(v % un)
+		}
+	}
+}
+
+// Perm is a Fisher-Yates shuffle of [0, n), swapping from the end.
+func (r *splitMix64) Perm(n int) []int {
+	m := make([]int, n)
+	for i := range m {
+		m[i] = i
+	}
+	for i := n - 1; i > 0; i-- {
+		j := r.Intn(i + 1)
+		m[i], m[j] = m[j], m[i]
+	}
+	return m
+}
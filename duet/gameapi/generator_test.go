@@ -0,0 +1,127 @@
+package gameapi
+
+import (
+	"codenamesgreen/dictionary-master"
+	"encoding/json"
+	"io/ioutil"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// goldenBoard is a board that a generator version must keep
+// producing from the original word list for as long as it exists.
+type goldenBoard struct {
+	Seed      Seed     `json:"seed"`
+	Words     []string `json:"words"`
+	OneLayout string   `json:"one_layout"`
+	TwoLayout string   `json:"two_layout"`
+}
+
+func originalWordSet(t *testing.T) []string {
+	d, err := dictionary.Load("../wordlists/original.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	words := d.Words()
+	sort.Strings(words)
+	return words
+}
+
+func layoutString(layout []Color) string {
+	s := ""
+	for _, c := range layout {
+		s += c.String()
+	}
+	return s
+}
+
+func testGoldenBoards(t *testing.T, filename string, version int) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var golden []goldenBoard
+	if err := json.Unmarshal(b, &golden); err != nil {
+		t.Fatal(err)
+	}
+
+	wordSet := originalWordSet(t)
+	for _, gb := range golden {
+		state := NewState(int64(gb.Seed), wordSet)
+		state.Generator = version
+		state.Layout = nil
+		g, err := ReconstructGame(state, "golden")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(g.Words, gb.Words) {
+			t.Errorf("seed %d: expected words %v, got %v", gb.Seed, gb.Words, g.Words)
+		}
+		if one := layoutString(g.OneLayout); one != gb.OneLayout {
+			t.Errorf("seed %d: expected side one key %s, got %s", gb.Seed, gb.OneLayout, one)
+		}
+		if two := layoutString(g.TwoLayout); two != gb.TwoLayout {
+			t.Errorf("seed %d: expected side two key %s, got %s", gb.Seed, gb.TwoLayout, two)
+		}
+	}
+}
+
+// TestLegacyBoards checks boards recorded with the math/rand based
+// ReconstructGame that generated every game in the published data.
+func TestLegacyBoards(t *testing.T) {
+	testGoldenBoards(t, "testdata/legacy_boards.json", GeneratorLegacy)
+}
+
+func TestSplitMix64Boards(t *testing.T) {
+	testGoldenBoards(t, "testdata/splitmix64_boards.json", GeneratorSplitMix64)
+}
+
+// TestLegacyRandMatchesMathRand checks the frozen copy against the
+// standard library it was taken from, as long as the two agree.
+func TestLegacyRandMatchesMathRand(t *testing.T) {
+	for _, seed := range []int64{0, 1, -5, 1 << 40, -1 << 62} {
+		want := rand.New(rand.NewSource(seed))
+		got := newLegacyRand(seed)
+		for n := 1; n < 200; n++ {
+			if w, g := want.Intn(n), got.Intn(n); w != g {
+				t.Fatalf("seed %d: Intn(%d) = %d, math/rand gave %d", seed, n, g, w)
+			}
+		}
+		if w, g := want.Perm(30), got.Perm(30); !reflect.DeepEqual(w, g) {
+			t.Fatalf("seed %d: Perm(30) = %v, math/rand gave %v", seed, g, w)
+		}
+		if w, g := want.Intn(1<<40), got.Intn(1<<40); w != g {
+			t.Fatalf("seed %d: Intn(1<<40) = %d, math/rand gave %d", seed, g, w)
+		}
+	}
+}
+
+func TestSplitMix64IgnoresWordSetOrder(t *testing.T) {
+	wordSet := originalWordSet(t)
+	reversed := make([]string, len(wordSet))
+	for i, w := range wordSet {
+		reversed[len(wordSet)-1-i] = w
+	}
+
+	a, err := ReconstructGame(NewState(99, wordSet), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ReconstructGame(NewState(99, append(reversed, wordSet[0])), "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(a.Words, b.Words) {
+		t.Errorf("Expected the same words regardless of order, got %v and %v", a.Words, b.Words)
+	}
+}
+
+func TestUnknownGenerator(t *testing.T) {
+	state := NewState(1, originalWordSet(t))
+	state.Generator = 99
+	if _, err := ReconstructGame(state, "x"); err == nil {
+		t.Error("Expected an unknown generator version to be rejected")
+	}
+}
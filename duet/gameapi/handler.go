@@ -2,6 +2,7 @@ package gameapi
 
 import (
 	"codenamesgreen/dictionary-master"
+	"context"
 	"encoding/json"
 	"fmt"
 	"math/rand"
@@ -13,13 +14,115 @@ import (
 	"time"
 )
 
+// Config holds the server settings that aren't word lists.
+type Config struct {
+	// WordListDir is where uploaded word lists are saved. When
+	// empty, uploads only live as long as the process.
+	WordListDir string
+
+	// GameDir is where games are saved as they're played, so
+	// player histories outlive the process. The report registry
+	// is kept there too. When empty, histories only cover the
+	// games played since it started, and reports are forgotten
+	// on restart.
+	GameDir string
+
+	// Layouts are the key cards new games may ask for by name.
+	// The standard Duet layout is always available.
+	Layouts map[string]Layout
+
+	// WordMetadata backs boards generated under constraints.
+	// Without it, only the no-near-duplicates constraint works.
+	WordMetadata *WordMetadata
+
+	// RoomTTL is how long a private room's join code lasts
+	// before a friend uses it. Zero means 15 minutes.
+	RoomTTL time.Duration
+
+	// DisconnectAfter is how long a seated player can go without a
+	// request before they're reported as disconnected. Zero means
+	// 40 seconds.
+	DisconnectAfter time.Duration
+
+	// Inactivity ends Duet games that a player stops playing.
+	Inactivity InactivityPolicy
+
+	// ReportThreshold is how many players with unreviewed reports
+	// about someone keep them out of matchmaking. Zero means 3.
+	ReportThreshold int
+
+	// AdminToken unlocks the review queue, the message export,
+	// withdrawals, word list uploads, spectator links that show a
+	// key and any player's history.
+	// Admin actions are turned off without one.
+	AdminToken string
+
+	// Messages limits the free-text channel between partners.
+	Messages MessagePolicy
+
+	// Blocklist screens clues, rationales and messages, and is run
+	// over logs before they're exported. Nil turns screening off.
+	Blocklist *Blocklist
+
+	// Context stops the handler's background work, watching
+	// presence and saving games, once it's done. Nil keeps it
+	// running until the process exits.
+	Context context.Context
+}
+
 // Handler implements the codenames green server handler.
-func Handler(wordLists map[string][]string) http.Handler {
+func Handler(wordLists map[string][]string, cfg Config) (http.Handler, error) {
+	store, err := newWordListStore(cfg.WordListDir, wordLists)
+	if err != nil {
+		return nil, err
+	}
+	games, err := newGameStore(cfg.GameDir)
+	if err != nil {
+		return nil, err
+	}
+	participants, err := loadParticipants(cfg.GameDir)
+	if err != nil {
+		return nil, err
+	}
 	h := &handler{
 		mux:       http.NewServeMux(),
-		wordLists: wordLists,
+		wordLists: store,
+		layouts:   map[string]Layout{DuetLayout.Name: DuetLayout},
+		wordMeta:  cfg.WordMetadata,
 		rand:      rand.New(rand.NewSource(time.Now().UnixNano())),
 		games:     make(map[string]*Game),
+		store:     games,
+
+		spectatorLinks: make(map[string]spectatorLink),
+		rooms:          make(map[string]*room),
+		sessions:       make(map[string]seatRef),
+		participants:   participants,
+
+		roomTTL:         cfg.RoomTTL,
+		disconnectAfter: cfg.DisconnectAfter,
+		inactivity:      cfg.Inactivity,
+		reportThreshold: cfg.ReportThreshold,
+		adminToken:      cfg.AdminToken,
+		messages:        cfg.Messages,
+		blocklist:       cfg.Blocklist,
+	}
+	if h.messages.MaxLength <= 0 {
+		h.messages.MaxLength = defaultMaxMessage
+	}
+	if h.reportThreshold <= 0 {
+		h.reportThreshold = defaultReportThreshold
+	}
+	if h.roomTTL <= 0 {
+		h.roomTTL = defaultRoomTTL
+	}
+	if h.disconnectAfter <= 0 {
+		h.disconnectAfter = defaultDisconnectAfter
+	}
+	for name, l := range cfg.Layouts {
+		if err := l.Validate(); err != nil {
+			return nil, err
+		}
+		h.layouts[name] = l
 	}
 
 	// Build a list of all words. The combined list
@@ -46,6 +149,37 @@ func Handler(wordLists map[string][]string) http.Handler {
 	h.mux.HandleFunc("/stats", h.handleStats)
 	h.mux.HandleFunc("/ids", h.handleIds)
 	h.mux.HandleFunc("/game", h.handleGame)
+	h.mux.HandleFunc("/word-lists", h.handleWordLists)
+	h.mux.HandleFunc("/word-list", h.handleWordList)
+	h.mux.HandleFunc("/upload-word-list", h.handleUploadWordList)
+	h.mux.HandleFunc("/new-classic-game", h.handleNewClassicGame)
+	h.mux.HandleFunc("/join-classic-game", h.handleJoinClassicGame)
+	h.mux.HandleFunc("/classic-game", h.handleClassicGame)
+	h.mux.HandleFunc("/clue", h.handleClue)
+	h.mux.HandleFunc("/spectator-link", h.handleSpectatorLink)
+	h.mux.HandleFunc("/watch", h.handleWatch)
+	h.mux.HandleFunc("/rematch", h.handleRematch)
+	h.mux.HandleFunc("/new-room", h.handleNewRoom)
+	h.mux.HandleFunc("/join-room", h.handleJoinRoom)
+	h.mux.HandleFunc("/session", h.handleSession)
+	h.mux.HandleFunc("/resume", h.handleResume)
+	h.mux.HandleFunc("/presence", h.handlePresence)
+	h.mux.HandleFunc("/report", h.handleReport)
+	h.mux.HandleFunc("/review-queue", h.handleReviewQueue)
+	h.mux.HandleFunc("/review", h.handleReview)
+	h.mux.HandleFunc("/message", h.handleMessage)
+	h.mux.HandleFunc("/export-messages", h.handleExportMessages)
+	h.mux.HandleFunc("/metrics", h.handleMetrics)
+	h.mux.HandleFunc("/history", h.handleHistory)
+	h.mux.HandleFunc("/withdraw", h.handleWithdraw)
+
+	// Report players whose heartbeats stop, and save games
+	// as they change.
+	ctx := cfg.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	go h.watchPresence(ctx, 5*time.Second)
 
 	// Periodically remove games that are old and inactive.
 	// let's NOT do this for now...
@@ -66,17 +200,32 @@ func Handler(wordLists map[string][]string) http.Handler {
 	// 	}
 	// }()
 
-	return h
+	return h, nil
 }
 
 type handler struct {
 	mux       *http.ServeMux
-	wordLists map[string][]string
+	wordLists *wordListStore
+	layouts   map[string]Layout
+	wordMeta  *WordMetadata
 	allWords  []string
 	rand      *rand.Rand
-
-	mu    sync.Mutex
-	games map[string]*Game
+	store     *gameStore
+
+	roomTTL         time.Duration
+	disconnectAfter time.Duration
+	inactivity      InactivityPolicy
+	reportThreshold int
+	adminToken      string
+	messages        MessagePolicy
+	blocklist       *Blocklist
+
+	mu             sync.Mutex
+	games          map[string]*Game
+	spectatorLinks map[string]spectatorLink
+	rooms          map[string]*room
+	sessions       map[string]seatRef
+	participants   map[string]*Participant
 }
 
 func (h *handler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
@@ -95,12 +244,16 @@ func (h *handler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 }
 
 // POST /ids
-// get all the game ids in use
+// get all the game ids in use, less those of private games
 func (h *handler) handleIds(rw http.ResponseWriter, req *http.Request) {
 	h.mu.Lock()
 	keys := make([]string, 0, len(h.games))
-	for id := range h.games {
-		keys = append(keys, id)
+	for id, g := range h.games {
+		g.mu.Lock()
+		if !g.Private {
+			keys = append(keys, id)
+		}
+		g.mu.Unlock()
 	}
 	h.mu.Unlock()
 	writeJSON(rw, keys)
@@ -110,7 +263,9 @@ func (h *handler) handleIds(rw http.ResponseWriter, req *http.Request) {
 // get the game state as a json (pretty big, can be ugly)
 func (h *handler) handleGame(rw http.ResponseWriter, req *http.Request) {
 	var body struct {
-		GameID string `json:"game_id"`
+		GameID   string `json:"game_id"`
+		PlayerID string `json:"player_id,omitempty"`
+		Redact   bool   `json:"redact,omitempty"` // star out blocked words
 	}
 
 	err := json.NewDecoder(req.Body).Decode(&body)
@@ -126,7 +281,35 @@ func (h *handler) handleGame(rw http.ResponseWriter, req *http.Request) {
 		writeError(rw, "not_found", "Game not found", 404)
 		return
 	}
-	writeJSON(rw, g)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	// Spectators see the keys their link shows, and callers
+	// without a side in a Duet game see neither.
+	var view interface{}
+	if s, ok := g.spectators[body.PlayerID]; ok {
+		view = g.spectatorView(s.View)
+	} else if g.Mode != ModeClassic && g.players[body.PlayerID].Team == 0 {
+		view = g.spectatorView(ViewNone)
+	} else {
+		view = g.playerView(body.PlayerID)
+	}
+	switch v := view.(type) {
+	case SpectatorView:
+		if body.Redact {
+			v.State.Events = h.blocklist.RedactEvents(v.State.Events)
+		}
+		writeJSON(rw, v)
+	case classicView:
+		if body.Redact {
+			v.Events = h.blocklist.RedactEvents(v.Events)
+		}
+		writeJSON(rw, v)
+	case gameView:
+		if body.Redact {
+			v.State.Events = h.blocklist.RedactEvents(v.State.Events)
+		}
+		writeJSON(rw, v)
+	}
 }
 
 // POST /index
@@ -138,7 +321,7 @@ func (h *handler) handleIndex(rw http.ResponseWriter, req *http.Request) {
 	for {
 		w1 := strings.ToLower(h.allWords[h.rand.Int63n(int64(len(h.allWords)))])
 		w2 := strings.ToLower(h.allWords[h.rand.Int63n(int64(len(h.allWords)))])
-		id := fmt.Sprintf("%s-%s", w1, w2)
+		id = fmt.Sprintf("%s-%s", w1, w2)
 		if _, ok := h.games[id]; !ok {
 			break
 		}
@@ -173,15 +356,20 @@ func randomString(length int) string {
 // POST /new-game
 func (h *handler) handleNewGame(rw http.ResponseWriter, req *http.Request) {
 	var body struct {
-		GameID            *string  `json:"game_id,omitempty"`
-		Words             []string `json:"words,omitempty"`
-		PrevSeed          *Seed    `json:"prev_seed,omitempty"` // a string because of js number precision
-		PlayerID          string   `json:"player_id"`
-		Name              string   `json:"name"`
-		UserAge           string   `json:"user_age"`
-		UserGender        string   `json:"user_gender"`
-		UserCountry       string   `json:"user_country"`
-		UserNativeSpeaker bool     `json:"user_native_speaker"`
+		GameID          *string           `json:"game_id,omitempty"`
+		Words           []string          `json:"words,omitempty"`
+		WordList        string            `json:"word_list,omitempty"`
+		WordListVersion string            `json:"word_list_version,omitempty"`
+		Layout          string            `json:"layout,omitempty"`
+		Constraints     *BoardConstraints `json:"constraints,omitempty"`
+		SideSize        int               `json:"side_size,omitempty"`
+		Clock           *Clock            `json:"clock,omitempty"`
+		Team            int               `json:"team,omitempty"`
+		Spectator       bool              `json:"spectator,omitempty"`
+		PrevSeed        *Seed             `json:"prev_seed,omitempty"` // a string because of js number precision
+		PlayerID        string            `json:"player_id"`
+		Name            string            `json:"name"`
+		joinDetails
 	}
 
 	err := json.NewDecoder(req.Body).Decode(&body)
@@ -201,41 +389,109 @@ func (h *handler) handleNewGame(rw http.ResponseWriter, req *http.Request) {
 			defer oldGame.mu.Unlock()
 		}
 
-		if len(oldGame.players) >= 2 {
-			writeError(rw, "game_full", "The game is already full.", 400)
+		if ok {
+			_, seen := oldGame.players[body.PlayerID]
+			if !seen && oldGame.Private {
+				writeError(rw, "private_game", "This game is private: join it with its code.", 403)
+				return
+			}
+		}
+
+		// Spectators never take a seat, so they can always watch.
+		// Without a spectator link they see neither key card.
+		if ok && body.Spectator {
+			oldGame.watch(body.PlayerID, body.Name, ViewNone, time.Now())
+			writeJSON(rw, oldGame.spectatorView(ViewNone))
 			return
 		}
 
+		if ok {
+			_, seen := oldGame.players[body.PlayerID]
+			if !seen && oldGame.openSide(body.Team) == 0 {
+				writeError(rw, "game_full", "The game is already full.", 400)
+				return
+			}
+		}
+
 		// the user is in the game-
 		if ok && (body.PrevSeed == nil || *body.PrevSeed != oldGame.Seed) {
-			writeJSON(rw, oldGame)
+			// Other players take their seat when they first poll,
+			// but a bot sits down now so its join records it as one.
+			// Classic seats are only taken through /join-classic-game.
+			if _, seen := oldGame.players[body.PlayerID]; !seen && body.Bot && oldGame.Mode != ModeClassic {
+				oldGame.markSeenWithUser(body.PlayerID, body.Name, oldGame.openSide(body.Team), time.Now(), body.join())
+			}
+			writeJSON(rw, oldGame.playerView(body.PlayerID))
 			return
 		}
 
 	}
+	if body.Spectator {
+		writeError(rw, "malformed_body", "Spectators need a game_id to watch.", 400)
+		return
+	}
+	if body.SideSize < 0 || body.Team < 0 || body.Team > 2 || !body.Clock.orZero().valid() {
+		writeError(rw, "malformed_body", "Unable to parse request body.", 400)
+		return
+	}
+
+	// Work out which words a new game would use before pairing,
+	// so a player who asked for a particular word list only joins
+	// a game drawn from that exact list.
+	words, listName, ok := h.wordsFor(body.Words, body.WordList, body.WordListVersion)
+	if !ok {
+		writeError(rw, "unknown_word_list", "No word list has that name or version.", 404)
+		return
+	}
+	layout := DuetLayout
+	if body.Layout != "" {
+		l, ok := h.layouts[body.Layout]
+		if !ok {
+			writeError(rw, "unknown_layout", "No layout has that name.", 404)
+			return
+		}
+		layout = l
+	}
+	if len(words) < layout.Size() {
+		writeError(rw, "too_few_words",
+			fmt.Sprintf("A word list must have at least %d words.", layout.Size()), 400)
+		return
+	}
+	version := WordListVersion(words)
 
 	// can we auto-add them to an old game?
 	// first, is this player ALREADY in a game?
+	// Games that ended early, and seats without a side, don't count.
 	for _, g := range h.games {
 		g.mu.Lock()
-		for k, _ := range g.players {
-			if k == body.PlayerID {
-				writeJSON(rw, g)
-				g.mu.Unlock()
-				return
-			}
+		if p, ok := g.players[body.PlayerID]; ok && p.Team != 0 && g.Outcome == "" {
+			writeJSON(rw, g.playerView(body.PlayerID))
+			g.mu.Unlock()
+			return
 		}
 		g.mu.Unlock()
 	}
 
-	// if not, let's find a game with one player
+	// Players with too many reports wait for an admin's review.
+	if h.excluded(body.PlayerID) {
+		writeError(rw, "excluded", "You can't be matched with a partner right now.", 403)
+		return
+	}
+
+	// if not, let's find a game with room on a side
+	sideSize := body.SideSize
+	if sideSize == 0 {
+		sideSize = 1
+	}
 	for _, g := range h.games {
 		g.mu.Lock()
-		if len(g.players) == 1 {
-			g.markSeenWithUser(body.PlayerID, body.Name, 2, time.Now(), body.UserAge, body.UserGender, body.UserCountry, body.UserNativeSpeaker)
-			writeJSON(rw, g)
-			g.mu.Unlock()
-			return
+		if g.pairable(version, layout.Name, body.Constraints.orZero(), sideSize, body.Clock.orZero()) {
+			if team := g.openSide(body.Team); team != 0 {
+				g.markSeenWithUser(body.PlayerID, body.Name, team, time.Now(), body.join())
+				writeJSON(rw, g.playerView(body.PlayerID))
+				g.mu.Unlock()
+				return
+			}
 		}
 		g.mu.Unlock()
 	}
@@ -243,18 +499,23 @@ func (h *handler) handleNewGame(rw http.ResponseWriter, req *http.Request) {
 	// if we can't, create a new game
 	newGameID := randomString(8)
 
-	words := body.Words
-	if len(words) == 0 {
-		words = h.allWords
+	state := NewState(h.rand.Int63(), words)
+	state.WordList = listName
+	state.Layout = &layout
+	state.SideSize = body.SideSize
+	state.Clock = body.Clock
+	if body.Constraints != nil {
+		if err := h.constrainBoard(&state, *body.Constraints); err != nil {
+			writeError(rw, "bad_constraints", err.Error(), 400)
+			return
+		}
 	}
-	if len(words) < len(colorDistribution) {
-		writeError(rw, "too_few_words",
-			fmt.Sprintf("A word list must have at least %d words.", len(colorDistribution)), 400)
+	g, err := ReconstructGame(state, newGameID)
+	if err != nil {
+		writeError(rw, "bad_word_list", err.Error(), 400)
 		return
 	}
 
-	game := ReconstructGame(NewState(h.rand.Int63(), words), newGameID)
-
 	// comment out carry-over behaviour - we don't need this.
 	// if oldGame != nil {
 	// 	// Carry over the players but without teams in case
@@ -267,7 +528,6 @@ func (h *handler) handleNewGame(rw http.ResponseWriter, req *http.Request) {
 	// 	oldGame.notifyAll()
 	// }
 
-	g := &game
 	g.CreatedAt = time.Now()
 	// g.addEvent(Event{
 	// 	Type:     "chat",
@@ -276,9 +536,17 @@ func (h *handler) handleNewGame(rw http.ResponseWriter, req *http.Request) {
 	// 	Name:     "MTurk Instruction",
 	// 	Message:  "Your GAME ID is: " + newGameID,
 	// })
-	g.markSeenWithUser(body.PlayerID, body.Name, 1, time.Now(), body.UserAge, body.UserGender, body.UserCountry, body.UserNativeSpeaker)
+	g.markSeenWithUser(body.PlayerID, body.Name, g.openSide(body.Team), time.Now(), body.join())
 	h.games[newGameID] = g
-	writeJSON(rw, g)
+	writeJSON(rw, g.playerView(body.PlayerID))
+}
+
+// pairable reports whether the matchmaker may seat new players
+// in g when they ask for a game with these settings.
+func (g *Game) pairable(version, layout string, c BoardConstraints, sideSize int, clock Clock) bool {
+	return len(g.players) > 0 && g.Mode != ModeClassic && !g.Private && g.Outcome == "" &&
+		g.WordListVersion == version && g.layout().Name == layout &&
+		g.constraints() == c && g.sideSize() == sideSize && g.Clock.orZero() == clock
 }
 
 // POST /guess
@@ -288,13 +556,12 @@ func (h *handler) handleGuess(rw http.ResponseWriter, req *http.Request) {
 		Seed      Seed   `json:"seed"`
 		PlayerID  string `json:"player_id"`
 		Name      string `json:"name"`
-		Team      int    `json:"team"`
 		Index     int    `json:"index"`
 		Rationale string `json:"rationale"`
 	}
 
 	err := json.NewDecoder(req.Body).Decode(&body)
-	if err != nil || body.GameID == "" || body.Team == 0 || body.PlayerID == "" {
+	if err != nil || body.GameID == "" || body.PlayerID == "" {
 		writeError(rw, "malformed_body", "Unable to parse request body.", 400)
 		return
 	}
@@ -309,14 +576,40 @@ func (h *handler) handleGuess(rw http.ResponseWriter, req *http.Request) {
 
 	g.mu.Lock()
 	defer g.mu.Unlock()
+	defer h.saveIfOver(g)
 	if body.Seed != g.Seed {
 		writeError(rw, "bad_seed", "Request intended for a different game seed.", 400)
 		return
 	}
+	if body.Rationale, ok = h.blocklist.Screen(body.Rationale); !ok {
+		writeError(rw, "blocked_word", "Please reword your rationale.", 400)
+		return
+	}
 
-	g.markSeen(body.PlayerID, body.Name, body.Team, time.Now())
-	g.guess(body.PlayerID, body.Name, body.Team, body.Index, body.Rationale, time.Now())
-	if body.Team == 2 {
+	if g.Mode == ModeClassic {
+		if err := g.classicGuess(body.PlayerID, body.Name, body.Index, body.Rationale, time.Now()); err != nil {
+			writeClassicError(rw, err)
+			return
+		}
+		writeJSON(rw, map[string]string{"status": "ok"})
+		return
+	}
+	if g.spectating(body.PlayerID) {
+		writeError(rw, "spectator", "Spectators can't guess.", 403)
+		return
+	}
+	team, ok := g.seatOf(rw, body.PlayerID)
+	if !ok {
+		return
+	}
+	if body.Index < 0 || body.Index >= len(g.Words) {
+		writeError(rw, "bad_index", "There's no card there.", 400)
+		return
+	}
+
+	g.markSeen(body.PlayerID, body.Name, team, time.Now())
+	g.guess(body.PlayerID, body.Name, team, body.Index, body.Rationale, time.Now())
+	if team == 2 {
 		if g.OneSeenWords == nil {
 			g.OneSeenWords = make(map[string]bool)
 		}
@@ -337,11 +630,10 @@ func (h *handler) handleEndTurn(rw http.ResponseWriter, req *http.Request) {
 		Seed     Seed   `json:"seed"`
 		PlayerID string `json:"player_id"`
 		Name     string `json:"name"`
-		Team     int    `json:"team"`
 	}
 
 	err := json.NewDecoder(req.Body).Decode(&body)
-	if err != nil || body.GameID == "" || body.Team == 0 || body.PlayerID == "" {
+	if err != nil || body.GameID == "" || body.PlayerID == "" {
 		writeError(rw, "malformed_body", "Unable to parse request body.", 400)
 		return
 	}
@@ -356,21 +648,52 @@ func (h *handler) handleEndTurn(rw http.ResponseWriter, req *http.Request) {
 
 	g.mu.Lock()
 	defer g.mu.Unlock()
+	defer h.saveIfOver(g)
 	if body.Seed != g.Seed {
 		writeError(rw, "bad_seed", "Request intended for a different game seed.", 400)
 		return
 	}
 
-	g.markSeen(body.PlayerID, body.Name, body.Team, time.Now())
+	if g.Mode == ModeClassic {
+		if err := g.classicEndTurn(body.PlayerID, body.Name, time.Now()); err != nil {
+			writeClassicError(rw, err)
+			return
+		}
+		writeJSON(rw, map[string]string{"status": "ok"})
+		return
+	}
+	if g.spectating(body.PlayerID) {
+		writeError(rw, "spectator", "Spectators can't end a turn.", 403)
+		return
+	}
+	team, ok := g.seatOf(rw, body.PlayerID)
+	if !ok {
+		return
+	}
+
+	g.markSeen(body.PlayerID, body.Name, team, time.Now())
 	g.addEvent(Event{
 		Type:     "end_turn",
-		Team:     body.Team,
+		Team:     team,
 		PlayerID: body.PlayerID,
 		Name:     body.Name,
 	})
 	writeJSON(rw, map[string]string{"status": "ok"})
 }
 
+// seatOf returns the side playerID holds in g, writing a 403 if
+// they hold none, as overflow players and outsiders don't. Moves
+// are made for that side whatever the request says. g.mu must
+// be held.
+func (g *Game) seatOf(rw http.ResponseWriter, playerID string) (int, bool) {
+	p, ok := g.players[playerID]
+	if !ok || p.Team == 0 {
+		writeError(rw, "not_seated", "Only players seated on a side can do that.", 403)
+		return 0, false
+	}
+	return p.Team, true
+}
+
 // POST /chat
 func (h *handler) handleChat(rw http.ResponseWriter, req *http.Request) {
 	var body struct {
@@ -378,13 +701,12 @@ func (h *handler) handleChat(rw http.ResponseWriter, req *http.Request) {
 		Seed     Seed     `json:"seed"`
 		PlayerID string   `json:"player_id"`
 		Name     string   `json:"name"`
-		Team     int      `json:"team"`
 		Message  []string `json:"message"`
 	}
 
 	err := json.NewDecoder(req.Body).Decode(&body)
 
-	if err != nil || body.GameID == "" || body.Team == 0 || body.PlayerID == "" {
+	if err != nil || body.GameID == "" || body.PlayerID == "" {
 		writeError(rw, "not_found", "Game not found", 404)
 		return
 	}
@@ -396,12 +718,26 @@ func (h *handler) handleChat(rw http.ResponseWriter, req *http.Request) {
 		writeError(rw, "not_found", "Game not found", 404)
 		return
 	}
+	if g.Mode == ModeClassic {
+		writeError(rw, "wrong_mode", "Classic games take clues at /clue.", 400)
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.spectating(body.PlayerID) {
+		writeError(rw, "spectator", "Spectators can't give clues.", 403)
+		return
+	}
+	team, ok := g.seatOf(rw, body.PlayerID)
+	if !ok {
+		return
+	}
 
 	if len(body.Message) < 2 || len(strings.Fields(body.Message[0])) != 1 || (strings.TrimSpace(body.Message[1]) == "" && strings.TrimSpace(body.Message[2]) == "" && strings.TrimSpace(body.Message[3]) == "" && strings.TrimSpace(body.Message[4]) == "" && strings.TrimSpace(body.Message[5]) == "") {
-		g.markSeen(body.PlayerID, body.Name, body.Team, time.Now())
+		g.markSeen(body.PlayerID, body.Name, team, time.Now())
 		g.addEvent(Event{
 			Type:         "chat_error",
-			Team:         body.Team,
+			Team:         team,
 			PlayerID:     body.PlayerID,
 			Name:         body.Name,
 			ErrorMessage: "Please enter only ONE CLUE WORD in the \"Clue\" box and AT LEAST ONE corresponding TARGET WORD from the board in a \"Target\" box!",
@@ -411,15 +747,16 @@ func (h *handler) handleChat(rw http.ResponseWriter, req *http.Request) {
 	}
 
 	countMap := map[string]int{}
-	for _, elem := range body.Message[1:5] {
-		if strings.TrimSpace(elem) == "" {
+	for i := 1; i <= 5 && i < len(body.Message); i++ {
+		elem := normalizeWord(body.Message[i])
+		if elem == "" {
 			continue
 		}
 		if countMap[elem] == 1 {
-			g.markSeen(body.PlayerID, body.Name, body.Team, time.Now())
+			g.markSeen(body.PlayerID, body.Name, team, time.Now())
 			g.addEvent(Event{
 				Type:         "chat_error",
-				Team:         body.Team,
+				Team:         team,
 				PlayerID:     body.PlayerID,
 				Name:         body.Name,
 				ErrorMessage: "Each word in the TARGET must be unique! Pick your better rationale and send that :)",
@@ -430,22 +767,38 @@ func (h *handler) handleChat(rw http.ResponseWriter, req *http.Request) {
 		countMap[elem] += 1
 	}
 
-	g.mu.Lock()
-	defer g.mu.Unlock()
 	if body.Seed != g.Seed {
 		writeError(rw, "bad_seed", "Request intended for a different game seed.", 400)
 		return
 	}
 
+	// In a rematch that swapped the first clue, the other side goes first.
+	if g.FirstClue != 0 && team != g.FirstClue && g.firstClueSide() == 0 {
+		side := "A"
+		if g.FirstClue == 2 {
+			side = "B"
+		}
+		g.markSeen(body.PlayerID, body.Name, team, time.Now())
+		g.addEvent(Event{
+			Type:         "chat_error",
+			Team:         team,
+			PlayerID:     body.PlayerID,
+			Name:         body.Name,
+			ErrorMessage: "In this game, side " + side + " gives the FIRST CLUE! Please wait for their hint.",
+		})
+		writeJSON(rw, map[string]string{"status": "ok"})
+		return
+	}
+
 	for index, element := range body.Message {
 		if index >= 1 && index <= 5 && strings.TrimSpace(element) != "" {
-			if body.Team == 1 {
+			if team == 1 {
 				_, ok = g.OneSeenWords[strings.ToLower(strings.TrimSpace(element))]
 				if ok {
-					g.markSeen(body.PlayerID, body.Name, body.Team, time.Now())
+					g.markSeen(body.PlayerID, body.Name, team, time.Now())
 					g.addEvent(Event{
 						Type:         "chat_error",
-						Team:         body.Team,
+						Team:         team,
 						PlayerID:     body.PlayerID,
 						Name:         body.Name,
 						ErrorMessage: "An input target word in a \"Target\" box should NOT already have been GUESSED by the other team!",
@@ -456,10 +809,10 @@ func (h *handler) handleChat(rw http.ResponseWriter, req *http.Request) {
 			} else {
 				_, ok = g.TwoSeenWords[strings.ToLower(strings.TrimSpace(element))]
 				if ok {
-					g.markSeen(body.PlayerID, body.Name, body.Team, time.Now())
+					g.markSeen(body.PlayerID, body.Name, team, time.Now())
 					g.addEvent(Event{
 						Type:         "chat_error",
-						Team:         body.Team,
+						Team:         team,
 						PlayerID:     body.PlayerID,
 						Name:         body.Name,
 						ErrorMessage: "An input target word in a \"Target\" box should NOT already have been GUESSED by the other team!",
@@ -474,7 +827,7 @@ func (h *handler) handleChat(rw http.ResponseWriter, req *http.Request) {
 			for idx, board_word := range g.Words {
 				if strings.ToLower(board_word) == strings.ToLower(strings.TrimSpace(element)) {
 					found = true
-					if body.Team == 1 {
+					if team == 1 {
 						if g.OneLayout[idx] == Green {
 							is_green_word = true
 							_, ok = g.TwoSeenWords[strings.ToLower(strings.TrimSpace(element))]
@@ -495,10 +848,10 @@ func (h *handler) handleChat(rw http.ResponseWriter, req *http.Request) {
 				}
 			}
 			if !found {
-				g.markSeen(body.PlayerID, body.Name, body.Team, time.Now())
+				g.markSeen(body.PlayerID, body.Name, team, time.Now())
 				g.addEvent(Event{
 					Type:         "chat_error",
-					Team:         body.Team,
+					Team:         team,
 					PlayerID:     body.PlayerID,
 					Name:         body.Name,
 					ErrorMessage: "Every input target word in a \"Target\" box has to match one of the GREEN words ON THE BOARD that have NOT already been GUESSED by the other team!",
@@ -507,10 +860,10 @@ func (h *handler) handleChat(rw http.ResponseWriter, req *http.Request) {
 				return
 			}
 			if !is_green_word {
-				g.markSeen(body.PlayerID, body.Name, body.Team, time.Now())
+				g.markSeen(body.PlayerID, body.Name, team, time.Now())
 				g.addEvent(Event{
 					Type:         "chat_error",
-					Team:         body.Team,
+					Team:         team,
 					PlayerID:     body.PlayerID,
 					Name:         body.Name,
 					ErrorMessage: "Every input target word in a \"Target\" box has to match one of the GREEN words ON THE BOARD that have NOT already been GUESSED by the other team!",
@@ -519,10 +872,10 @@ func (h *handler) handleChat(rw http.ResponseWriter, req *http.Request) {
 				return
 			}
 			if both_green_but_guessed_by_you {
-				g.markSeen(body.PlayerID, body.Name, body.Team, time.Now())
+				g.markSeen(body.PlayerID, body.Name, team, time.Now())
 				g.addEvent(Event{
 					Type:         "chat_error",
-					Team:         body.Team,
+					Team:         team,
 					PlayerID:     body.PlayerID,
 					Name:         body.Name,
 					ErrorMessage: "An input target word in a \"Target\" box should NOT already have been GUESSED!",
@@ -531,10 +884,10 @@ func (h *handler) handleChat(rw http.ResponseWriter, req *http.Request) {
 				return
 			}
 			if strings.TrimSpace(body.Message[index+5]) == "" {
-				g.markSeen(body.PlayerID, body.Name, body.Team, time.Now())
+				g.markSeen(body.PlayerID, body.Name, team, time.Now())
 				g.addEvent(Event{
 					Type:         "chat_error",
-					Team:         body.Team,
+					Team:         team,
 					PlayerID:     body.PlayerID,
 					Name:         body.Name,
 					ErrorMessage: "Please provide a rationale of AT LEAST THREE (3) WORDS in the \"Rationale\" box adjacent to every target word that you enter!",
@@ -544,10 +897,10 @@ func (h *handler) handleChat(rw http.ResponseWriter, req *http.Request) {
 			}
 
 			if len(strings.Fields(strings.TrimSpace(body.Message[index+5]))) < 3 {
-				g.markSeen(body.PlayerID, body.Name, body.Team, time.Now())
+				g.markSeen(body.PlayerID, body.Name, team, time.Now())
 				g.addEvent(Event{
 					Type:         "chat_error",
-					Team:         body.Team,
+					Team:         team,
 					PlayerID:     body.PlayerID,
 					Name:         body.Name,
 					ErrorMessage: "Please enter AT LEAST THREE (3) WORDS for your rationale in the \"Rationale\" box adjacent to every target word that you enter!",
@@ -565,10 +918,10 @@ func (h *handler) handleChat(rw http.ResponseWriter, req *http.Request) {
 				}
 			}
 			if num_words < 3 {
-				g.markSeen(body.PlayerID, body.Name, body.Team, time.Now())
+				g.markSeen(body.PlayerID, body.Name, team, time.Now())
 				g.addEvent(Event{
 					Type:         "chat_error",
-					Team:         body.Team,
+					Team:         team,
 					PlayerID:     body.PlayerID,
 					Name:         body.Name,
 					ErrorMessage: "Please enter AT LEAST THREE (3) WORDS for your rationale in the \"Rationale\" box adjacent to every target word that you enter!",
@@ -580,10 +933,10 @@ func (h *handler) handleChat(rw http.ResponseWriter, req *http.Request) {
 	}
 	for _, board_word := range g.Words {
 		if strings.ToLower(board_word) == strings.ToLower(strings.TrimSpace(body.Message[0])) {
-			g.markSeen(body.PlayerID, body.Name, body.Team, time.Now())
+			g.markSeen(body.PlayerID, body.Name, team, time.Now())
 			g.addEvent(Event{
 				Type:         "chat_error",
-				Team:         body.Team,
+				Team:         team,
 				PlayerID:     body.PlayerID,
 				Name:         body.Name,
 				ErrorMessage: "The input clue word should NOT match any of the words on the board",
@@ -592,13 +945,39 @@ func (h *handler) handleChat(rw http.ResponseWriter, req *http.Request) {
 			return
 		}
 	}
+	if len(h.blocklist.Blocked(body.Message[0])) > 0 {
+		g.markSeen(body.PlayerID, body.Name, team, time.Now())
+		g.addEvent(Event{
+			Type:         "chat_error",
+			Team:         team,
+			PlayerID:     body.PlayerID,
+			Name:         body.Name,
+			ErrorMessage: "That clue word isn't allowed. Please choose a different clue!",
+		})
+		writeJSON(rw, map[string]string{"status": "ok"})
+		return
+	}
+	for index := 6; index < len(body.Message); index++ {
+		if body.Message[index], ok = h.blocklist.Screen(body.Message[index]); !ok {
+			g.markSeen(body.PlayerID, body.Name, team, time.Now())
+			g.addEvent(Event{
+				Type:         "chat_error",
+				Team:         team,
+				PlayerID:     body.PlayerID,
+				Name:         body.Name,
+				ErrorMessage: "A rationale uses a word that isn't allowed. Please reword it!",
+			})
+			writeJSON(rw, map[string]string{"status": "ok"})
+			return
+		}
+	}
 	numtargets := 0
 	for index, element := range body.Message {
 		if index >= 1 && index <= 5 && strings.TrimSpace(element) != "" {
 			numtargets = numtargets + 1
 		}
 	}
-	g.markSeen(body.PlayerID, body.Name, body.Team, time.Now())
+	g.markSeen(body.PlayerID, body.Name, team, time.Now())
 	// OMAR: MAKE COPIES HERE!!!
 	oneSeenList := make([]string, 0, len(g.OneSeenWords))
 	for k, _ := range g.OneSeenWords {
@@ -612,7 +991,7 @@ func (h *handler) handleChat(rw http.ResponseWriter, req *http.Request) {
 
 	g.addEvent(Event{
 		Type:             "chat",
-		Team:             body.Team,
+		Team:             team,
 		PlayerID:         body.PlayerID,
 		Name:             body.Name,
 		Message:          body.Message,
@@ -652,6 +1031,7 @@ func (h *handler) handleEvents(rw http.ResponseWriter, req *http.Request) {
 	seed := g.Seed
 	if body.Seed != seed {
 		evts, _ := g.eventsSince(body.LastEvent)
+		evts = g.eventsFor(body.PlayerID, evts)
 		g.mu.Unlock()
 		writeJSON(rw, GameUpdate{Seed: seed, Events: evts})
 		return
@@ -659,6 +1039,7 @@ func (h *handler) handleEvents(rw http.ResponseWriter, req *http.Request) {
 	g.markSeen(body.PlayerID, body.Name, body.Team, time.Now())
 
 	evts, ch := g.eventsSince(body.LastEvent)
+	evts = g.eventsFor(body.PlayerID, evts)
 
 	// Release the mutex.
 	// We reacquire it when we reretrieve the game.
@@ -684,6 +1065,7 @@ func (h *handler) handleEvents(rw http.ResponseWriter, req *http.Request) {
 		}
 		g.mu.Lock()
 		evts, _ = g.eventsSince(body.LastEvent)
+		evts = g.eventsFor(body.PlayerID, evts)
 		seed = g.Seed
 		g.mu.Unlock()
 
@@ -0,0 +1,191 @@
+package gameapi
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// HistoryGame is one of a player's games, as their history shows it.
+type HistoryGame struct {
+	GameID    string    `json:"game_id"`
+	CreatedAt time.Time `json:"created_at"`
+	Mode      string    `json:"mode,omitempty"`
+	Team      int       `json:"team"`
+	Partners  []Partner `json:"partners"`
+	Outcome   string    `json:"outcome,omitempty"`
+
+	// The player's own clues, and how well their partners
+	// guessed them. Classic games leave these out.
+	Clues       int     `json:"clues"`
+	Guesses     int     `json:"guesses"`
+	TargetHits  int     `json:"target_hits"`
+	Accuracy    float64 `json:"accuracy"`
+	AvgClueSize float64 `json:"avg_clue_size"`
+}
+
+// Partner is someone else who played in a game.
+type Partner struct {
+	PlayerID string `json:"player_id"`
+	Name     string `json:"name"`
+	Team     int    `json:"team"`
+}
+
+// PlayerStats rolls up a player's history.
+type PlayerStats struct {
+	Games       int            `json:"games"`
+	Outcomes    map[string]int `json:"outcomes"`
+	Clues       int            `json:"clues"`
+	Accuracy    float64        `json:"accuracy"`
+	AvgClueSize float64        `json:"avg_clue_size"`
+}
+
+// historyFor describes g from a player's side, if they joined it.
+func (g *Game) historyFor(playerID string) (HistoryGame, bool) {
+	hg := HistoryGame{GameID: g.GameID, CreatedAt: g.CreatedAt, Mode: g.Mode, Partners: []Partner{}}
+
+	// The join events say who played, even after they've left.
+	joined := false
+	partners := map[string]int{}
+	for _, e := range g.Events {
+		if e.Type != "join_side" || e.PlayerID == "" {
+			continue
+		}
+		if e.PlayerID == playerID {
+			joined = true
+			hg.Team = e.Team
+			continue
+		}
+		i, ok := partners[e.PlayerID]
+		if !ok {
+			i = len(hg.Partners)
+			partners[e.PlayerID] = i
+			hg.Partners = append(hg.Partners, Partner{PlayerID: e.PlayerID})
+		}
+		hg.Partners[i].Name = e.Name
+		hg.Partners[i].Team = e.Team
+	}
+	if !joined {
+		return hg, false
+	}
+
+	if g.Mode == ModeClassic {
+		if w := g.classicState().Winner; w != 0 && w == hg.Team {
+			hg.Outcome = OutcomeWon
+		} else if w != 0 {
+			hg.Outcome = OutcomeLost
+		}
+		return hg, true
+	}
+
+	m := g.Metrics()
+	hg.Outcome = m.Outcome
+	for _, c := range m.Clues {
+		if c.PlayerID != playerID {
+			continue
+		}
+		hg.Clues++
+		hg.Guesses += c.Guesses
+		hg.TargetHits += c.TargetHits
+		hg.AvgClueSize += float64(c.IntendedTargets)
+	}
+	if hg.Clues > 0 {
+		hg.AvgClueSize /= float64(hg.Clues)
+	}
+	if hg.Guesses > 0 {
+		hg.Accuracy = float64(hg.TargetHits) / float64(hg.Guesses)
+	}
+	return hg, true
+}
+
+// playerStats rolls up a player's games.
+func playerStats(games []HistoryGame) PlayerStats {
+	s := PlayerStats{Games: len(games), Outcomes: map[string]int{}}
+	var guesses, hits int
+	for _, hg := range games {
+		if hg.Outcome != "" {
+			s.Outcomes[hg.Outcome]++
+		}
+		s.Clues += hg.Clues
+		s.AvgClueSize += hg.AvgClueSize * float64(hg.Clues)
+		guesses += hg.Guesses
+		hits += hg.TargetHits
+	}
+	if s.Clues > 0 {
+		s.AvgClueSize /= float64(s.Clues)
+	}
+	if guesses > 0 {
+		s.Accuracy = float64(hits) / float64(guesses)
+	}
+	return s
+}
+
+// POST /history
+// list a player's past games, with their partners, outcomes and clue statistics
+// Only the player, with a session token for one of their seats,
+// or an admin may read a history.
+func (h *handler) handleHistory(rw http.ResponseWriter, req *http.Request) {
+	var body struct {
+		PlayerID string `json:"player_id"`
+		Session  string `json:"session,omitempty"`
+		Token    string `json:"token,omitempty"`
+	}
+	err := json.NewDecoder(req.Body).Decode(&body)
+	if err != nil || body.PlayerID == "" {
+		writeError(rw, "malformed_body", "Unable to parse request body.", 400)
+		return
+	}
+
+	// Games still in memory may not have been saved yet,
+	// so look through them as well as the store.
+	h.mu.Lock()
+	if ref, ok := h.sessions[body.Session]; (!ok || ref.PlayerID != body.PlayerID) && !h.isAdmin(body.Token) {
+		h.mu.Unlock()
+		writeError(rw, "forbidden", "That needs the player's session or an admin token.", 403)
+		return
+	}
+	live := make([]*Game, 0, len(h.games))
+	for _, g := range h.games {
+		live = append(live, g)
+	}
+	h.mu.Unlock()
+
+	games := []HistoryGame{}
+	seen := map[string]bool{}
+	for _, g := range live {
+		g.mu.Lock()
+		hg, ok := g.historyFor(body.PlayerID)
+		g.mu.Unlock()
+		seen[g.GameID] = true
+		if ok {
+			games = append(games, hg)
+		}
+	}
+	for _, id := range h.store.gamesOf(body.PlayerID) {
+		if seen[id] {
+			continue
+		}
+		g, err := h.store.load(id)
+		if err != nil {
+			log.Printf("history of %s: skipping game %s: %s", hashPlayerID(body.PlayerID), id, err)
+			continue
+		}
+		if hg, ok := g.historyFor(body.PlayerID); ok {
+			games = append(games, hg)
+		}
+	}
+	sort.Slice(games, func(i, j int) bool {
+		if !games[i].CreatedAt.Equal(games[j].CreatedAt) {
+			return games[i].CreatedAt.Before(games[j].CreatedAt)
+		}
+		return games[i].GameID < games[j].GameID
+	})
+
+	writeJSON(rw, struct {
+		PlayerID string        `json:"player_id"`
+		Games    []HistoryGame `json:"games"`
+		Stats    PlayerStats   `json:"stats"`
+	}{body.PlayerID, games, playerStats(games)})
+}
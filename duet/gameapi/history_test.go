@@ -0,0 +1,98 @@
+package gameapi
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+	dir := t.TempDir()
+	words := map[string][]string{"test": numberedWords(40)}
+	hh, err := Handler(words, Config{GameDir: dir, AdminToken: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := hh.(*handler)
+
+	var game struct {
+		GameID string `json:"game_id"`
+	}
+	post(t, h, "/new-game", `{"player_id": "a", "name": "Ann"}`, &game)
+	post(t, h, "/new-game", `{"player_id": "b", "name": "Bo"}`, nil)
+	g := h.games[game.GameID]
+	target := indexOf(g.OneLayout, Green)
+	g.addEvent(Event{Type: "chat", Team: 1, PlayerID: "a", Message: []string{"clue", g.Words[target]}, Num_target_words: 1})
+	g.addEvent(Event{Type: "guess", Team: 2, PlayerID: "b", Index: target})
+	h.saveGames()
+
+	// A new server finds the game in the store.
+	hh, err = Handler(words, Config{GameDir: dir, AdminToken: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp struct {
+		Games []HistoryGame `json:"games"`
+		Stats PlayerStats   `json:"stats"`
+	}
+	if status := post(t, hh.(*handler), "/history", `{"player_id": "a"}`, nil); status != 403 {
+		t.Errorf("Expected a history to need a session or the admin token, got %d", status)
+	}
+	post(t, hh.(*handler), "/history", `{"player_id": "a", "token": "secret"}`, &resp)
+	if len(resp.Games) != 1 {
+		t.Fatalf("Expected one game in a's history, got %+v", resp.Games)
+	}
+	hg := resp.Games[0]
+	if hg.GameID != game.GameID || hg.Team != 1 || len(hg.Partners) != 1 || hg.Partners[0] != (Partner{"b", "Bo", 2}) {
+		t.Errorf("Unexpected game %+v", hg)
+	}
+	if hg.Clues != 1 || hg.Guesses != 1 || hg.Accuracy != 1 || hg.AvgClueSize != 1 {
+		t.Errorf("Unexpected clue statistics %+v", hg)
+	}
+	if resp.Stats.Games != 1 || resp.Stats.Clues != 1 || resp.Stats.Accuracy != 1 {
+		t.Errorf("Unexpected stats %+v", resp.Stats)
+	}
+
+	session := hh.(*handler).sessionFor("elsewhere", "b")
+	if status := post(t, hh.(*handler), "/history", `{"player_id": "a", "session": "`+session+`"}`, nil); status != 403 {
+		t.Errorf("Expected b's session not to open a's history, got %d", status)
+	}
+	post(t, hh.(*handler), "/history", `{"player_id": "b", "session": "`+session+`"}`, &resp)
+	if len(resp.Games) != 1 || resp.Games[0].Clues != 0 || resp.Games[0].Partners[0].PlayerID != "a" {
+		t.Errorf("Unexpected history for b %+v", resp.Games)
+	}
+
+	// A stored game that can't be read is left out.
+	if err := ioutil.WriteFile(filepath.Join(dir, game.GameID+".json"), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if status := post(t, hh.(*handler), "/history", `{"player_id": "b", "session": "`+session+`"}`, &resp); status != 200 || len(resp.Games) != 0 {
+		t.Errorf("Expected an empty history, got %d with %+v", status, resp.Games)
+	}
+}
+
+func TestFinishedGamesAreSaved(t *testing.T) {
+	dir := t.TempDir()
+	h := newTestHandler(t, Config{GameDir: dir})
+	var game struct {
+		GameID string `json:"game_id"`
+		State  struct {
+			Seed string `json:"seed"`
+		} `json:"state"`
+	}
+	post(t, h, "/new-game", `{"player_id": "a", "name": "a"}`, &game)
+	post(t, h, "/new-game", `{"player_id": "b", "name": "b"}`, nil)
+	g := h.games[game.GameID]
+	g.addEvent(Event{Type: "chat", Team: 2, PlayerID: "b", Message: []string{"clue", "target"}})
+
+	black := indexOf(g.TwoLayout, Black)
+	post(t, h, "/guess", `{"game_id": "`+game.GameID+`", "seed": "`+game.State.Seed+`", "player_id": "a", "index": `+strconv.Itoa(black)+`}`, nil)
+	sg, err := readStoredGame(filepath.Join(dir, game.GameID+".json"))
+	if err != nil {
+		t.Fatalf("Expected the game to be saved as it ended: %v", err)
+	}
+	if n := len(sg.State.Events); n != len(g.Events) {
+		t.Errorf("Expected all %d events saved, got %d", len(g.Events), n)
+	}
+}
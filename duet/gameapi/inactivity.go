@@ -0,0 +1,136 @@
+package gameapi
+
+import (
+	"sort"
+	"time"
+)
+
+// InactivityPolicy says when a silent player forfeits a Duet game,
+// and what happens to the players they leave behind.
+type InactivityPolicy struct {
+	// After is how long a seated player can go without a request
+	// while their partner keeps playing. Zero turns the policy off.
+	After time.Duration
+
+	// Requeue seats the players left behind in another game
+	// straight away. Otherwise they are only freed to ask the
+	// matchmaker for a new game themselves.
+	Requeue bool
+}
+
+// inactivePlayer returns a seated player who hasn't been seen
+// since the cutoff in a Duet game that is still being played by
+// someone else.
+func (g *Game) inactivePlayer(cutoff time.Time) (string, bool) {
+	if g.Mode == ModeClassic || g.Outcome != "" {
+		return "", false
+	}
+	var inactive []string
+	var sides [3]int
+	active := false
+	for id, p := range g.players {
+		if p.Team != 1 && p.Team != 2 {
+			continue
+		}
+		sides[p.Team]++
+		if p.LastSeen.Before(cutoff) {
+			inactive = append(inactive, id)
+		} else {
+			active = true
+		}
+	}
+	if len(inactive) == 0 || !active || sides[1] == 0 || sides[2] == 0 {
+		return "", false
+	}
+	if g.duetState().Outcome != "" {
+		return "", false
+	}
+	sort.Strings(inactive)
+	return inactive[0], true
+}
+
+// abandon ends g, blaming the inactive player, and frees everyone
+// else. The partial game stays in h.games. The caller holds h.mu
+// and g.mu.
+func (h *handler) abandon(g *Game, inactiveID string, now time.Time) error {
+	p := g.players[inactiveID]
+	g.Outcome = OutcomeAbandoned
+	g.addEvent(Event{
+		Type:     "abandoned",
+		PlayerID: inactiveID,
+		Name:     p.Name,
+		Team:     p.Team,
+	})
+	delete(g.players, inactiveID)
+
+	ids := make([]string, 0, len(g.players))
+	for id, p := range g.players {
+		if p.Team != 0 {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		// Excluded players wait for a review rather than
+		// being paired again.
+		if !h.inactivity.Requeue || h.excluded(id) {
+			delete(g.players, id)
+			continue
+		}
+		if err := h.requeue(g, id, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// requeue moves a player from g into a game the matchmaker would
+// have given them, or a new one with the same settings. The caller
+// holds h.mu and g.mu.
+func (h *handler) requeue(g *Game, playerID string, now time.Time) error {
+	p := g.players[playerID]
+	j := g.joinDetails(playerID)
+
+	var next *Game
+	team := 0
+	for _, o := range h.games {
+		if o == g {
+			continue
+		}
+		o.mu.Lock()
+		if o.pairable(g.WordListVersion, g.layout().Name, g.constraints(), g.sideSize(), g.Clock.orZero()) {
+			if team = o.openSide(0); team != 0 {
+				next = o
+				break
+			}
+		}
+		o.mu.Unlock()
+	}
+	if next == nil {
+		state, err := h.followOn(g)
+		if err != nil {
+			return err
+		}
+		state.Private = false
+		next, err = ReconstructGame(state, randomString(8))
+		if err != nil {
+			return err
+		}
+		next.CreatedAt = now
+		h.games[next.GameID] = next
+		team = 1
+		next.mu.Lock()
+	}
+	next.markSeenWithUser(playerID, p.Name, team, now, j)
+	next.mu.Unlock()
+
+	delete(g.players, playerID)
+	g.addEvent(Event{
+		Type:     "requeued",
+		PlayerID: playerID,
+		Name:     p.Name,
+		Team:     p.Team,
+		Message:  []string{next.GameID},
+	})
+	return nil
+}
@@ -0,0 +1,102 @@
+package gameapi
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAbandonInactivePartner(t *testing.T) {
+	h := newTestHandler(t, Config{
+		Inactivity: InactivityPolicy{After: time.Minute, Requeue: true},
+	})
+	var game struct {
+		GameID string `json:"game_id"`
+	}
+	post(t, h, "/new-game", `{"player_id": "a", "name": "a"}`, &game)
+	post(t, h, "/new-game", `{"player_id": "b", "name": "b"}`, nil)
+	g := h.games[game.GameID]
+
+	now := time.Now()
+	h.checkGames(now)
+	if g.Outcome != "" {
+		t.Fatal("Expected a game with two active players to carry on")
+	}
+	a := g.players["a"]
+	a.LastSeen = now.Add(-2 * time.Minute)
+	g.players["a"] = a
+	h.checkGames(now)
+
+	if g.Outcome != OutcomeAbandoned || len(g.players) != 0 {
+		t.Fatalf("Expected the game to be abandoned and emptied, got %q with %v", g.Outcome, g.players)
+	}
+	var abandoned, requeued Event
+	for _, e := range g.Events {
+		switch e.Type {
+		case "abandoned":
+			abandoned = e
+		case "requeued":
+			requeued = e
+		}
+	}
+	if abandoned.PlayerID != "a" || abandoned.Team != 1 {
+		t.Errorf("Expected a to be blamed, got %+v", abandoned)
+	}
+	next := h.games[requeued.Message[0]]
+	if requeued.PlayerID != "b" || next == nil || next.players["b"].Team != 1 {
+		t.Fatalf("Expected b to be seated in a new game, got %+v", requeued)
+	}
+
+	var matched struct {
+		GameID string `json:"game_id"`
+	}
+	post(t, h, "/new-game", `{"player_id": "c", "name": "c"}`, &matched)
+	if matched.GameID != next.GameID {
+		t.Errorf("Expected c to be paired with b in %s, got %s", next.GameID, matched.GameID)
+	}
+	// Clients still polling the abandoned game aren't seated in it
+	// again, and a new game for a doesn't send them back to it.
+	g.markSeen("a", "a", 1, now)
+	g.markSeen("b", "b", 1, now)
+	if len(g.players) != 0 {
+		t.Errorf("Expected the abandoned game to stay empty, got %v", g.players)
+	}
+	g.players["a"] = Player{Team: 1, Name: "a", LastSeen: now}
+	var fresh struct {
+		GameID string `json:"game_id"`
+	}
+	post(t, h, "/new-game", `{"player_id": "a", "name": "a"}`, &fresh)
+	if fresh.GameID == g.GameID {
+		t.Error("Expected a new game for a, not the abandoned one")
+	}
+}
+
+func TestExcludedPlayersArentRequeued(t *testing.T) {
+	h := newTestHandler(t, Config{
+		Inactivity: InactivityPolicy{After: time.Minute, Requeue: true},
+	})
+	var game struct {
+		GameID string `json:"game_id"`
+	}
+	post(t, h, "/new-game", `{"player_id": "a", "name": "a"}`, &game)
+	post(t, h, "/new-game", `{"player_id": "b", "name": "b"}`, nil)
+	g := h.games[game.GameID]
+	h.participants["b"] = &Participant{PlayerID: "b", Status: StatusExcluded}
+
+	now := time.Now()
+	a := g.players["a"]
+	a.LastSeen = now.Add(-2 * time.Minute)
+	g.players["a"] = a
+	h.checkGames(now)
+
+	if g.Outcome != OutcomeAbandoned || len(g.players) != 0 {
+		t.Fatalf("Expected the game to be abandoned and emptied, got %q with %v", g.Outcome, g.players)
+	}
+	for _, e := range g.Events {
+		if e.Type == "requeued" {
+			t.Errorf("Expected the excluded player not to be requeued, got %+v", e)
+		}
+	}
+	if len(h.games) != 1 {
+		t.Errorf("Expected no new game for the excluded player, got %d games", len(h.games))
+	}
+}
@@ -0,0 +1,145 @@
+package gameapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// Layout is a key card definition. It describes the board's
+// dimensions and, for every cell, the color it has on side one's
+// key and on side two's key. Layouts are plain data so studies can
+// add alternative keys and board sizes without code changes, and a
+// game's GameState carries a full copy of the layout it was created
+// with so later edits to a definition never change old boards.
+type Layout struct {
+	Name string     `json:"name"`
+	Rows int        `json:"rows"`
+	Cols int        `json:"cols"`
+	Key  []KeyGroup `json:"key"`
+}
+
+// KeyGroup is a run of Count cells sharing the same pair of colors.
+// The order of groups matters: ReconstructGame permutes cells in
+// the order they're listed.
+type KeyGroup struct {
+	One   Color `json:"one"`
+	Two   Color `json:"two"`
+	Count int   `json:"count"`
+}
+
+// DuetLayout is the key from the Codenames Duet rule book, and the
+// layout of every game stored before layouts were configurable.
+var DuetLayout = Layout{
+	Name: "duet",
+	Rows: 5,
+	Cols: 5,
+	Key: []KeyGroup{
+		{Black, Green, 1},
+		{Tan, Green, 5},
+		{Green, Green, 3},
+		{Green, Tan, 5},
+		{Green, Black, 1},
+		{Tan, Black, 1},
+		{Black, Black, 1},
+		{Tan, Tan, 7},
+		{Black, Tan, 1},
+	},
+}
+
+// Size returns the number of cells on the board.
+func (l Layout) Size() int {
+	n := 0
+	for _, g := range l.Key {
+		n += g.Count
+	}
+	return n
+}
+
+// cells expands the key into one color pair per cell.
+func (l Layout) cells() [][2]Color {
+	cells := make([][2]Color, 0, l.Size())
+	for _, g := range l.Key {
+		for i := 0; i < g.Count; i++ {
+			cells = append(cells, [2]Color{g.One, g.Two})
+		}
+	}
+	return cells
+}
+
+// Greens returns how many cells are green on side one's key
+// and on side two's key.
+func (l Layout) Greens() (one, two int) {
+	for _, g := range l.Key {
+		if g.One == Green {
+			one += g.Count
+		}
+		if g.Two == Green {
+			two += g.Count
+		}
+	}
+	return one, two
+}
+
+// Validate checks that the layout describes a playable board.
+func (l Layout) Validate() error {
+	if l.Rows <= 0 || l.Cols <= 0 {
+		return fmt.Errorf("layout %q: rows and cols must be positive", l.Name)
+	}
+	for i, g := range l.Key {
+		if g.Count <= 0 {
+			return fmt.Errorf("layout %q: key group %d has a count of %d", l.Name, i, g.Count)
+		}
+		if !g.One.valid() || !g.Two.valid() {
+			return fmt.Errorf("layout %q: key group %d has an unknown color", l.Name, i)
+		}
+	}
+	if size := l.Size(); size != l.Rows*l.Cols {
+		return fmt.Errorf("layout %q: key has %d cells but the board is %dx%d", l.Name, size, l.Rows, l.Cols)
+	}
+	if one, two := l.Greens(); one == 0 || two == 0 {
+		return fmt.Errorf("layout %q: each side needs at least one green", l.Name)
+	}
+	return nil
+}
+
+// layout returns the layout the game was created with.
+func (gs *GameState) layout() Layout {
+	if gs.Layout == nil {
+		return DuetLayout
+	}
+	return *gs.Layout
+}
+
+// DefaultLayouts loads the layout definitions in layouts/*.json
+// alongside the built-in Duet layout. A file's name is used as
+// the layout's name when the definition doesn't have one.
+func DefaultLayouts() (map[string]Layout, error) {
+	matches, err := filepath.Glob("layouts/*.json")
+	if err != nil {
+		return nil, err
+	}
+
+	layouts := map[string]Layout{DuetLayout.Name: DuetLayout}
+	for _, m := range matches {
+		b, err := ioutil.ReadFile(m)
+		if err != nil {
+			return nil, err
+		}
+		var l Layout
+		if err := json.Unmarshal(b, &l); err != nil {
+			return nil, fmt.Errorf("%s: %w", m, err)
+		}
+		if l.Name == "" {
+			base := filepath.Base(m)
+			l.Name = strings.TrimSuffix(base, filepath.Ext(base))
+		}
+		if err := l.Validate(); err != nil {
+			return nil, err
+		}
+		layouts[l.Name] = l
+	}
+	return layouts, nil
+}
@@ -0,0 +1,96 @@
+package gameapi
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestDuetLayoutCells pins the expansion of DuetLayout to the
+// hardcoded key it replaced, which stored games depend on.
+func TestDuetLayoutCells(t *testing.T) {
+	expected := [][2]Color{
+		{Black, Green},
+		{Tan, Green}, {Tan, Green}, {Tan, Green}, {Tan, Green}, {Tan, Green},
+		{Green, Green}, {Green, Green}, {Green, Green},
+		{Green, Tan}, {Green, Tan}, {Green, Tan}, {Green, Tan}, {Green, Tan},
+		{Green, Black},
+		{Tan, Black},
+		{Black, Black},
+		{Tan, Tan}, {Tan, Tan}, {Tan, Tan}, {Tan, Tan}, {Tan, Tan}, {Tan, Tan}, {Tan, Tan},
+		{Black, Tan},
+	}
+	if cells := DuetLayout.cells(); !reflect.DeepEqual(cells, expected) {
+		t.Errorf("Expected DuetLayout to expand to %v, got %v", expected, cells)
+	}
+	if err := DuetLayout.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLayoutDefinitions(t *testing.T) {
+	matches, err := filepath.Glob("../layouts/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range matches {
+		b, err := ioutil.ReadFile(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var l Layout
+		if err := json.Unmarshal(b, &l); err != nil {
+			t.Errorf("%s: %s", m, err)
+			continue
+		}
+		if err := l.Validate(); err != nil {
+			t.Errorf("%s: %s", m, err)
+			continue
+		}
+
+		state := NewState(42, numberedWords(l.Size()+10))
+		state.Layout = &l
+		g, err := ReconstructGame(state, "test")
+		if err != nil {
+			t.Errorf("%s: %s", m, err)
+			continue
+		}
+		if len(g.Words) != l.Size() || len(g.OneLayout) != l.Size() || len(g.TwoLayout) != l.Size() {
+			t.Errorf("%s: expected a board of %d cells, got %d words", m, l.Size(), len(g.Words))
+		}
+		one, two := l.Greens()
+		if n := countColor(g.OneLayout, Green); n != one {
+			t.Errorf("%s: expected %d greens on side one, got %d", m, one, n)
+		}
+		if n := countColor(g.TwoLayout, Green); n != two {
+			t.Errorf("%s: expected %d greens on side two, got %d", m, two, n)
+		}
+	}
+}
+
+func TestLayoutValidate(t *testing.T) {
+	var testCases = []Layout{
+		{Name: "empty"},
+		{Name: "wrong-size", Rows: 2, Cols: 2, Key: []KeyGroup{{Green, Green, 3}}},
+		{Name: "zero-count", Rows: 1, Cols: 1, Key: []KeyGroup{{Green, Green, 1}, {Tan, Tan, 0}}},
+		{Name: "bad-color", Rows: 1, Cols: 2, Key: []KeyGroup{{Green, Green, 1}, {Color(7), Tan, 1}}},
+		{Name: "no-green", Rows: 1, Cols: 2, Key: []KeyGroup{{Green, Tan, 2}}},
+	}
+	for _, l := range testCases {
+		if err := l.Validate(); err == nil {
+			t.Errorf("Expected layout %q to be invalid", l.Name)
+		}
+	}
+}
+
+func countColor(layout []Color, c Color) int {
+	n := 0
+	for _, x := range layout {
+		if x == c {
+			n++
+		}
+	}
+	return n
+}
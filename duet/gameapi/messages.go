@@ -0,0 +1,199 @@
+package gameapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// defaultMaxMessage is the longest free-text message, in
+// characters, when the config doesn't say.
+const defaultMaxMessage = 280
+
+// Game phases in which free-text messages may be allowed.
+const (
+	PhasePregame  = "pregame"  // before the first clue
+	PhasePlaying  = "playing"  // from the first clue until the game ends
+	PhasePostgame = "postgame" // once the game is over
+)
+
+// MessagePolicy limits the free-text channel partners can use
+// next to their structured clues.
+type MessagePolicy struct {
+	// MaxLength is the longest message in characters.
+	// Zero means 280.
+	MaxLength int
+
+	// Phases lists when messages are allowed. Empty means always.
+	Phases []string
+}
+
+// allows reports whether messages may be sent in a phase.
+func (p MessagePolicy) allows(phase string) bool {
+	if len(p.Phases) == 0 {
+		return true
+	}
+	for _, ph := range p.Phases {
+		if ph == phase {
+			return true
+		}
+	}
+	return false
+}
+
+// phase returns where the game is for the message policy.
+func (g *Game) phase() string {
+	switch {
+	case g.Outcome != "" || g.duetState().Outcome != "":
+		return PhasePostgame
+	case g.firstClueSide() == 0:
+		return PhasePregame
+	}
+	return PhasePlaying
+}
+
+// POST /message
+// send a free-text message to a partner, apart from the structured clues
+func (h *handler) handleMessage(rw http.ResponseWriter, req *http.Request) {
+	var body struct {
+		GameID   string `json:"game_id"`
+		Seed     Seed   `json:"seed"`
+		PlayerID string `json:"player_id"`
+		Name     string `json:"name"`
+		Text     string `json:"text"`
+	}
+	err := json.NewDecoder(req.Body).Decode(&body)
+	body.Text = strings.TrimSpace(body.Text)
+	if err != nil || body.GameID == "" || body.PlayerID == "" || body.Text == "" {
+		writeError(rw, "malformed_body", "Unable to parse request body.", 400)
+		return
+	}
+	if utf8.RuneCountInString(body.Text) > h.messages.MaxLength {
+		writeError(rw, "too_long",
+			fmt.Sprintf("Please keep messages under %d characters.", h.messages.MaxLength), 400)
+		return
+	}
+	text, ok := h.blocklist.Screen(body.Text)
+	if !ok {
+		writeError(rw, "blocked_word", "Please reword your message.", 400)
+		return
+	}
+	body.Text = text
+
+	h.mu.Lock()
+	g, ok := h.games[body.GameID]
+	h.mu.Unlock()
+	if !ok {
+		writeError(rw, "not_found", "Game not found", 404)
+		return
+	}
+	if g.Mode == ModeClassic {
+		writeError(rw, "wrong_mode", "Classic games don't have partner messages.", 400)
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if body.Seed != g.Seed {
+		writeError(rw, "bad_seed", "Request intended for a different game seed.", 400)
+		return
+	}
+	team, ok := g.seatOf(rw, body.PlayerID)
+	if !ok {
+		return
+	}
+	phase := g.phase()
+	if !h.messages.allows(phase) {
+		writeError(rw, "messages_closed", "Messages can't be sent at this point in the game.", 403)
+		return
+	}
+
+	g.markSeen(body.PlayerID, body.Name, team, time.Now())
+	g.addEvent(Event{
+		Type:     "message",
+		Team:     team,
+		PlayerID: body.PlayerID,
+		Name:     body.Name,
+		Message:  []string{body.Text, phase},
+	})
+	writeJSON(rw, map[string]string{"status": "ok"})
+}
+
+// MessageRecord is one free-text message, as exported for
+// analysis apart from the clues.
+type MessageRecord struct {
+	GameID   string `json:"game_id"`
+	Number   int    `json:"number"`
+	PlayerID string `json:"player_id"`
+	Name     string `json:"name"`
+	Team     int    `json:"team"`
+	Phase    string `json:"phase"`
+	Text     string `json:"text"`
+	Time     int64  `json:"timestamp"`
+}
+
+// messageRecords returns the game's free-text messages in order,
+// with blocked words starred out.
+func (g *Game) messageRecords(b *Blocklist) []MessageRecord {
+	var out []MessageRecord
+	for _, e := range b.RedactEvents(g.Events) {
+		if e.Type != "message" || len(e.Message) < 2 {
+			continue
+		}
+		out = append(out, MessageRecord{
+			GameID:   g.GameID,
+			Number:   e.Number,
+			PlayerID: e.PlayerID,
+			Name:     e.Name,
+			Team:     e.Team,
+			Phase:    e.Message[1],
+			Text:     e.Message[0],
+			Time:     e.Time,
+		})
+	}
+	return out
+}
+
+// POST /export-messages
+// export the free-text messages of one game, or every game
+func (h *handler) handleExportMessages(rw http.ResponseWriter, req *http.Request) {
+	var body struct {
+		Token  string `json:"token"`
+		GameID string `json:"game_id,omitempty"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeError(rw, "malformed_body", "Unable to parse request body.", 400)
+		return
+	}
+	if !h.checkAdmin(rw, body.Token) {
+		return
+	}
+
+	h.mu.Lock()
+	games := make([]*Game, 0, len(h.games))
+	for id, g := range h.games {
+		if body.GameID == "" || body.GameID == id {
+			games = append(games, g)
+		}
+	}
+	h.mu.Unlock()
+	if body.GameID != "" && len(games) == 0 {
+		writeError(rw, "not_found", "Game not found", 404)
+		return
+	}
+	sort.Slice(games, func(i, j int) bool { return games[i].GameID < games[j].GameID })
+
+	records := []MessageRecord{}
+	for _, g := range games {
+		g.mu.Lock()
+		records = append(records, g.messageRecords(h.blocklist)...)
+		g.mu.Unlock()
+	}
+	writeJSON(rw, struct {
+		Messages []MessageRecord `json:"messages"`
+	}{records})
+}
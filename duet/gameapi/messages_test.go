@@ -0,0 +1,62 @@
+package gameapi
+
+import "testing"
+
+func TestMessages(t *testing.T) {
+	h := newTestHandler(t, Config{
+		AdminToken: "secret",
+		Messages:   MessagePolicy{MaxLength: 10, Phases: []string{PhasePregame, PhasePostgame}},
+	})
+
+	var game struct {
+		GameID string `json:"game_id"`
+		State  struct {
+			Seed string `json:"seed"`
+		} `json:"state"`
+	}
+	post(t, h, "/new-game", `{"player_id": "a", "name": "a"}`, &game)
+	post(t, h, "/new-game", `{"player_id": "b", "name": "b"}`, nil)
+	// a is on side 1 but claims side 2; the message counts for
+	// the seat a holds, and a stays on it.
+	send := func(text string) int {
+		return post(t, h, "/message", `{"game_id": "`+game.GameID+`", "seed": "`+game.State.Seed+`",
+			"player_id": "a", "name": "a", "team": 2, "text": "`+text+`"}`, nil)
+	}
+
+	if status := send("hi there"); status != 200 {
+		t.Fatalf("Expected a message before the first clue, got %d", status)
+	}
+	if g := h.games[game.GameID]; g.players["a"].Team != 1 || g.Events[len(g.Events)-1].Team != 1 {
+		t.Errorf("Expected the message from side 1 with a still on it, got %+v", g.Events[len(g.Events)-1])
+	}
+	if status := send("far too long for this"); status != 400 {
+		t.Errorf("Expected a long message to be turned away, got %d", status)
+	}
+
+	g := h.games[game.GameID]
+	g.addEvent(Event{Type: "chat", Team: 1, Message: []string{"clue", "w1"}})
+	if status := send("psst"); status != 403 {
+		t.Errorf("Expected no messages during play, got %d", status)
+	}
+	g.Outcome = OutcomeWon
+	if status := send("good game"); status != 200 {
+		t.Errorf("Expected a message after the game, got %d", status)
+	}
+
+	var export struct {
+		Messages []MessageRecord `json:"messages"`
+	}
+	if status := post(t, h, "/export-messages", `{}`, nil); status != 403 {
+		t.Errorf("Expected the export to need the admin token, got %d", status)
+	}
+	post(t, h, "/export-messages", `{"token": "secret", "game_id": "`+game.GameID+`"}`, &export)
+	if len(export.Messages) != 2 {
+		t.Fatalf("Expected 2 messages, got %+v", export.Messages)
+	}
+	if m := export.Messages[0]; m.Text != "hi there" || m.Phase != PhasePregame || m.PlayerID != "a" {
+		t.Errorf("Unexpected first message %+v", m)
+	}
+	if m := export.Messages[1]; m.Text != "good game" || m.Phase != PhasePostgame {
+		t.Errorf("Unexpected second message %+v", m)
+	}
+}
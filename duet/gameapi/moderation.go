@@ -0,0 +1,334 @@
+package gameapi
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultReportThreshold is how many reports keep a player out of
+// matchmaking until an admin reviews them, when the config doesn't say.
+const defaultReportThreshold = 3
+
+// maxReportText is the longest free text a report may carry.
+const maxReportText = 1000
+
+// Report categories.
+var reportCategories = map[string]bool{
+	"offensive_clue":  true,
+	"random_guessing": true,
+	"inactive":        true,
+	"cheating":        true,
+	"other":           true,
+}
+
+// Participant statuses.
+const (
+	StatusOK       = "ok"
+	StatusFlagged  = "flagged"  // reported, still matched
+	StatusExcluded = "excluded" // kept out of matchmaking
+	StatusCleared  = "cleared"  // reviewed and allowed to play
+)
+
+// Report is one player's complaint about another.
+type Report struct {
+	GameID     string    `json:"game_id"`
+	Event      int       `json:"event"`
+	ReporterID string    `json:"reporter_id"`
+	Category   string    `json:"category"`
+	Text       string    `json:"text"`
+	Time       time.Time `json:"time"`
+}
+
+// Participant is what the registry knows about a player who
+// has been reported.
+type Participant struct {
+	PlayerID string   `json:"player_id"`
+	Name     string   `json:"name"`
+	Status   string   `json:"status"`
+	Reports  []Report `json:"reports"`
+	Reviewed int      `json:"reviewed"` // reports an admin has already seen
+}
+
+// pending returns the reports no admin has seen yet.
+func (p *Participant) pending() []Report {
+	return p.Reports[p.Reviewed:]
+}
+
+// pendingReporters counts the players behind the pending reports,
+// so one player reporting again and again only counts once.
+// Reports scrubbed of a withdrawn reporter count on their own.
+func (p *Participant) pendingReporters() int {
+	n := 0
+	seen := map[string]bool{}
+	for _, r := range p.pending() {
+		if r.ReporterID == "" || !seen[r.ReporterID] {
+			seen[r.ReporterID] = true
+			n++
+		}
+	}
+	return n
+}
+
+// participant returns the registry entry for a player, making
+// one if needed. The caller holds h.mu.
+func (h *handler) participant(playerID string) *Participant {
+	p, ok := h.participants[playerID]
+	if !ok {
+		p = &Participant{PlayerID: playerID, Status: StatusOK}
+		h.participants[playerID] = p
+	}
+	return p
+}
+
+// excluded reports whether the matchmaker must turn a player
+// away. The caller holds h.mu.
+func (h *handler) excluded(playerID string) bool {
+	p, ok := h.participants[playerID]
+	return ok && p.Status == StatusExcluded
+}
+
+// record adds a report to the registry, flagging the player, and
+// excluding them once enough players have reported them since
+// their last review. The caller holds h.mu.
+func (h *handler) record(reportedID, name string, r Report) {
+	p := h.participant(reportedID)
+	if name != "" {
+		p.Name = name
+	}
+	p.Reports = append(p.Reports, r)
+	switch {
+	case p.Status == StatusExcluded:
+	case p.pendingReporters() >= h.reportThreshold:
+		p.Status = StatusExcluded
+	default:
+		p.Status = StatusFlagged
+	}
+	if err := h.saveParticipants(); err != nil {
+		log.Printf("saving the report registry: %s", err)
+	}
+}
+
+// participantsFile is where the registry is kept under GameDir,
+// apart from the games the store indexes.
+var participantsFile = filepath.Join("moderation", "participants.json")
+
+// loadParticipants reads the registry an earlier run saved in
+// dir, so exclusions and pending reports survive a restart.
+func loadParticipants(dir string) (map[string]*Participant, error) {
+	participants := make(map[string]*Participant)
+	if dir == "" {
+		return participants, nil
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, participantsFile))
+	if os.IsNotExist(err) {
+		return participants, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &participants); err != nil {
+		return nil, fmt.Errorf("%s: %v", participantsFile, err)
+	}
+	return participants, nil
+}
+
+// saveParticipants writes the registry out, if games are saved.
+// The caller holds h.mu.
+func (h *handler) saveParticipants() error {
+	if h.store.dir == "" {
+		return nil
+	}
+	b, err := json.Marshal(h.participants)
+	if err != nil {
+		return err
+	}
+	name := filepath.Join(h.store.dir, participantsFile)
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(name+".tmp", b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(name+".tmp", name)
+}
+
+// isAdmin reports whether token is the admin token. Without a
+// configured token, admin actions are turned off.
+func (h *handler) isAdmin(token string) bool {
+	return h.adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(h.adminToken)) == 1
+}
+
+// checkAdmin reports whether a request carries the admin token,
+// writing a 403 if it doesn't.
+func (h *handler) checkAdmin(rw http.ResponseWriter, token string) bool {
+	if !h.isAdmin(token) {
+		writeError(rw, "forbidden", "That needs an admin token.", 403)
+		return false
+	}
+	return true
+}
+
+// POST /report
+// report a partner for offensive clues, random guessing and the like
+func (h *handler) handleReport(rw http.ResponseWriter, req *http.Request) {
+	var body struct {
+		GameID     string `json:"game_id"`
+		Seed       Seed   `json:"seed"`
+		PlayerID   string `json:"player_id"`
+		Name       string `json:"name"`
+		ReportedID string `json:"reported_id"`
+		Category   string `json:"category"`
+		Text       string `json:"text"`
+	}
+	err := json.NewDecoder(req.Body).Decode(&body)
+	if err != nil || body.GameID == "" || body.PlayerID == "" {
+		writeError(rw, "malformed_body", "Unable to parse request body.", 400)
+		return
+	}
+	body.Text = strings.TrimSpace(body.Text)
+	if !reportCategories[body.Category] {
+		writeError(rw, "bad_category", "Pick offensive_clue, random_guessing, inactive, cheating or other.", 400)
+		return
+	}
+	if len(body.Text) > maxReportText {
+		writeError(rw, "too_long", "Please keep reports under 1000 characters.", 400)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	g, ok := h.games[body.GameID]
+	if !ok {
+		writeError(rw, "not_found", "Game not found", 404)
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if body.Seed != g.Seed {
+		writeError(rw, "bad_seed", "Request intended for a different game seed.", 400)
+		return
+	}
+	team, ok := g.seatOf(rw, body.PlayerID)
+	if !ok {
+		return
+	}
+
+	// Without a name, the report is about the other side,
+	// if only one player is on it.
+	if body.ReportedID == "" {
+		others := g.sideMembers(otherTeam(team))
+		if len(others) != 1 {
+			writeError(rw, "malformed_body", "Say which player the report is about.", 400)
+			return
+		}
+		body.ReportedID = others[0]
+	}
+	reported, ok := g.players[body.ReportedID]
+	if !ok || body.ReportedID == body.PlayerID {
+		writeError(rw, "not_found", "That player isn't in this game.", 404)
+		return
+	}
+
+	now := time.Now()
+	g.markSeen(body.PlayerID, body.Name, team, now)
+	g.addEvent(Event{
+		Type:       "report",
+		Team:       team,
+		PlayerID:   body.PlayerID,
+		Name:       body.Name,
+		Message:    []string{body.Category, body.Text},
+		ReportedID: body.ReportedID,
+	})
+	h.record(body.ReportedID, reported.Name, Report{
+		GameID:     g.GameID,
+		Event:      len(g.Events),
+		ReporterID: body.PlayerID,
+		Category:   body.Category,
+		Text:       body.Text,
+		Time:       now,
+	})
+	writeJSON(rw, map[string]string{"status": "ok"})
+}
+
+// POST /review-queue
+// list reported players with reports no admin has seen, most reported first
+func (h *handler) handleReviewQueue(rw http.ResponseWriter, req *http.Request) {
+	var body struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeError(rw, "malformed_body", "Unable to parse request body.", 400)
+		return
+	}
+	if !h.checkAdmin(rw, body.Token) {
+		return
+	}
+
+	h.mu.Lock()
+	queue := []Participant{}
+	for _, p := range h.participants {
+		if len(p.pending()) > 0 {
+			queue = append(queue, *p)
+		}
+	}
+	h.mu.Unlock()
+	sort.Slice(queue, func(i, j int) bool {
+		if len(queue[i].pending()) != len(queue[j].pending()) {
+			return len(queue[i].pending()) > len(queue[j].pending())
+		}
+		return queue[i].PlayerID < queue[j].PlayerID
+	})
+	writeJSON(rw, struct {
+		Queue []Participant `json:"queue"`
+	}{queue})
+}
+
+// POST /review
+// clear a reported player, or keep them out of matchmaking
+func (h *handler) handleReview(rw http.ResponseWriter, req *http.Request) {
+	var body struct {
+		Token    string `json:"token"`
+		PlayerID string `json:"player_id"`
+		Decision string `json:"decision"` // "clear" or "exclude"
+	}
+	err := json.NewDecoder(req.Body).Decode(&body)
+	if err != nil || body.PlayerID == "" {
+		writeError(rw, "malformed_body", "Unable to parse request body.", 400)
+		return
+	}
+	if !h.checkAdmin(rw, body.Token) {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	p, ok := h.participants[body.PlayerID]
+	if !ok {
+		writeError(rw, "not_found", "No one has reported that player.", 404)
+		return
+	}
+	switch body.Decision {
+	case "clear":
+		p.Status = StatusCleared
+	case "exclude":
+		p.Status = StatusExcluded
+	default:
+		writeError(rw, "bad_decision", "The decision must be clear or exclude.", 400)
+		return
+	}
+	p.Reviewed = len(p.Reports)
+	if err := h.saveParticipants(); err != nil {
+		writeError(rw, "internal_error", err.Error(), 500)
+		return
+	}
+	writeJSON(rw, p)
+}
@@ -0,0 +1,89 @@
+package gameapi
+
+import "testing"
+
+func TestReports(t *testing.T) {
+	h := newTestHandler(t, Config{ReportThreshold: 2, AdminToken: "secret"})
+
+	// pair plays a game between a and b, in which a reports b.
+	pair := func(a string) {
+		var game struct {
+			GameID string `json:"game_id"`
+			State  struct {
+				Seed string `json:"seed"`
+			} `json:"state"`
+		}
+		post(t, h, "/new-game", `{"player_id": "`+a+`", "name": "`+a+`"}`, &game)
+		post(t, h, "/new-game", `{"player_id": "b", "name": "b"}`, nil)
+		status := post(t, h, "/report", `{"game_id": "`+game.GameID+`", "seed": "`+game.State.Seed+`", "player_id": "`+a+`",
+			"team": 2, "category": "offensive_clue", "text": "rude"}`, nil)
+		if status != 200 {
+			t.Fatalf("Expected the report to be taken, got %d", status)
+		}
+		// The report counts for the side a holds, not the one claimed.
+		if g := h.games[game.GameID]; g.players[a].Team != 1 || g.Events[len(g.Events)-1].Team != 1 {
+			t.Errorf("Expected a report from side 1 with %s still on it, got %+v", a, g.Events[len(g.Events)-1])
+		}
+		var seen struct {
+			State struct {
+				Events []Event `json:"events"`
+			} `json:"state"`
+		}
+		post(t, h, "/game", `{"game_id": "`+game.GameID+`", "player_id": "b"}`, &seen)
+		if evts := seen.State.Events; evts[len(evts)-1].Type == "report" {
+			t.Error("Expected the reported player not to see the report")
+		}
+		g := h.games[game.GameID]
+		g.Outcome = OutcomeWon // free both players for the next pairing
+		g.players = map[string]Player{}
+	}
+
+	pair("a1")
+	if p := h.participants["b"]; p.Status != StatusFlagged || len(p.Reports) != 1 || p.Reports[0].ReporterID != "a1" {
+		t.Fatalf("Expected b to be flagged, got %+v", p)
+	}
+	// Reporting the same player again doesn't add to the count.
+	pair("a1")
+	if p := h.participants["b"]; p.Status != StatusFlagged || len(p.Reports) != 2 {
+		t.Fatalf("Expected b to stay flagged, got %+v", p)
+	}
+	pair("a2")
+	if status := post(t, h, "/new-game", `{"player_id": "b"}`, nil); status != 403 {
+		t.Errorf("Expected b to be kept out of matchmaking, got %d", status)
+	}
+
+	if status := post(t, h, "/review-queue", `{"token": "wrong"}`, nil); status != 403 {
+		t.Errorf("Expected the queue to need the admin token, got %d", status)
+	}
+	var queue struct {
+		Queue []Participant `json:"queue"`
+	}
+	post(t, h, "/review-queue", `{"token": "secret"}`, &queue)
+	if len(queue.Queue) != 1 || queue.Queue[0].PlayerID != "b" || len(queue.Queue[0].Reports) != 3 {
+		t.Fatalf("Expected b in the queue with three reports, got %+v", queue.Queue)
+	}
+	post(t, h, "/review", `{"token": "secret", "player_id": "b", "decision": "clear"}`, nil)
+	if status := post(t, h, "/new-game", `{"player_id": "b"}`, nil); status != 200 {
+		t.Errorf("Expected a cleared player to be matched again, got %d", status)
+	}
+	post(t, h, "/review-queue", `{"token": "secret"}`, &queue)
+	if len(queue.Queue) != 0 {
+		t.Errorf("Expected the queue to be empty after review, got %+v", queue.Queue)
+	}
+}
+
+func TestReportsOutliveRestarts(t *testing.T) {
+	dir := t.TempDir()
+	h := newTestHandler(t, Config{GameDir: dir, ReportThreshold: 1})
+	h.mu.Lock()
+	h.record("b", "b", Report{GameID: "g", ReporterID: "a", Category: "cheating"})
+	h.mu.Unlock()
+
+	h = newTestHandler(t, Config{GameDir: dir, ReportThreshold: 1})
+	if p := h.participants["b"]; p == nil || p.Status != StatusExcluded || len(p.Reports) != 1 {
+		t.Fatalf("Expected b's exclusion to be loaded, got %+v", p)
+	}
+	if status := post(t, h, "/new-game", `{"player_id": "b"}`, nil); status != 403 {
+		t.Errorf("Expected b to stay out of matchmaking after a restart, got %d", status)
+	}
+}
@@ -0,0 +1,212 @@
+package gameapi
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// Pairing groups clues by the backgrounds of the player who gave
+// them and the players who guessed them.
+type Pairing struct {
+	Country string `json:"country"` // "same", "different", or "unknown"
+	Giver   string `json:"giver"`   // "native", "non_native", "bot" or "unknown"
+	Guesser string `json:"guesser"` // "native", "non_native", "bot", "mixed" or "unknown"
+}
+
+// Interval is an estimate with its 95% confidence interval.
+type Interval struct {
+	Estimate float64 `json:"estimate"`
+	Low      float64 `json:"low"`
+	High     float64 `json:"high"`
+}
+
+// PairStats sums up the clues given across one pairing, and the
+// games they were given in. A game counts once towards each
+// pairing one of its clues fell in.
+type PairStats struct {
+	Pairing
+	Games      int         `json:"games"`
+	Wins       int         `json:"wins"`
+	WinRate    Interval    `json:"win_rate"`
+	Clues      int         `json:"clues"`
+	Guesses    int         `json:"guesses"`
+	TargetHits int         `json:"target_hits"`
+	Accuracy   Interval    `json:"accuracy"`   // share of guesses that hit an intended target
+	ClueSizes  map[int]int `json:"clue_sizes"` // clues by number of intended targets
+	ClueSize   Interval    `json:"clue_size"`  // mean intended targets per clue
+}
+
+// finished reports whether a game was played to the end, rather
+// than abandoned or still going.
+func finished(outcome string) bool {
+	return outcome == OutcomeWon || outcome == OutcomeLost || outcome == OutcomeTimeout
+}
+
+// demographics returns the last join event of each player in g.
+func (gs *GameState) demographics() map[string]Event {
+	joins := map[string]Event{}
+	for _, e := range gs.Events {
+		if e.Type == "join_side" && e.PlayerID != "" {
+			joins[e.PlayerID] = e
+		}
+	}
+	return joins
+}
+
+// nativeLabel says whether a player joining is a native speaker.
+// A join with no answers at all, because the player skipped the
+// questions or withdrew, is "unknown" rather than "non_native",
+// and a bot is "bot".
+func nativeLabel(j Event) string {
+	switch {
+	case j.Role == RoleBot:
+		return "bot"
+	case j.UserNativeSpeaker:
+		return "native"
+	case j.UserAge == "" && j.UserGender == "" && j.UserCountry == "":
+		return "unknown"
+	}
+	return "non_native"
+}
+
+// countryKey folds the free text players give as their country,
+// so "Canada" and " canada" count as one country.
+func countryKey(country string) string {
+	return strings.ToLower(strings.TrimSpace(country))
+}
+
+// pairing returns the pairing of a clue's giver with the players
+// on the other side.
+func pairing(joins map[string]Event, giverID string, team int) Pairing {
+	giver := joins[giverID]
+	p := Pairing{Country: "unknown", Giver: nativeLabel(giver)}
+	countries := map[string]bool{}
+	labels := map[string]bool{}
+	for _, j := range joins {
+		if j.Team != otherTeam(team) {
+			continue
+		}
+		labels[nativeLabel(j)] = true
+		countries[countryKey(j.UserCountry)] = true
+	}
+	// One guesser of unknown background makes the side unknown.
+	switch {
+	case len(labels) == 0 || labels["unknown"]:
+		p.Guesser = "unknown"
+	case len(labels) > 1:
+		p.Guesser = "mixed"
+	default:
+		for label := range labels {
+			p.Guesser = label
+		}
+	}
+	giverCountry := countryKey(giver.UserCountry)
+	if giverCountry == "" || countries[""] || len(countries) == 0 {
+		return p
+	}
+	p.Country = "same"
+	for c := range countries {
+		if c != giverCountry {
+			p.Country = "different"
+		}
+	}
+	return p
+}
+
+// PairAnalytics groups the clues of finished Duet games by the
+// pairing of giver and guessers.
+func PairAnalytics(games []*Game) []PairStats {
+	groups := map[Pairing]*PairStats{}
+	sizes := map[Pairing][]float64{}
+	for _, g := range games {
+		if g.Mode == ModeClassic {
+			continue
+		}
+		m := g.Metrics()
+		if !finished(m.Outcome) {
+			continue
+		}
+		joins := g.demographics()
+		counted := map[Pairing]bool{}
+		for _, c := range m.Clues {
+			p := pairing(joins, c.PlayerID, c.Team)
+			s := groups[p]
+			if s == nil {
+				s = &PairStats{Pairing: p, ClueSizes: map[int]int{}}
+				groups[p] = s
+			}
+			if !counted[p] {
+				counted[p] = true
+				s.Games++
+				if m.Outcome == OutcomeWon {
+					s.Wins++
+				}
+			}
+			s.Clues++
+			s.Guesses += c.Guesses
+			s.TargetHits += c.TargetHits
+			s.ClueSizes[c.IntendedTargets]++
+			sizes[p] = append(sizes[p], float64(c.IntendedTargets))
+		}
+	}
+
+	out := make([]PairStats, 0, len(groups))
+	for p, s := range groups {
+		s.WinRate = wilson(s.Wins, s.Games)
+		s.Accuracy = wilson(s.TargetHits, s.Guesses)
+		s.ClueSize = meanInterval(sizes[p])
+		out = append(out, *s)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i].Pairing, out[j].Pairing
+		if a.Country != b.Country {
+			return a.Country < b.Country
+		}
+		if a.Giver != b.Giver {
+			return a.Giver < b.Giver
+		}
+		return a.Guesser < b.Guesser
+	})
+	return out
+}
+
+// z95 is the normal quantile for a two-sided 95% interval.
+const z95 = 1.959964
+
+// wilson returns the proportion k/n with its Wilson score interval,
+// which stays sensible for the small groups a study may have.
+func wilson(k, n int) Interval {
+	if n == 0 {
+		return Interval{}
+	}
+	p := float64(k) / float64(n)
+	nf := float64(n)
+	denom := 1 + z95*z95/nf
+	center := (p + z95*z95/(2*nf)) / denom
+	half := z95 * math.Sqrt(p*(1-p)/nf+z95*z95/(4*nf*nf)) / denom
+	return Interval{Estimate: p, Low: math.Max(0, center-half), High: math.Min(1, center+half)}
+}
+
+// meanInterval returns the mean of xs with a normal-approximation
+// interval.
+func meanInterval(xs []float64) Interval {
+	if len(xs) == 0 {
+		return Interval{}
+	}
+	var sum float64
+	for _, x := range xs {
+		sum += x
+	}
+	n := float64(len(xs))
+	mean := sum / n
+	if len(xs) == 1 {
+		return Interval{mean, mean, mean}
+	}
+	var ss float64
+	for _, x := range xs {
+		ss += (x - mean) * (x - mean)
+	}
+	half := z95 * math.Sqrt(ss/(n-1)/n)
+	return Interval{mean, mean - half, mean + half}
+}
@@ -0,0 +1,81 @@
+package gameapi
+
+import (
+	"math"
+	"testing"
+)
+
+func TestWilson(t *testing.T) {
+	if got := wilson(0, 0); got != (Interval{}) {
+		t.Errorf("wilson(0, 0) = %+v", got)
+	}
+	got := wilson(5, 10)
+	if got.Estimate != 0.5 || math.Abs(got.Low-0.2366) > 1e-3 || math.Abs(got.High-0.7634) > 1e-3 {
+		t.Errorf("wilson(5, 10) = %+v", got)
+	}
+	if got := meanInterval([]float64{1, 2, 3}); got.Estimate != 2 || got.Low >= 2 || got.High <= 2 {
+		t.Errorf("meanInterval = %+v", got)
+	}
+}
+
+func TestPairAnalytics(t *testing.T) {
+	g := &Game{
+		Words:     []string{"apple", "bear", "cat", "dog"},
+		OneLayout: []Color{Green, Tan, Green, Black},
+		TwoLayout: []Color{Green, Green, Tan, Tan},
+	}
+	g.Events = []Event{
+		{Type: "join_side", PlayerID: "a", Team: 1, UserCountry: "Canada", UserNativeSpeaker: true},
+		{Type: "join_side", PlayerID: "b", Team: 2, UserCountry: "Canada"},
+		{Type: "chat", PlayerID: "a", Team: 1, Message: []string{"fruit", "apple"}, Num_target_words: 1},
+		{Type: "guess", PlayerID: "b", Team: 2, Index: 0},
+		{Type: "guess", PlayerID: "b", Team: 2, Index: 1},
+		{Type: "chat", PlayerID: "b", Team: 2, Message: []string{"animal", "bear", "apple"}, Num_target_words: 2},
+		{Type: "guess", PlayerID: "a", Team: 1, Index: 1},
+	}
+	unfinished := &Game{Words: g.Words, OneLayout: g.OneLayout, TwoLayout: g.TwoLayout, GameState: GameState{Events: g.Events[:4]}}
+	g.Outcome = OutcomeWon
+
+	stats := PairAnalytics([]*Game{g, unfinished})
+	if len(stats) != 2 {
+		t.Fatalf("Expected two pairings, got %+v", stats)
+	}
+	native := stats[0]
+	if native.Pairing != (Pairing{"same", "native", "non_native"}) || native.Games != 1 || native.Wins != 1 ||
+		native.Clues != 1 || native.Guesses != 2 || native.TargetHits != 1 || native.Accuracy.Estimate != 0.5 {
+		t.Errorf("Unexpected stats %+v", native)
+	}
+	nonNative := stats[1]
+	if nonNative.Pairing != (Pairing{"same", "non_native", "native"}) || nonNative.ClueSizes[2] != 1 || nonNative.ClueSize.Estimate != 2 {
+		t.Errorf("Unexpected stats %+v", nonNative)
+	}
+}
+
+func TestPairingWithoutAnswers(t *testing.T) {
+	joins := map[string]Event{
+		"a": {Type: "join_side", PlayerID: "a", Team: 1},
+		"b": {Type: "join_side", PlayerID: "b", Team: 2, UserCountry: "Canada"},
+		"c": {Type: "join_side", PlayerID: "c", Team: 2},
+	}
+	if p := pairing(joins, "a", 1); p != (Pairing{"unknown", "unknown", "unknown"}) {
+		t.Errorf("Expected a giver and guessers without answers to be unknown, got %+v", p)
+	}
+	delete(joins, "c")
+	if p := pairing(joins, "b", 2); p != (Pairing{"unknown", "non_native", "unknown"}) {
+		t.Errorf("Expected a guesser without answers to be unknown, got %+v", p)
+	}
+}
+
+func TestPairingFoldsCountries(t *testing.T) {
+	joins := map[string]Event{
+		"a": {Type: "join_side", PlayerID: "a", Team: 1, UserCountry: "USA", UserNativeSpeaker: true},
+		"b": {Type: "join_side", PlayerID: "b", Team: 2, UserCountry: " usa ", UserNativeSpeaker: true},
+	}
+	if p := pairing(joins, "a", 1); p.Country != "same" {
+		t.Errorf("Expected %q and %q to be the same country, got %+v", "USA", " usa ", p)
+	}
+	joins["b"] = Event{Type: "join_side", PlayerID: "b", Team: 2, UserCountry: "Canada", UserNativeSpeaker: true}
+	if p := pairing(joins, "a", 1); p.Country != "different" {
+		t.Errorf("Expected USA and Canada to be different countries, got %+v", p)
+	}
+}
@@ -0,0 +1,279 @@
+package gameapi
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// defaultDisconnectAfter is how long a seated player can go without
+// a request before they count as disconnected. Clients long-poll
+// /events for up to 25 seconds at a time, so a live client is never
+// quiet for much longer than that.
+const defaultDisconnectAfter = 40 * time.Second
+
+// reconnect marks a disconnected player as back. The caller
+// stores p in g.players.
+func (g *Game) reconnect(playerID string, p *Player) {
+	if !p.Disconnected {
+		return
+	}
+	p.Disconnected = false
+	g.addEvent(Event{
+		Type:     "player_reconnected",
+		PlayerID: playerID,
+		Name:     p.Name,
+		Team:     p.Team,
+	})
+}
+
+// checkPresence marks seated players who haven't been seen since
+// the cutoff as disconnected.
+func (g *Game) checkPresence(cutoff time.Time) {
+	ids := make([]string, 0, len(g.players))
+	for id := range g.players {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		p := g.players[id]
+		if p.Team == 0 || p.Disconnected || !p.LastSeen.Before(cutoff) {
+			continue
+		}
+		p.Disconnected = true
+		g.players[id] = p
+		g.addEvent(Event{
+			Type:     "player_disconnected",
+			PlayerID: id,
+			Name:     p.Name,
+			Team:     p.Team,
+		})
+	}
+}
+
+// watchPresence checks every game's players for heartbeat gaps,
+// applies the inactivity policy and saves changed games, until
+// ctx is done.
+func (h *handler) watchPresence(ctx context.Context, every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case now := <-t.C:
+			h.checkGames(now)
+			h.saveGames()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (h *handler) checkGames(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	inactive := map[*Game]string{}
+	for _, g := range h.games {
+		g.mu.Lock()
+		g.checkPresence(now.Add(-h.disconnectAfter))
+		g.checkClock(now)
+		if h.inactivity.After > 0 {
+			if id, ok := g.inactivePlayer(now.Add(-h.inactivity.After)); ok {
+				inactive[g] = id
+			}
+		}
+		g.mu.Unlock()
+	}
+	for g, id := range inactive {
+		g.mu.Lock()
+		if err := h.abandon(g, id, now); err != nil {
+			log.Printf("abandoning game %s: %s", g.GameID, err)
+		}
+		g.mu.Unlock()
+	}
+}
+
+// seatRef names a seat a session can resume.
+type seatRef struct {
+	GameID   string
+	PlayerID string
+}
+
+// sessionFor returns the token for a player's seat, making one
+// the first time. The caller holds h.mu.
+func (h *handler) sessionFor(gameID, playerID string) string {
+	for token, ref := range h.sessions {
+		if ref.GameID == gameID && ref.PlayerID == playerID {
+			return token
+		}
+	}
+	token := randomString(24)
+	h.sessions[token] = seatRef{GameID: gameID, PlayerID: playerID}
+	return token
+}
+
+// PlayerPresence is what one player can see of another's connection.
+type PlayerPresence struct {
+	PlayerID  string    `json:"player_id"`
+	Name      string    `json:"name"`
+	Team      int       `json:"team"`
+	Connected bool      `json:"connected"`
+	LastSeen  time.Time `json:"last_seen"`
+	IdleFor   float64   `json:"idle_seconds"`
+}
+
+func (g *Game) presence(now time.Time) []PlayerPresence {
+	ps := []PlayerPresence{}
+	for id, p := range g.players {
+		if p.Team == 0 {
+			continue
+		}
+		ps = append(ps, PlayerPresence{
+			PlayerID:  id,
+			Name:      p.Name,
+			Team:      p.Team,
+			Connected: !p.Disconnected,
+			LastSeen:  p.LastSeen,
+			IdleFor:   now.Sub(p.LastSeen).Seconds(),
+		})
+	}
+	sort.Slice(ps, func(i, j int) bool { return ps[i].PlayerID < ps[j].PlayerID })
+	return ps
+}
+
+// POST /session
+// get a token that resumes the player's seat from another tab or device
+func (h *handler) handleSession(rw http.ResponseWriter, req *http.Request) {
+	var body struct {
+		GameID   string `json:"game_id"`
+		PlayerID string `json:"player_id"`
+	}
+	err := json.NewDecoder(req.Body).Decode(&body)
+	if err != nil || body.GameID == "" || body.PlayerID == "" {
+		writeError(rw, "malformed_body", "Unable to parse request body.", 400)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	g, ok := h.games[body.GameID]
+	if !ok {
+		writeError(rw, "not_found", "Game not found", 404)
+		return
+	}
+	g.mu.Lock()
+	p, seated := g.players[body.PlayerID]
+	g.mu.Unlock()
+	if !seated || p.Team == 0 {
+		writeError(rw, "not_playing", "Only players on a side have a seat to resume.", 403)
+		return
+	}
+	writeJSON(rw, struct {
+		Session string `json:"session"`
+	}{h.sessionFor(body.GameID, body.PlayerID)})
+}
+
+// seatMovedTo returns the game a player's seat moved to,
+// if it was moved by a rematch or a requeue.
+func (gs *GameState) seatMovedTo(playerID string) string {
+	for _, e := range gs.Events {
+		if len(e.Message) > 0 && (e.Type == "rematch" || e.Type == "requeued" && e.PlayerID == playerID) {
+			return e.Message[0]
+		}
+	}
+	return ""
+}
+
+// released reports whether a player's seat was taken away from
+// them, by a move, by the game being abandoned or by them
+// withdrawing, so that their client polling the game doesn't seat
+// them in it again.
+func (gs *GameState) released(playerID string) bool {
+	if gs.scrubbed[playerID] {
+		return true
+	}
+	if gs.Outcome == OutcomeAbandoned && gs.joinEvent(playerID).Type != "" {
+		return true
+	}
+	return gs.seatMovedTo(playerID) != ""
+}
+
+// POST /resume
+// take back a seat with a session token, following it to new games
+func (h *handler) handleResume(rw http.ResponseWriter, req *http.Request) {
+	var body struct {
+		Session string `json:"session"`
+	}
+	err := json.NewDecoder(req.Body).Decode(&body)
+	if err != nil || body.Session == "" {
+		writeError(rw, "malformed_body", "Unable to parse request body.", 400)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ref, ok := h.sessions[body.Session]
+	g := h.games[ref.GameID]
+	if !ok || g == nil {
+		writeError(rw, "unknown_session", "That session has expired.", 404)
+		return
+	}
+
+	// Rematches and requeues move the seat to another game.
+	g.mu.Lock()
+	for next := h.games[g.seatMovedTo(ref.PlayerID)]; next != nil; next = h.games[g.seatMovedTo(ref.PlayerID)] {
+		g.mu.Unlock()
+		g = next
+		g.mu.Lock()
+	}
+	defer g.mu.Unlock()
+
+	p, seated := g.players[ref.PlayerID]
+	if !seated {
+		writeError(rw, "unknown_session", "That seat is no longer yours.", 404)
+		return
+	}
+	g.markSeen(ref.PlayerID, p.Name, p.Team, time.Now())
+	writeJSON(rw, struct {
+		PlayerID string      `json:"player_id"`
+		Team     int         `json:"team"`
+		Game     interface{} `json:"game"`
+	}{ref.PlayerID, p.Team, g.playerView(ref.PlayerID)})
+}
+
+// POST /presence
+// get whether the players in a game are connected
+func (h *handler) handlePresence(rw http.ResponseWriter, req *http.Request) {
+	var body struct {
+		GameID   string `json:"game_id"`
+		PlayerID string `json:"player_id"`
+	}
+	err := json.NewDecoder(req.Body).Decode(&body)
+	if err != nil || body.GameID == "" {
+		writeError(rw, "malformed_body", "Unable to parse request body.", 400)
+		return
+	}
+
+	h.mu.Lock()
+	g, ok := h.games[body.GameID]
+	h.mu.Unlock()
+	if !ok {
+		writeError(rw, "not_found", "Game not found", 404)
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := time.Now()
+	if body.PlayerID != "" {
+		if p, ok := g.players[body.PlayerID]; ok {
+			g.markSeen(body.PlayerID, p.Name, p.Team, now)
+		}
+	}
+	writeJSON(rw, struct {
+		Players []PlayerPresence `json:"players"`
+	}{g.presence(now)})
+}
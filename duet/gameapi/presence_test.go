@@ -0,0 +1,77 @@
+package gameapi
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPresence(t *testing.T) {
+	g, err := ReconstructGame(NewState(4, numberedWords(40)), "presence")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	g.markSeen("a", "a", 1, start)
+	g.markSeen("b", "b", 2, start.Add(30*time.Second))
+
+	g.checkPresence(start.Add(10 * time.Second))
+	g.checkPresence(start.Add(20 * time.Second))
+	last := g.Events[len(g.Events)-1]
+	if last.Type != "player_disconnected" || last.PlayerID != "a" || len(g.Events) != 3 {
+		t.Fatalf("Expected one disconnection for a, got %+v", g.Events)
+	}
+	if ps := g.presence(start.Add(40 * time.Second)); ps[0].Connected || !ps[1].Connected || ps[1].IdleFor != 10 {
+		t.Errorf("Expected a to be away and b idle for 10s, got %+v", ps)
+	}
+
+	g.markSeen("a", "a", 1, start.Add(45*time.Second))
+	if last := g.Events[len(g.Events)-1]; last.Type != "player_reconnected" || last.Team != 1 {
+		t.Errorf("Expected a to reconnect on side 1, got %+v", last)
+	}
+}
+
+func TestResumeSeat(t *testing.T) {
+	h := newTestHandler(t, Config{})
+	var game struct {
+		GameID string `json:"game_id"`
+	}
+	post(t, h, "/new-game", `{"player_id": "a", "name": "a"}`, &game)
+	if status := post(t, h, "/session", `{"game_id": "`+game.GameID+`", "player_id": "someone"}`, nil); status != 403 {
+		t.Errorf("Expected no session for a player without a seat, got %d", status)
+	}
+
+	var session struct {
+		Session string `json:"session"`
+	}
+	post(t, h, "/session", `{"game_id": "`+game.GameID+`", "player_id": "a"}`, &session)
+	var resumed struct {
+		PlayerID string `json:"player_id"`
+		Team     int    `json:"team"`
+		Game     struct {
+			GameID string `json:"game_id"`
+		} `json:"game"`
+	}
+	if status := post(t, h, "/resume", `{"session": "`+session.Session+`"}`, &resumed); status != 200 {
+		t.Fatalf("Expected to resume, got %d", status)
+	}
+	if resumed.PlayerID != "a" || resumed.Team != 1 || resumed.Game.GameID != game.GameID {
+		t.Errorf("Expected to resume a's seat on side 1 of %s, got %+v", game.GameID, resumed)
+	}
+}
+
+func TestWatchPresenceStops(t *testing.T) {
+	h := newTestHandler(t, Config{})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		h.watchPresence(ctx, time.Millisecond)
+		close(done)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the watcher to stop once its context was done")
+	}
+}
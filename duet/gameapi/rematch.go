@@ -0,0 +1,246 @@
+package gameapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Rematch requests are recorded as events, so who has agreed to
+// a rematch can be worked out again from a stored game.
+const (
+	rematchSwap = "swap"
+	rematchKeep = "keep"
+)
+
+// seriesID returns the ID shared by a game and its rematches.
+func (g *Game) seriesID() string {
+	if g.SeriesID == "" {
+		return g.GameID
+	}
+	return g.SeriesID
+}
+
+func (gs *GameState) round() int {
+	if gs.Round == 0 {
+		return 1
+	}
+	return gs.Round
+}
+
+// firstClueSide returns the side that gave the game's first
+// clue, or 0 if no clue has been given yet.
+func (gs *GameState) firstClueSide() int {
+	for _, e := range gs.Events {
+		if e.Type == "chat" {
+			return e.Team
+		}
+	}
+	return 0
+}
+
+// nextGameID returns the ID of the game's rematch, if it has one.
+func (gs *GameState) nextGameID() string {
+	for _, e := range gs.Events {
+		if e.Type == "rematch" && len(e.Message) > 0 {
+			return e.Message[0]
+		}
+	}
+	return ""
+}
+
+// rematchAgreed reports whether every seated player has asked
+// for the same kind of rematch. A request that differs from the
+// earlier ones replaces them, and the others have to agree again.
+func (g *Game) rematchAgreed() (agreed, swap bool) {
+	asked := map[string]bool{}
+	for _, e := range g.Events {
+		if e.Type != "rematch_request" || len(e.Message) == 0 {
+			continue
+		}
+		s := e.Message[0] == rematchSwap
+		if s != swap {
+			asked = map[string]bool{}
+			swap = s
+		}
+		asked[e.PlayerID] = true
+	}
+
+	var sides [3]int
+	for id, p := range g.players {
+		if p.Team == 0 {
+			continue
+		}
+		if !asked[id] {
+			return false, swap
+		}
+		sides[p.Team]++
+	}
+	return sides[1] > 0 && sides[2] > 0, swap
+}
+
+// joinEvent returns the event recording the player joining
+// their side, which carries what they told us about themselves.
+func (gs *GameState) joinEvent(playerID string) Event {
+	var join Event
+	for _, e := range gs.Events {
+		if e.Type == "join_side" && e.PlayerID == playerID {
+			join = e
+		}
+	}
+	return join
+}
+
+// joinDetails returns what the player gave about themselves when
+// they joined, to carry into a follow-on game.
+func (gs *GameState) joinDetails(playerID string) JoinSideEvent {
+	j := gs.joinEvent(playerID)
+	d := JoinSideEvent{Age: j.UserAge, Gender: j.UserGender, Country: j.UserCountry, NativeSpeaker: j.UserNativeSpeaker}
+	if gs.IsBot(playerID) {
+		d.Role = RoleBot
+	}
+	return d
+}
+
+// followOn returns the state for a new game with g's settings
+// and a new seed. The caller holds h.mu.
+func (h *handler) followOn(g *Game) (GameState, error) {
+	state := NewState(h.rand.Int63(), g.WordSet)
+	state.WordList = g.WordList
+	state.Layout = g.Layout
+	state.SideSize = g.SideSize
+	state.Clock = g.Clock
+	state.Private = g.Private
+	if g.Constraints != nil {
+		if err := h.constrainBoard(&state, g.Constraints.Constraints); err != nil {
+			return state, err
+		}
+	}
+	return state, nil
+}
+
+// rematch starts the next game in g's series, with a new seed
+// and the same players on the same sides. The side that gave the
+// first clue gives it again, or when swap is set, the other side
+// does. The caller holds h.mu and g.mu.
+func (h *handler) rematch(g *Game, swap bool, now time.Time) (*Game, error) {
+	state, err := h.followOn(g)
+	if err != nil {
+		return nil, err
+	}
+	state.SeriesID = g.seriesID()
+	state.Round = g.round() + 1
+	state.PrevGameID = g.GameID
+	first := g.firstClueSide()
+	if first == 0 {
+		first = g.FirstClue
+	}
+	if swap && first != 0 {
+		first = otherTeam(first)
+	}
+	state.FirstClue = first
+	next, err := ReconstructGame(state, randomString(8))
+	if err != nil {
+		return nil, err
+	}
+	next.CreatedAt = now
+
+	// Seat everyone in a stable order, and take them out of the
+	// old game so that /new-game finds them in the new one.
+	ids := make([]string, 0, len(g.players))
+	for id := range g.players {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		p := g.players[id]
+		if p.Team == 0 {
+			continue
+		}
+		next.markSeenWithUser(id, p.Name, p.Team, now, g.joinDetails(id))
+		delete(g.players, id)
+	}
+
+	h.games[next.GameID] = next
+	g.addEvent(Event{
+		Type:    "rematch",
+		Message: []string{next.GameID},
+	})
+	return next, nil
+}
+
+// POST /rematch
+func (h *handler) handleRematch(rw http.ResponseWriter, req *http.Request) {
+	var body struct {
+		GameID   string `json:"game_id"`
+		Seed     Seed   `json:"seed"`
+		PlayerID string `json:"player_id"`
+		Name     string `json:"name"`
+		Swap     bool   `json:"swap"`
+	}
+	err := json.NewDecoder(req.Body).Decode(&body)
+	if err != nil || body.GameID == "" || body.PlayerID == "" {
+		writeError(rw, "malformed_body", "Unable to parse request body.", 400)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	g, ok := h.games[body.GameID]
+	if !ok {
+		writeError(rw, "not_found", "Game not found", 404)
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if body.Seed != g.Seed {
+		writeError(rw, "bad_seed", "Request intended for a different game seed.", 400)
+		return
+	}
+	if g.Mode == ModeClassic {
+		writeError(rw, "wrong_mode", "Only Duet games have rematches.", 400)
+		return
+	}
+	if next, ok := h.games[g.nextGameID()]; ok {
+		next.mu.Lock()
+		defer next.mu.Unlock()
+		writeJSON(rw, next.playerView(body.PlayerID))
+		return
+	}
+	if g.duetState().Outcome == "" {
+		writeError(rw, "not_over", "A rematch can only be asked for once the game is over.", 400)
+		return
+	}
+	team, ok := g.seatOf(rw, body.PlayerID)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	g.markSeen(body.PlayerID, body.Name, team, now)
+	kind := rematchKeep
+	if body.Swap {
+		kind = rematchSwap
+	}
+	g.addEvent(Event{
+		Type:     "rematch_request",
+		Team:     team,
+		PlayerID: body.PlayerID,
+		Name:     body.Name,
+		Message:  []string{kind},
+	})
+
+	agreed, swap := g.rematchAgreed()
+	if !agreed {
+		writeJSON(rw, map[string]string{"status": "waiting"})
+		return
+	}
+	next, err := h.rematch(g, swap, now)
+	if err != nil {
+		writeError(rw, "bad_constraints", err.Error(), 400)
+		return
+	}
+	writeJSON(rw, next.playerView(body.PlayerID))
+}
@@ -0,0 +1,103 @@
+package gameapi
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestRematch(t *testing.T) {
+	h := newTestHandler(t, Config{})
+	g, err := ReconstructGame(NewState(21, numberedWords(40)), "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.games[g.GameID] = g
+	now := time.Now()
+	g.markSeenWithUser("a", "a", 1, now, JoinSideEvent{Age: "30", Gender: "f", Country: "NZ", NativeSpeaker: true})
+	g.markSeen("b", "b", 2, now)
+	g.addEvent(Event{Type: "chat", Team: 1, PlayerID: "a", Message: []string{"clue", "target"}})
+
+	request := func(id string, team int, kind string) {
+		g.addEvent(Event{Type: "rematch_request", Team: team, PlayerID: id, Message: []string{kind}})
+	}
+	request("a", 1, rematchKeep)
+	request("b", 2, rematchSwap)
+	if agreed, _ := g.rematchAgreed(); agreed {
+		t.Fatal("Expected different requests not to count as agreement")
+	}
+	request("a", 1, rematchSwap)
+	agreed, swap := g.rematchAgreed()
+	if !agreed || !swap {
+		t.Fatalf("Expected agreement on a swapped rematch, got %t, %t", agreed, swap)
+	}
+
+	next, err := h.rematch(g, swap, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.SeriesID != "first" || next.PrevGameID != "first" || next.Round != 2 || next.Seed == g.Seed {
+		t.Errorf("Expected the rematch to follow on from the first game, got %+v", next.GameState)
+	}
+	if next.FirstClue != 2 {
+		t.Errorf("Expected side 2 to give the first clue, got %d", next.FirstClue)
+	}
+	if next.players["a"].Team != 1 || next.players["b"].Team != 2 || len(g.players) != 0 {
+		t.Errorf("Expected the players to move to the same sides, got %v and %v", next.players, g.players)
+	}
+	if j := next.joinEvent("a"); j.UserCountry != "NZ" {
+		t.Errorf("Expected demographics to carry over, got %+v", j)
+	}
+	if g.nextGameID() != next.GameID || h.games[next.GameID] != next {
+		t.Error("Expected the first game to point to its rematch")
+	}
+
+	// Clients still polling the first game aren't seated in it again.
+	g.markSeen("a", "a", 1, now)
+	if _, ok := g.players["a"]; ok {
+		t.Error("Expected a moved player to stay out of the first game")
+	}
+
+	// Without a swap, the same side gives the first clue again.
+	third, err := h.rematch(next, false, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third.FirstClue != 2 {
+		t.Errorf("Expected side 2 to give the first clue again, got %d", third.FirstClue)
+	}
+}
+
+func TestRematchNeedsAFinishedGame(t *testing.T) {
+	h := newTestHandler(t, Config{})
+	g, err := ReconstructGame(NewState(21, numberedWords(40)), "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.games[g.GameID] = g
+	g.markSeen("a", "a", 1, time.Now())
+	g.markSeen("b", "b", 2, time.Now())
+	seed, _ := json.Marshal(g.Seed)
+	body := `{"game_id": "first", "seed": ` + string(seed) + `, "player_id": "a", "team": 1}`
+	if status := post(t, h, "/rematch", body, nil); status != 400 {
+		t.Errorf("Expected a rematch of a game in play to be refused, got %d", status)
+	}
+	if len(g.Events) != 2 {
+		t.Errorf("Expected no rematch request to be recorded, got %+v", g.Events)
+	}
+
+	// Once it's over, the request counts for the side the player
+	// holds, whatever team the request names.
+	g.addEvent(Event{Type: "chat", Team: 1, PlayerID: "a", Message: []string{"clue", "target"}})
+	g.addEvent(Event{Type: "guess", Team: 2, PlayerID: "b", Index: indexOf(g.OneLayout, Black)})
+	body = `{"game_id": "first", "seed": ` + string(seed) + `, "player_id": "a", "team": 2}`
+	if status := post(t, h, "/rematch", body, nil); status != 200 {
+		t.Fatalf("Expected the rematch request to be taken, got %d", status)
+	}
+	if e := g.Events[len(g.Events)-1]; e.Type != "rematch_request" || e.Team != 1 {
+		t.Errorf("Expected a request from side 1, got %+v", e)
+	}
+	if g.players["a"].Team != 1 {
+		t.Errorf("Expected a to stay on side 1, got %+v", g.players["a"])
+	}
+}
@@ -0,0 +1,197 @@
+package gameapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// defaultRoomTTL is how long a join code lasts when the
+// config doesn't say.
+const defaultRoomTTL = 15 * time.Minute
+
+// Join codes are made of consonant-vowel syllables, leaving out
+// letters that are easily misheard or misread (c, j, q, w, x, y).
+const (
+	codeConsonants = "bdfghklmnprstvz"
+	codeVowels     = "aeiou"
+)
+
+// room is a private game waiting for friends to join with its code.
+type room struct {
+	Code      string
+	GameID    string
+	HostID    string
+	ExpiresAt time.Time
+}
+
+// joinCode returns a pronounceable code such as "bako-rimu".
+func joinCode(rnd *rand.Rand) string {
+	var b strings.Builder
+	for i := 0; i < 4; i++ {
+		if i == 2 {
+			b.WriteByte('-')
+		}
+		b.WriteByte(codeConsonants[rnd.Intn(len(codeConsonants))])
+		b.WriteByte(codeVowels[rnd.Intn(len(codeVowels))])
+	}
+	return b.String()
+}
+
+// normalizeCode lets players type a code in any case,
+// with spaces or without the hyphen.
+func normalizeCode(code string) string {
+	code = strings.ToLower(strings.Join(strings.Fields(code), ""))
+	code = strings.Replace(code, "-", "", -1)
+	if len(code) == 8 {
+		code = code[:4] + "-" + code[4:]
+	}
+	return code
+}
+
+// pruneRooms forgets expired join codes. The caller holds h.mu.
+func (h *handler) pruneRooms(now time.Time) {
+	for code, r := range h.rooms {
+		if !now.Before(r.ExpiresAt) {
+			delete(h.rooms, code)
+		}
+	}
+}
+
+// POST /new-room
+// create a private game that only players with its join code can enter
+func (h *handler) handleNewRoom(rw http.ResponseWriter, req *http.Request) {
+	var body struct {
+		Words           []string          `json:"words,omitempty"`
+		WordList        string            `json:"word_list,omitempty"`
+		WordListVersion string            `json:"word_list_version,omitempty"`
+		Layout          string            `json:"layout,omitempty"`
+		Constraints     *BoardConstraints `json:"constraints,omitempty"`
+		SideSize        int               `json:"side_size,omitempty"`
+		Clock           *Clock            `json:"clock,omitempty"`
+		Team            int               `json:"team,omitempty"`
+		PlayerID        string            `json:"player_id"`
+		Name            string            `json:"name"`
+		joinDetails
+	}
+
+	err := json.NewDecoder(req.Body).Decode(&body)
+	if err != nil || body.PlayerID == "" || body.SideSize < 0 || body.Team < 0 || body.Team > 2 ||
+		!body.Clock.orZero().valid() {
+		writeError(rw, "malformed_body", "Unable to parse request body.", 400)
+		return
+	}
+
+	words, listName, ok := h.wordsFor(body.Words, body.WordList, body.WordListVersion)
+	if !ok {
+		writeError(rw, "unknown_word_list", "No word list has that name or version.", 404)
+		return
+	}
+	layout := DuetLayout
+	if body.Layout != "" {
+		l, ok := h.layouts[body.Layout]
+		if !ok {
+			writeError(rw, "unknown_layout", "No layout has that name.", 404)
+			return
+		}
+		layout = l
+	}
+	if len(words) < layout.Size() {
+		writeError(rw, "too_few_words",
+			fmt.Sprintf("A word list must have at least %d words.", layout.Size()), 400)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	state := NewState(h.rand.Int63(), words)
+	state.WordList = listName
+	state.Layout = &layout
+	state.SideSize = body.SideSize
+	state.Clock = body.Clock
+	state.Private = true
+	if body.Constraints != nil {
+		if err := h.constrainBoard(&state, *body.Constraints); err != nil {
+			writeError(rw, "bad_constraints", err.Error(), 400)
+			return
+		}
+	}
+	g, err := ReconstructGame(state, randomString(8))
+	if err != nil {
+		writeError(rw, "bad_word_list", err.Error(), 400)
+		return
+	}
+	now := time.Now()
+	g.CreatedAt = now
+	g.markSeenWithUser(body.PlayerID, body.Name, g.openSide(body.Team), now, body.join())
+	h.games[g.GameID] = g
+
+	h.pruneRooms(now)
+	code := joinCode(h.rand)
+	for h.rooms[code] != nil {
+		code = joinCode(h.rand)
+	}
+	r := &room{Code: code, GameID: g.GameID, HostID: body.PlayerID, ExpiresAt: now.Add(h.roomTTL)}
+	h.rooms[code] = r
+
+	writeJSON(rw, struct {
+		Code      string      `json:"code"`
+		ExpiresAt time.Time   `json:"expires_at"`
+		Game      interface{} `json:"game"`
+	}{r.Code, r.ExpiresAt, g.playerView(body.PlayerID)})
+}
+
+// POST /join-room
+// take a seat in a private game using its join code
+func (h *handler) handleJoinRoom(rw http.ResponseWriter, req *http.Request) {
+	var body struct {
+		Code     string `json:"code"`
+		Team     int    `json:"team,omitempty"`
+		PlayerID string `json:"player_id"`
+		Name     string `json:"name"`
+		joinDetails
+	}
+
+	err := json.NewDecoder(req.Body).Decode(&body)
+	if err != nil || body.Code == "" || body.PlayerID == "" {
+		writeError(rw, "malformed_body", "Unable to parse request body.", 400)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now()
+	h.pruneRooms(now)
+	r := h.rooms[normalizeCode(body.Code)]
+	if r == nil {
+		writeError(rw, "unknown_code", "That join code is wrong or has expired.", 404)
+		return
+	}
+	g, ok := h.games[r.GameID]
+	if !ok {
+		delete(h.rooms, r.Code)
+		writeError(rw, "unknown_code", "That join code is wrong or has expired.", 404)
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, seen := g.players[body.PlayerID]; !seen {
+		team := g.openSide(body.Team)
+		if team == 0 {
+			writeError(rw, "game_full", "The game is already full.", 400)
+			return
+		}
+		g.markSeenWithUser(body.PlayerID, body.Name, team, now, body.join())
+	}
+
+	// The code is used up once every seat is taken.
+	if g.openSide(0) == 0 {
+		delete(h.rooms, r.Code)
+	}
+	writeJSON(rw, g.playerView(body.PlayerID))
+}
@@ -0,0 +1,103 @@
+package gameapi
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func post(t *testing.T, h *handler, path, body string, resp interface{}) int {
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, httptest.NewRequest("POST", path, strings.NewReader(body)))
+	if resp != nil {
+		if err := json.Unmarshal(rw.Body.Bytes(), resp); err != nil {
+			t.Fatalf("%s: %s", path, err)
+		}
+	}
+	return rw.Code
+}
+
+// newTestHandler returns a handler with one word list of 40 words.
+func newTestHandler(t *testing.T, config Config) *handler {
+	hh, err := Handler(map[string][]string{"test": numberedWords(40)}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hh.(*handler)
+}
+
+func TestJoinCode(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	valid := regexp.MustCompile(`^([bdfghklmnprstvz][aeiou]){2}-([bdfghklmnprstvz][aeiou]){2}$`)
+	for i := 0; i < 100; i++ {
+		if code := joinCode(rnd); !valid.MatchString(code) {
+			t.Fatalf("Expected a pronounceable code, got %q", code)
+		}
+	}
+	if code := normalizeCode(" BAKO rimu "); code != "bako-rimu" {
+		t.Errorf("Expected the code to be normalized to bako-rimu, got %q", code)
+	}
+}
+
+func TestPrivateRoom(t *testing.T) {
+	h := newTestHandler(t, Config{RoomTTL: time.Minute})
+
+	var created struct {
+		Code string `json:"code"`
+		Game struct {
+			GameID string `json:"game_id"`
+		} `json:"game"`
+	}
+	post(t, h, "/new-room", `{"player_id": "host", "name": "host"}`, &created)
+
+	// A stranger looking for a game must not be matched into the room.
+	var matched struct {
+		GameID string `json:"game_id"`
+	}
+	post(t, h, "/new-game", `{"player_id": "stranger", "name": "stranger"}`, &matched)
+	if matched.GameID == created.Game.GameID {
+		t.Fatal("Expected the matchmaker to skip private rooms")
+	}
+	if code := post(t, h, "/new-game", `{"game_id": "`+created.Game.GameID+`", "player_id": "nosy"}`, nil); code != 403 {
+		t.Errorf("Expected joining a private game by ID to be refused, got %d", code)
+	}
+
+	var ids []string
+	post(t, h, "/ids", `{}`, &ids)
+	for _, id := range ids {
+		if id == created.Game.GameID {
+			t.Error("Expected /ids to leave out private games")
+		}
+	}
+
+	// Polling a private game doesn't take a seat in it.
+	seed, _ := json.Marshal(h.games[created.Game.GameID].Seed)
+	post(t, h, "/events", `{"game_id": "`+created.Game.GameID+`", "seed": `+string(seed)+`, "player_id": "nosy", "team": 2}`, nil)
+	if _, ok := h.games[created.Game.GameID].players["nosy"]; ok {
+		t.Error("Expected polling a private game not to seat a stranger")
+	}
+
+	var joined struct {
+		GameID string `json:"game_id"`
+	}
+	code := strings.ToUpper(created.Code)
+	if status := post(t, h, "/join-room", `{"code": "`+code+`", "player_id": "friend"}`, &joined); status != 200 {
+		t.Fatalf("Expected the friend to join, got %d", status)
+	}
+	if joined.GameID != created.Game.GameID || h.games[joined.GameID].players["friend"].Team != 2 {
+		t.Errorf("Expected the friend to take side 2 of %s, got %s", created.Game.GameID, joined.GameID)
+	}
+	if status := post(t, h, "/join-room", `{"code": "`+code+`", "player_id": "late"}`, nil); status != 404 {
+		t.Errorf("Expected the code to be used up, got %d", status)
+	}
+
+	post(t, h, "/new-room", `{"player_id": "host2"}`, &created)
+	h.rooms[created.Code].ExpiresAt = time.Now().Add(-time.Second)
+	if status := post(t, h, "/join-room", `{"code": "`+created.Code+`", "player_id": "friend2"}`, nil); status != 404 {
+		t.Errorf("Expected an expired code to be refused, got %d", status)
+	}
+}
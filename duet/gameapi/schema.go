@@ -0,0 +1,160 @@
+package gameapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// CurrentSchemaVersion is the shape of GameState and Event this
+// server writes. Saved games carry it in schema_version.
+//
+// The versions so far:
+//
+//  1. Codenames Green as we forked it: chat events hold free
+//     text in a message string.
+//  2. Study logs: clue events hold [clue, five targets, five
+//     rationales] in a message list, and players' demographics
+//     ride on join_side.
+//  3. num_target_words on clues, one_seen_words and
+//     two_seen_words on clues, rationales on guesses and
+//     timestamps on everything.
+//  4. schema_version itself, and the optional fields for modes,
+//     layouts and the like, whose zero values mean version 3's
+//     behaviour.
+const CurrentSchemaVersion = 4
+
+// migrations upgrade saved state one version at a time:
+// migrations[v] takes version v to v+1. They work on the
+// decoded JSON, since older shapes may not fit GameState.
+var migrations = map[int]func(state map[string]interface{}) error{
+	1: migrateFreeTextChat,
+	2: migrateTargetCounts,
+	3: func(map[string]interface{}) error { return nil },
+}
+
+// schemaVersion returns the version of a saved state. States from
+// before versions were kept are told apart by their fields.
+func schemaVersion(state map[string]interface{}) (int, error) {
+	if v, ok := state["schema_version"]; ok {
+		n, ok := v.(json.Number)
+		if !ok {
+			return 0, fmt.Errorf("schema_version %v isn't a number", v)
+		}
+		i, err := n.Int64()
+		return int(i), err
+	}
+	version := 2
+	for _, e := range stateEvents(state) {
+		if _, ok := e["num_target_words"]; ok {
+			return 3, nil
+		}
+		if _, ok := e["message"].(string); ok {
+			version = 1
+		}
+	}
+	return version, nil
+}
+
+func stateEvents(state map[string]interface{}) []map[string]interface{} {
+	list, _ := state["events"].([]interface{})
+	evts := make([]map[string]interface{}, 0, len(list))
+	for _, e := range list {
+		if m, ok := e.(map[string]interface{}); ok {
+			evts = append(evts, m)
+		}
+	}
+	return evts
+}
+
+// migrateFreeTextChat turns version 1's free-text chat into
+// messages, so it isn't taken for clues, and wraps every
+// message string in a list.
+func migrateFreeTextChat(state map[string]interface{}) error {
+	for _, e := range stateEvents(state) {
+		text, ok := e["message"].(string)
+		if !ok {
+			continue
+		}
+		if e["type"] == "chat" {
+			e["type"] = "message"
+		}
+		if text == "" {
+			e["message"] = nil
+		} else {
+			e["message"] = []interface{}{text}
+		}
+	}
+	return nil
+}
+
+// migrateTargetCounts counts the targets of version 2's clues.
+// Seen-word lists can't be rebuilt without the board, so they
+// stay missing, which the validator takes to mean they were
+// never kept.
+func migrateTargetCounts(state map[string]interface{}) error {
+	for _, e := range stateEvents(state) {
+		if e["type"] != "chat" {
+			continue
+		}
+		msg, _ := e["message"].([]interface{})
+		n := 0
+		for i := 1; i <= 5 && i < len(msg); i++ {
+			if s, _ := msg[i].(string); normalizeWord(s) != "" {
+				n++
+			}
+		}
+		e["num_target_words"] = n
+	}
+	return nil
+}
+
+// migrateState upgrades a saved state to the current version.
+func migrateState(b []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var state map[string]interface{}
+	if err := dec.Decode(&state); err != nil {
+		return nil, err
+	}
+	version, err := schemaVersion(state)
+	if err != nil {
+		return nil, err
+	}
+	if version == CurrentSchemaVersion {
+		return b, nil
+	}
+	if version < 1 || version > CurrentSchemaVersion {
+		return nil, fmt.Errorf("unknown schema version %d; this server reads up to %d", version, CurrentSchemaVersion)
+	}
+	for ; version < CurrentSchemaVersion; version++ {
+		if err := migrations[version](state); err != nil {
+			return nil, fmt.Errorf("migrating from schema version %d: %v", version, err)
+		}
+	}
+	state["schema_version"] = CurrentSchemaVersion
+	return json.Marshal(state)
+}
+
+// migrateGame upgrades the state inside a saved game, in any
+// format that keeps it under "state", such as a StoredGame or
+// what the /game endpoint returns.
+func migrateGame(b []byte) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	state, ok := fields["state"]
+	if !ok || bytes.Equal(bytes.TrimSpace(state), []byte("null")) {
+		return b, nil
+	}
+	migrated, err := migrateState(state)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(migrated, state) {
+		return b, nil
+	}
+	fields["state"] = migrated
+	return json.Marshal(fields)
+}
@@ -0,0 +1,109 @@
+package gameapi
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func readFixture(t *testing.T, name string) *Game {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", "schema", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var games []*Game
+	if err := ReadGames(f, func(g *Game) error {
+		games = append(games, g)
+		return nil
+	}); err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	if len(games) != 1 {
+		t.Fatalf("%s: expected one game, got %d", name, len(games))
+	}
+	return games[0]
+}
+
+func TestSchemaMigrations(t *testing.T) {
+	for _, name := range []string{"v1.json", "v2.json", "v3.json", "v4.json"} {
+		g := readFixture(t, name)
+		if g.SchemaVersion != CurrentSchemaVersion {
+			t.Errorf("%s: schema version %d, want %d", name, g.SchemaVersion, CurrentSchemaVersion)
+		}
+		if len(g.Events) != 4 || g.Events[3].Type != "guess" || g.Events[3].Index != 0 {
+			t.Errorf("%s: unexpected events %+v", name, g.Events)
+		}
+
+		// Migrated games load the same way again.
+		b, err := json.Marshal(g)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var again []*Game
+		if err := ReadGames(strings.NewReader(string(b)), func(g *Game) error {
+			again = append(again, g)
+			return nil
+		}); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(again) != 1 || !reflect.DeepEqual(again[0].Events, g.Events) {
+			t.Errorf("%s: migrating twice changed the events", name)
+		}
+
+		switch name {
+		case "v1.json":
+			if e := g.Events[2]; e.Type != "message" || !reflect.DeepEqual(e.Message, []string{"fruit 2"}) {
+				t.Errorf("Expected free-text chat to become a message, got %+v", e)
+			}
+			if g.Events[0].Message != nil {
+				t.Errorf("Expected an empty message to be dropped, got %q", g.Events[0].Message)
+			}
+		default:
+			if e := g.Events[2]; e.Type != "chat" || e.Num_target_words != 2 {
+				t.Errorf("%s: expected a clue with two targets, got %+v", name, e)
+			}
+			if issues := g.Validate(); len(issues) != 0 {
+				t.Errorf("%s: expected a consistent game, got %+v", name, issues)
+			}
+		}
+	}
+}
+
+func TestSchemaFromTheFuture(t *testing.T) {
+	r := strings.NewReader(`{"game_id": "x", "state": {"schema_version": 99, "events": []}}`)
+	err := ReadGames(r, func(*Game) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "schema version 99") {
+		t.Errorf("Expected an unknown version to be refused, got %v", err)
+	}
+}
+
+func TestStoredGameMigration(t *testing.T) {
+	dir := t.TempDir()
+	b, err := ioutil.ReadFile(filepath.Join("testdata", "schema", "v2.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "v2.json"), b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := newGameStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := s.gamesOf("a"); len(ids) != 1 || ids[0] != "v2" {
+		t.Fatalf("Expected the old game to be indexed, got %v", ids)
+	}
+	sg, err := readStoredGame(filepath.Join(dir, "v2.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sg.State.SchemaVersion != CurrentSchemaVersion || sg.State.Events[2].Num_target_words != 2 {
+		t.Errorf("Expected the stored game to be migrated, got %+v", sg.State)
+	}
+}
@@ -0,0 +1,214 @@
+package gameapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// Key views say which key cards a spectator may see.
+const (
+	ViewNone = "none"
+	ViewOne  = "one"
+	ViewTwo  = "two"
+	ViewBoth = "both"
+)
+
+func validView(view string) bool {
+	switch view {
+	case ViewNone, ViewOne, ViewTwo, ViewBoth:
+		return true
+	}
+	return false
+}
+
+// showsKey reports whether a view includes a side's key card.
+func showsKey(view string, team int) bool {
+	return view == ViewBoth || (view == ViewOne && team == 1) || (view == ViewTwo && team == 2)
+}
+
+// Spectator watches a game without a seat. Spectators are kept
+// apart from players, so they never fill a side or count as
+// active players.
+type Spectator struct {
+	Name     string    `json:"name"`
+	View     string    `json:"view"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// spectatorLink lets whoever holds its token watch a game
+// with the key view chosen when the link was made.
+type spectatorLink struct {
+	GameID    string
+	View      string
+	CreatedAt time.Time
+}
+
+// watch adds a spectator, who receives the game's events
+// but can't guess, chat or end turns.
+func (g *Game) watch(playerID, name, view string, when time.Time) {
+	if g.spectators == nil {
+		g.spectators = make(map[string]Spectator)
+	}
+	g.spectators[playerID] = Spectator{Name: name, View: view, LastSeen: when}
+}
+
+// spectating reports whether the player is watching the game.
+func (gs *GameState) spectating(playerID string) bool {
+	_, ok := gs.spectators[playerID]
+	return ok
+}
+
+// SpectatorView is what a spectator sees of a game. It has the
+// same shape as a Game, with the hidden key cards left out.
+type SpectatorView struct {
+	GameID    string    `json:"game_id"`
+	State     viewState `json:"state"`
+	Words     []string  `json:"words"`
+	OneLayout []Color   `json:"one_layout,omitempty"`
+	TwoLayout []Color   `json:"two_layout,omitempty"`
+	Key       []Color   `json:"key,omitempty"`
+	View      string    `json:"view"`
+}
+
+type viewState struct {
+	Seed   Seed    `json:"seed"`
+	Events []Event `json:"events"`
+	Mode   string  `json:"mode,omitempty"`
+	Layout *Layout `json:"layout,omitempty"`
+}
+
+func (g *Game) spectatorView(view string) SpectatorView {
+	v := SpectatorView{
+		GameID: g.GameID,
+		State: viewState{
+			Seed:   g.Seed,
+			Events: withoutReports("", redactEvents(view, g.Events)),
+			Mode:   g.Mode,
+			Layout: g.Layout,
+		},
+		Words: g.Words,
+		View:  view,
+	}
+	if showsKey(view, 1) {
+		v.OneLayout = g.OneLayout
+	}
+	if showsKey(view, 2) {
+		v.TwoLayout = g.TwoLayout
+	}
+	if view == ViewBoth {
+		v.Key = g.Key
+	}
+	return v
+}
+
+// redactEvents strips the target words and rationales from
+// the clues of sides whose key the view hides, since a side's
+// targets are greens on its own key.
+func redactEvents(view string, evts []Event) []Event {
+	out := make([]Event, len(evts))
+	for i, e := range evts {
+		if e.Type == "chat" && len(e.Message) > 1 && !showsKey(view, e.Team) {
+			e.Message = e.Message[:1:1]
+		}
+		out[i] = e
+	}
+	return out
+}
+
+// withoutReports drops the reports that playerID didn't make.
+func withoutReports(playerID string, evts []Event) []Event {
+	out := evts[:0:0]
+	for _, e := range evts {
+		if e.Type != "report" || e.PlayerID == playerID {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// eventsFor returns the events a player may see. Reports are
+// only shown to the player who made them.
+func (gs *GameState) eventsFor(playerID string, evts []Event) []Event {
+	if s, ok := gs.spectators[playerID]; ok {
+		evts = redactEvents(s.View, evts)
+	}
+	return withoutReports(playerID, evts)
+}
+
+// POST /spectator-link
+// Links that show a key need the admin token, so players can't
+// open one to read their partner's key.
+func (h *handler) handleSpectatorLink(rw http.ResponseWriter, req *http.Request) {
+	var body struct {
+		Token  string `json:"token"`
+		GameID string `json:"game_id"`
+		View   string `json:"view"`
+	}
+	err := json.NewDecoder(req.Body).Decode(&body)
+	if err != nil || body.GameID == "" {
+		writeError(rw, "malformed_body", "Unable to parse request body.", 400)
+		return
+	}
+	if body.View == "" {
+		body.View = ViewNone
+	}
+	if !validView(body.View) {
+		writeError(rw, "bad_view", "The view must be none, one, two or both.", 400)
+		return
+	}
+	if body.View != ViewNone && !h.checkAdmin(rw, body.Token) {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	g, ok := h.games[body.GameID]
+	if !ok {
+		writeError(rw, "not_found", "Game not found", 404)
+		return
+	}
+	if g.Mode == ModeClassic && (body.View == ViewOne || body.View == ViewTwo) {
+		writeError(rw, "bad_view", "Classic games have one key: the view must be none or both.", 400)
+		return
+	}
+
+	token := randomString(16)
+	h.spectatorLinks[token] = spectatorLink{GameID: body.GameID, View: body.View, CreatedAt: time.Now()}
+	writeJSON(rw, struct {
+		Token string `json:"token"`
+		View  string `json:"view"`
+	}{token, body.View})
+}
+
+// POST /watch
+func (h *handler) handleWatch(rw http.ResponseWriter, req *http.Request) {
+	var body struct {
+		Token    string `json:"token"`
+		PlayerID string `json:"player_id"`
+		Name     string `json:"name"`
+	}
+	err := json.NewDecoder(req.Body).Decode(&body)
+	if err != nil || body.Token == "" || body.PlayerID == "" {
+		writeError(rw, "malformed_body", "Unable to parse request body.", 400)
+		return
+	}
+
+	h.mu.Lock()
+	link, ok := h.spectatorLinks[body.Token]
+	g := h.games[link.GameID]
+	h.mu.Unlock()
+	if !ok || g == nil {
+		writeError(rw, "not_found", "No game has that spectator link.", 404)
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, seated := g.players[body.PlayerID]; seated {
+		writeError(rw, "already_playing", "Players can't watch their own game.", 400)
+		return
+	}
+	g.watch(body.PlayerID, body.Name, link.View, time.Now())
+	writeJSON(rw, g.spectatorView(link.View))
+}
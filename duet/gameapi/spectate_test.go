@@ -0,0 +1,121 @@
+package gameapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSpectatorView(t *testing.T) {
+	g, err := ReconstructGame(NewState(11, numberedWords(40)), "watched")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	g.markSeen("one", "one", 1, now)
+	g.markSeen("two", "two", 2, now)
+	g.addEvent(Event{Type: "chat", Team: 1, PlayerID: "one", Message: []string{"clue", "target", "because of reasons"}})
+	g.addEvent(Event{Type: "chat", Team: 2, PlayerID: "two", Message: []string{"hint", "word", "it just fits"}})
+	g.watch("ta", "ta", ViewOne, now)
+
+	v := g.spectatorView(ViewOne)
+	if !reflect.DeepEqual(v.OneLayout, g.OneLayout) || v.TwoLayout != nil {
+		t.Errorf("Expected only side one's key, got %v and %v", v.OneLayout, v.TwoLayout)
+	}
+	evts := g.eventsFor("ta", g.Events)
+	if one, two := evts[2].Message, evts[3].Message; len(one) != 3 || !reflect.DeepEqual(two, []string{"hint"}) {
+		t.Errorf("Expected side two's targets to be hidden, got %v and %v", one, two)
+	}
+	if len(g.Events[3].Message) != 3 {
+		t.Error("Expected redaction to leave the game's own events alone")
+	}
+	if len(g.players) != 2 || g.openSide(0) != 0 {
+		t.Errorf("Expected the spectator not to take a seat, got %v", g.players)
+	}
+}
+
+func TestMovesNeedASeat(t *testing.T) {
+	h := newTestHandler(t, Config{})
+	g, err := ReconstructGame(NewState(11, numberedWords(40)), "seats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	g.markSeen("one", "one", 1, now)
+	g.markSeen("two", "two", 2, now)
+	g.markSeen("extra", "extra", 1, now) // the side is full
+	h.games[g.GameID] = g
+	b, _ := json.Marshal(g.Seed)
+	seed := `"seed": ` + string(b)
+
+	for _, path := range []string{"/guess", "/end-turn"} {
+		if status := post(t, h, path, `{"game_id": "seats", `+seed+`, "player_id": "extra", "team": 2}`, nil); status != 403 {
+			t.Errorf("%s: expected an unseated player to be refused, got %d", path, status)
+		}
+	}
+	post(t, h, "/chat", `{"game_id": "seats", `+seed+`, "player_id": "extra", "team": 1, "message": ["x", "y"]}`, nil)
+
+	// A seated player's guess counts for their own side.
+	if status := post(t, h, "/guess", `{"game_id": "seats", `+seed+`, "player_id": "one", "team": 2, "index": 0}`, nil); status != 200 {
+		t.Fatalf("Expected a seated player's guess to be taken, got %d", status)
+	}
+	for _, e := range g.Events {
+		if e.PlayerID == "extra" && e.Type != EventJoinSide {
+			t.Errorf("Expected no moves from the unseated player, got %+v", e)
+		}
+		if e.Type == EventGuess && e.Team != 1 {
+			t.Errorf("Expected the guess to count for side one, got %+v", e)
+		}
+	}
+}
+
+func TestSpectatorLinksNeedAdmin(t *testing.T) {
+	h := newTestHandler(t, Config{AdminToken: "secret"})
+	g, err := ReconstructGame(NewState(11, numberedWords(40)), "watched")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.markSeen("one", "one", 1, time.Now())
+	g.Private = true
+	h.games[g.GameID] = g
+
+	if status := post(t, h, "/spectator-link", `{"game_id": "watched", "view": "both"}`, nil); status != 403 {
+		t.Errorf("Expected a player's link to the keys to be refused, got %d", status)
+	}
+	if status := post(t, h, "/spectator-link", `{"game_id": "watched", "view": "both", "token": "secret"}`, nil); status != 200 {
+		t.Errorf("Expected an admin's link to be made, got %d", status)
+	}
+	if status := post(t, h, "/spectator-link", `{"game_id": "watched"}`, nil); status != 200 {
+		t.Errorf("Expected a link without keys to be made, got %d", status)
+	}
+	if status := post(t, h, "/new-game", `{"game_id": "watched", "player_id": "x", "spectator": true}`, nil); status != 403 {
+		t.Errorf("Expected spectating a private game without a link to be refused, got %d", status)
+	}
+}
+
+func TestGameHidesKeysFromViewers(t *testing.T) {
+	h := newTestHandler(t, Config{})
+	g, err := ReconstructGame(NewState(11, numberedWords(40)), "watched")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	g.markSeen("one", "one", 1, now)
+	g.markSeen("two", "two", 2, now)
+	g.watch("ta", "ta", ViewNone, now)
+	h.games[g.GameID] = g
+
+	for _, id := range []string{"ta", "stranger", ""} {
+		var v map[string]json.RawMessage
+		post(t, h, "/game", `{"game_id": "watched", "player_id": "`+id+`"}`, &v)
+		if v["one_layout"] != nil || v["two_layout"] != nil {
+			t.Errorf("Expected %q to see neither key from /game", id)
+		}
+	}
+	var v map[string]json.RawMessage
+	post(t, h, "/game", `{"game_id": "watched", "player_id": "one"}`, &v)
+	if v["one_layout"] == nil {
+		t.Error("Expected a seated player to get the game's keys")
+	}
+}
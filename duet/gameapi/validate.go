@@ -0,0 +1,212 @@
+package gameapi
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Kinds of inconsistency an event log can have.
+const (
+	IssueNumbering       = "numbering"    // event numbers aren't 1, 2, 3...
+	IssueOrdering        = "ordering"     // timestamps go backwards
+	IssueUnknownType     = "unknown_type" // an event type the server never writes
+	IssueStrayField      = "stray_field"  // a field the event's type doesn't carry
+	IssueMissingJoin     = "missing_join" // a side no one joined
+	IssueNotJoined       = "not_joined"   // a move by a player who hadn't joined that side
+	IssueBadIndex        = "bad_index"    // a guess off the board
+	IssueRepeatGuess     = "repeat_guess" // a side guessed the same word twice
+	IssueGuessEarly      = "guess_before_clue"
+	IssueIgnoredMove     = "ignored_move" // a move the rules wouldn't have taken
+	IssueAfterEnd        = "after_end"    // a move after the game was over
+	IssueDuplicateTarget = "duplicate_target"
+	IssueBadTarget       = "bad_target"   // a target that isn't an unfound green on the giver's key
+	IssueTargetCount     = "target_count" // num_target_words disagrees with the targets
+	IssueClueOnBoard     = "clue_on_board"
+	IssueSeenWords       = "seen_words" // seen-word lists that disagree with the guesses
+	IssueOutcome         = "outcome"    // a recorded outcome the events don't bear out
+)
+
+// Issue is one inconsistency in a game's event log.
+type Issue struct {
+	Event  int    `json:"event,omitempty"` // the event's number; 0 for the game as a whole
+	Kind   string `json:"kind"`
+	Detail string `json:"detail"`
+}
+
+// Validate replays a game's events through the rules and reports
+// everything in them that the server shouldn't have let through.
+// Classic games only get the checks that don't need the rules.
+func (g *Game) Validate() []Issue {
+	issues := []Issue{}
+	add := func(e Event, kind, format string, args ...interface{}) {
+		issues = append(issues, Issue{Event: e.Number, Kind: kind, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	joined := map[string]int{}
+	sides := map[int]bool{}
+	var last int64
+	for i, e := range g.Events {
+		if e.Number != i+1 {
+			add(e, IssueNumbering, "event %d is numbered %d", i+1, e.Number)
+		}
+		if e.Time != 0 && e.Time < last {
+			add(e, IssueOrdering, "timestamp %d comes after %d", e.Time, last)
+		}
+		if e.Time != 0 {
+			last = e.Time
+		}
+		if err := e.Check(); err != nil {
+			if err.(*EventError).Field == "" {
+				add(e, IssueUnknownType, "unknown event type %q", e.Type)
+			} else {
+				add(e, IssueStrayField, "%s events don't carry %s", e.Type, err.(*EventError).Field)
+			}
+		}
+		switch e.Type {
+		case "join_side":
+			joined[e.PlayerID] = e.Team
+			sides[e.Team] = true
+		case "chat", "guess", "end_turn", "clue":
+			if e.PlayerID != "" && joined[e.PlayerID] != e.Team {
+				add(e, IssueNotJoined, "%s moved for side %d without joining it", e.PlayerID, e.Team)
+			}
+		}
+	}
+	for _, team := range []int{1, 2} {
+		if !sides[team] {
+			issues = append(issues, Issue{Kind: IssueMissingJoin, Detail: fmt.Sprintf("no one joined side %d", team)})
+		}
+	}
+	if g.Mode == ModeClassic {
+		return issues
+	}
+	return append(issues, g.validateDuet()...)
+}
+
+// validateDuet checks a Duet game's moves against the rules.
+func (g *Game) validateDuet() []Issue {
+	var issues []Issue
+	add := func(e Event, kind, format string, args ...interface{}) {
+		issues = append(issues, Issue{Event: e.Number, Kind: kind, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	s := g.newDuetState()
+	clued := [3]bool{}
+	guessed := [3]map[int]bool{nil, {}, {}}
+	// seen[1] holds the words side two has guessed, as the
+	// server tracks them in one_seen_words, and seen[2] the reverse.
+	seen := [3]map[string]bool{nil, {}, {}}
+	for _, e := range g.Events {
+		switch e.Type {
+		case "chat":
+			if e.Team != 1 && e.Team != 2 {
+				continue
+			}
+			g.validateClue(s, e, seen, add)
+			clued[e.Team] = true
+			continue
+		case "guess":
+			if e.Index < 0 || e.Index >= len(g.Words) {
+				add(e, IssueBadIndex, "index %d is off a board of %d words", e.Index, len(g.Words))
+				continue
+			}
+			if e.Team != 1 && e.Team != 2 {
+				break // the rules ignore it
+			}
+			if guessed[e.Team][e.Index] {
+				add(e, IssueRepeatGuess, "side %d guessed %q again", e.Team, g.Words[e.Index])
+			}
+			guessed[e.Team][e.Index] = true
+			seen[otherTeam(e.Team)][normalizeWord(g.Words[e.Index])] = true
+			if !clued[otherTeam(e.Team)] {
+				add(e, IssueGuessEarly, "side %d guessed before side %d gave a clue", e.Team, otherTeam(e.Team))
+			}
+		case "end_turn":
+		default:
+			s.apply(e)
+			continue
+		}
+		if s.Outcome != "" {
+			add(e, IssueAfterEnd, "a %s after the game was %s", e.Type, s.Outcome)
+			continue
+		}
+		if !s.apply(e) {
+			add(e, IssueIgnoredMove, "side %d's %s out of turn", e.Team, e.Type)
+		}
+	}
+	if g.Outcome != "" && s.Outcome != "" && g.Outcome != s.Outcome {
+		issues = append(issues, Issue{Kind: IssueOutcome, Detail: fmt.Sprintf("recorded as %s, but the events end %s", g.Outcome, s.Outcome)})
+	}
+	return issues
+}
+
+// validateClue checks a clue against the board as it stood.
+func (g *Game) validateClue(s *DuetState, e Event, seen [3]map[string]bool, add func(Event, string, string, ...interface{})) {
+	if len(e.Message) == 0 || withdrawn(e.PlayerID) {
+		return
+	}
+	for _, w := range g.Words {
+		if normalizeWord(w) == normalizeWord(e.Message[0]) {
+			add(e, IssueClueOnBoard, "the clue %q is on the board", e.Message[0])
+		}
+	}
+	targets := map[string]bool{}
+	for i := 1; i <= 5 && i < len(e.Message); i++ {
+		t := normalizeWord(e.Message[i])
+		if t == "" {
+			continue
+		}
+		if targets[t] {
+			add(e, IssueDuplicateTarget, "the target %q is given twice", e.Message[i])
+		}
+		targets[t] = true
+		index := -1
+		for j, w := range g.Words {
+			if normalizeWord(w) == t {
+				index = j
+			}
+		}
+		switch {
+		case index < 0:
+			add(e, IssueBadTarget, "the target %q isn't on the board", e.Message[i])
+		case s.key(e.Team)[index] != Green:
+			add(e, IssueBadTarget, "the target %q isn't green on side %d's key", e.Message[i], e.Team)
+		case s.exposed[e.Team][index] || s.greenFound(index):
+			add(e, IssueBadTarget, "the target %q was already guessed", e.Message[i])
+		}
+	}
+	if e.Num_target_words != len(targets) {
+		add(e, IssueTargetCount, "num_target_words is %d, but %d targets were given", e.Num_target_words, len(targets))
+	}
+
+	// Logs from before seen-word lists were kept don't have them.
+	for team, list := range [3][]string{nil, e.OneSeenWords, e.TwoSeenWords} {
+		if team == 0 || list == nil {
+			continue
+		}
+		logged := map[string]bool{}
+		for _, w := range list {
+			logged[normalizeWord(w)] = true
+		}
+		if missing, extra := setDiff(seen[team], logged), setDiff(logged, seen[team]); len(missing)+len(extra) > 0 {
+			add(e, IssueSeenWords, "side %d's seen words lack %v and have %v that no guess revealed", team, missing, extra)
+		}
+	}
+}
+
+func normalizeWord(w string) string {
+	return strings.ToLower(strings.TrimSpace(w))
+}
+
+// setDiff returns the words in a but not b, sorted.
+func setDiff(a, b map[string]bool) []string {
+	out := []string{}
+	for w := range a {
+		if !b[w] {
+			out = append(out, w)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
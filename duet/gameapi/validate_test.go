@@ -0,0 +1,56 @@
+package gameapi
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	g := &Game{
+		GameID:    "g",
+		Words:     []string{"apple", "bear", "cat", "dog"},
+		OneLayout: []Color{Green, Tan, Green, Black},
+		TwoLayout: []Color{Green, Green, Tan, Tan},
+	}
+	events := []Event{
+		{Type: "join_side", Team: 1, PlayerID: "a"},
+		{Type: "join_side", Team: 2, PlayerID: "b"},
+		{Type: "chat", Team: 1, PlayerID: "a", Message: []string{"fruit", "apple", "cat", "", "", ""}, Num_target_words: 2,
+			OneSeenWords: []string{}, TwoSeenWords: []string{}},
+		{Type: "guess", Team: 2, PlayerID: "b", Index: 0},
+		{Type: "guess", Team: 2, PlayerID: "b", Index: 1},
+		{Type: "chat", Team: 2, PlayerID: "b", Message: []string{"animal", "bear", "", "", "", ""}, Num_target_words: 1,
+			OneSeenWords: []string{"apple", "bear"}, TwoSeenWords: []string{}},
+		{Type: "guess", Team: 1, PlayerID: "a", Index: 1},
+	}
+	for i := range events {
+		events[i].Number = i + 1
+		events[i].Time = 100 + int64(i)
+	}
+	g.Events = events
+	if issues := g.Validate(); len(issues) != 0 {
+		t.Fatalf("Expected a consistent game to pass, got %+v", issues)
+	}
+
+	// Break it in every way the request found.
+	g.Events = append([]Event{}, events[1:]...)
+	g.Events[1].Message = []string{"fruit", "Apple", "apple ", "", "", ""}
+	g.Events[1].Num_target_words = 2
+	g.Events[4].OneSeenWords = []string{"apple"}
+	g.Events = append(g.Events, Event{Type: "guess", Team: 1, PlayerID: "a", Index: 9})
+	for i := range g.Events {
+		g.Events[i].Number = i + 1
+		g.Events[i].Time = 100 + int64(i)
+	}
+	var kinds []string
+	for _, issue := range g.Validate() {
+		kinds = append(kinds, issue.Kind)
+	}
+	want := []string{
+		IssueNotJoined, IssueNotJoined, IssueNotJoined, IssueMissingJoin,
+		IssueDuplicateTarget, IssueTargetCount, IssueSeenWords, IssueBadIndex,
+	}
+	if !reflect.DeepEqual(kinds, want) {
+		t.Errorf("Issues = %v\nwant %v", kinds, want)
+	}
+}
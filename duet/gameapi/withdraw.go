@@ -0,0 +1,241 @@
+package gameapi
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// withdrawnPrefix starts the IDs that stand in for players who
+// withdrew. Each withdrawn player in a game gets their own, so
+// the game still replays.
+const withdrawnPrefix = "withdrawn-"
+
+// withdrawn reports whether a player ID stands in for a player
+// who withdrew.
+func withdrawn(playerID string) bool {
+	return strings.HasPrefix(playerID, withdrawnPrefix)
+}
+
+// Withdrawal is the audit record of a player being scrubbed out.
+// It keeps a hash of their ID rather than the ID itself, so the
+// record can confirm a request was handled without keeping it.
+type Withdrawal struct {
+	Time         time.Time       `json:"time"`
+	PlayerHash   string          `json:"player_hash"`
+	Games        []WithdrawnGame `json:"games"`
+	Participant  bool            `json:"participant"`   // their registry entry was removed
+	ReportsFiled int             `json:"reports_filed"` // reports they made about others, scrubbed
+}
+
+// WithdrawnGame says what was scrubbed from one game.
+type WithdrawnGame struct {
+	GameID       string `json:"game_id"`
+	StandIn      string `json:"stand_in"`     // the ID their events now carry
+	Events       int    `json:"events"`       // events they made
+	Demographics int    `json:"demographics"` // join events whose answers were cleared
+	FreeText     int    `json:"free_text"`    // events whose clues, rationales or messages were cleared
+	Mentions     int    `json:"mentions"`     // other players' events that named them
+}
+
+func hashPlayerID(playerID string) string {
+	sum := sha256.Sum256([]byte(playerID))
+	return hex.EncodeToString(sum[:16])
+}
+
+// withdraw scrubs a player out of a game's events. Their events
+// are kept, so the game still replays, but carry a stand-in ID
+// and lose their name, demographics and free text. The game is
+// marked partial. It reports false if the player wasn't in it.
+func (gs *GameState) withdraw(playerID string) (WithdrawnGame, bool) {
+	var wg WithdrawnGame
+	n := 1
+	for _, e := range gs.Events {
+		if withdrawn(e.PlayerID) {
+			if i, err := strconv.Atoi(strings.TrimPrefix(e.PlayerID, withdrawnPrefix)); err == nil && i >= n {
+				n = i + 1
+			}
+		}
+	}
+	wg.StandIn = withdrawnPrefix + strconv.Itoa(n)
+
+	for i := range gs.Events {
+		e := &gs.Events[i]
+		mentioned := false
+		if e.ReportedID == playerID {
+			e.ReportedID = wg.StandIn
+			mentioned = true
+		}
+		for j, id := range e.SideMembers {
+			if id == playerID {
+				e.SideMembers[j] = wg.StandIn
+				mentioned = true
+			}
+		}
+		if e.PlayerID != playerID {
+			if mentioned {
+				wg.Mentions++
+			}
+			continue
+		}
+		wg.Events++
+		e.PlayerID = wg.StandIn
+		e.Name = ""
+		if e.UserAge != "" || e.UserGender != "" || e.UserCountry != "" || e.UserNativeSpeaker {
+			wg.Demographics++
+			e.UserAge, e.UserGender, e.UserCountry, e.UserNativeSpeaker = "", "", "", false
+		}
+		text := e.Rationale != "" || e.ErrorMessage != ""
+		for j := range e.Message {
+			text = text || e.Message[j] != ""
+			e.Message[j] = ""
+		}
+		if text {
+			wg.FreeText++
+		}
+		e.Rationale, e.ErrorMessage = "", ""
+	}
+	if _, ok := gs.players[playerID]; ok || wg.Events > 0 {
+		if gs.scrubbed == nil {
+			gs.scrubbed = map[string]bool{}
+		}
+		gs.scrubbed[playerID] = true
+	}
+	delete(gs.players, playerID)
+	delete(gs.spectators, playerID)
+	if wg.Events == 0 && wg.Mentions == 0 {
+		return wg, false
+	}
+	gs.Partial = true
+	return wg, true
+}
+
+// withdraw scrubs a player out of every game, live or stored,
+// and out of the report registry.
+func (h *handler) withdraw(playerID string) (Withdrawal, error) {
+	w := Withdrawal{Time: time.Now(), PlayerHash: hashPlayerID(playerID), Games: []WithdrawnGame{}}
+
+	h.mu.Lock()
+	live := make(map[string]*Game, len(h.games))
+	for id, g := range h.games {
+		live[id] = g
+	}
+	if _, ok := h.participants[playerID]; ok {
+		delete(h.participants, playerID)
+		w.Participant = true
+	}
+	for _, p := range h.participants {
+		for i := range p.Reports {
+			if r := &p.Reports[i]; r.ReporterID == playerID {
+				r.ReporterID, r.Text = "", ""
+				w.ReportsFiled++
+			}
+		}
+	}
+	for token, ref := range h.sessions {
+		if ref.PlayerID == playerID {
+			delete(h.sessions, token)
+		}
+	}
+	err := h.saveParticipants()
+	h.mu.Unlock()
+	if err != nil {
+		return w, err
+	}
+
+	for _, g := range live {
+		g.mu.Lock()
+		wg, ok := g.withdraw(playerID)
+		if ok {
+			wg.GameID = g.GameID
+			w.Games = append(w.Games, wg)
+			if err := h.store.rewrite(g); err != nil {
+				g.mu.Unlock()
+				return w, err
+			}
+			g.notifyAll()
+		}
+		g.mu.Unlock()
+	}
+	for _, id := range h.store.gamesOf(playerID) {
+		if live[id] != nil {
+			continue
+		}
+		g, err := h.store.load(id)
+		if err != nil {
+			return w, err
+		}
+		wg, ok := g.withdraw(playerID)
+		if !ok {
+			continue
+		}
+		wg.GameID = id
+		w.Games = append(w.Games, wg)
+		if err := h.store.rewrite(g); err != nil {
+			return w, err
+		}
+	}
+	h.store.forget(playerID)
+	return w, h.store.audit(w)
+}
+
+// audit appends a withdrawal to dir/withdrawals.jsonl.
+func (s *gameStore) audit(w Withdrawal) error {
+	b, err := json.Marshal(w)
+	if err != nil {
+		return err
+	}
+	log.Printf("withdrew player %s from %d games", w.PlayerHash, len(w.Games))
+	if s.dir == "" {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(s.dir, "withdrawals.jsonl"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// POST /withdraw
+// scrub a player who withdrew consent out of every game, and return the audit record
+func (h *handler) handleWithdraw(rw http.ResponseWriter, req *http.Request) {
+	var body struct {
+		Token    string `json:"token"`
+		PlayerID string `json:"player_id"` // the User ID workers copy into MTurk
+	}
+	err := json.NewDecoder(req.Body).Decode(&body)
+	if err != nil || body.PlayerID == "" {
+		writeError(rw, "malformed_body", "Unable to parse request body.", 400)
+		return
+	}
+	if !h.checkAdmin(rw, body.Token) {
+		return
+	}
+	if withdrawn(body.PlayerID) {
+		writeError(rw, "malformed_body", "That ID already stands in for a withdrawn player.", 400)
+		return
+	}
+
+	w, err := h.withdraw(body.PlayerID)
+	if err != nil {
+		writeError(rw, "internal_error", err.Error(), 500)
+		return
+	}
+	writeJSON(rw, w)
+}
@@ -0,0 +1,110 @@
+package gameapi
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithdrawLiveGame(t *testing.T) {
+	h := newTestHandler(t, Config{AdminToken: "secret"})
+	var game struct {
+		GameID string `json:"game_id"`
+	}
+	post(t, h, "/new-game", `{"player_id": "a", "name": "Ann"}`, &game)
+	post(t, h, "/new-game", `{"player_id": "b", "name": "Bo"}`, nil)
+	post(t, h, "/withdraw", `{"token": "secret", "player_id": "a"}`, nil)
+
+	// Their client may still be polling the game.
+	g := h.games[game.GameID]
+	g.markSeen("a", "Ann", 1, time.Now())
+	if _, ok := g.players["a"]; ok {
+		t.Error("Expected a withdrawn player to stay out of the game")
+	}
+	for _, e := range g.Events {
+		if e.PlayerID == "a" || e.Name == "Ann" {
+			t.Errorf("Expected no new events for a, got %+v", e)
+		}
+	}
+}
+
+func TestWithdraw(t *testing.T) {
+	dir := t.TempDir()
+	words := map[string][]string{"test": numberedWords(40)}
+	hh, err := Handler(words, Config{GameDir: dir, AdminToken: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := hh.(*handler)
+
+	var game struct {
+		GameID string `json:"game_id"`
+	}
+	post(t, h, "/new-game", `{"player_id": "a", "name": "Ann", "user_age": "30", "user_country": "Canada"}`, &game)
+	post(t, h, "/new-game", `{"player_id": "b", "name": "Bo"}`, nil)
+	g := h.games[game.GameID]
+	target := indexOf(g.OneLayout, Green)
+	g.addEvent(Event{Type: "chat", Team: 1, PlayerID: "a", Name: "Ann", Message: []string{"clue", g.Words[target]}, Num_target_words: 1})
+	g.addEvent(Event{Type: "guess", Team: 2, PlayerID: "b", Index: target, Rationale: "because"})
+	h.saveGames()
+
+	// A new server only has the stored copy.
+	hh, err = Handler(words, Config{GameDir: dir, AdminToken: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h = hh.(*handler)
+	if status := post(t, h, "/withdraw", `{"token": "wrong", "player_id": "a"}`, nil); status != 403 {
+		t.Errorf("Expected withdrawing to need the admin token, got %d", status)
+	}
+	var w Withdrawal
+	post(t, h, "/withdraw", `{"token": "secret", "player_id": "a"}`, &w)
+	if len(w.Games) != 1 {
+		t.Fatalf("Expected one game in the audit record, got %+v", w)
+	}
+	if wg := w.Games[0]; wg.GameID != game.GameID || wg.StandIn != "withdrawn-1" || wg.Events != 2 || wg.Demographics != 1 || wg.FreeText != 1 {
+		t.Errorf("Unexpected audit of the game %+v", wg)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, game.GameID+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{`"a"`, "Ann", "Canada", "clue"} {
+		if strings.Contains(string(b), s) {
+			t.Errorf("Expected %s to be scrubbed from the stored game", s)
+		}
+	}
+	audit, err := ioutil.ReadFile(filepath.Join(dir, "withdrawals.jsonl"))
+	if err != nil || strings.Count(string(audit), "\n") != 1 || strings.Contains(string(audit), `"a"`) {
+		t.Errorf("Expected one audit line without the player ID, got %q (%v)", audit, err)
+	}
+
+	g, err = h.store.load(game.GameID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !g.Partial || !g.Metrics().Partial {
+		t.Error("Expected the game to be marked partial")
+	}
+	if g.Metrics().Guesses != 1 {
+		t.Error("Expected the game to still replay")
+	}
+	if records := g.Records(); len(records) != 0 {
+		t.Errorf("Expected no records from a scrubbed clue, got %d", len(records))
+	}
+
+	var history struct {
+		Games []HistoryGame `json:"games"`
+	}
+	post(t, h, "/history", `{"player_id": "a", "token": "secret"}`, &history)
+	if len(history.Games) != 0 {
+		t.Errorf("Expected no history for a withdrawn player, got %+v", history.Games)
+	}
+	post(t, h, "/history", `{"player_id": "b", "token": "secret"}`, &history)
+	if len(history.Games) != 1 || history.Games[0].Partners[0] != (Partner{"withdrawn-1", "", 1}) {
+		t.Errorf("Expected b's partner to be a stand-in, got %+v", history.Games)
+	}
+}
@@ -0,0 +1,392 @@
+package gameapi
+
+import (
+	"codenamesgreen/dictionary-master"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// WordList is one immutable version of a named word list.
+// Lists are never edited in place: uploading a list under an
+// existing name adds a new version and leaves the old one
+// available to games that reference it.
+type WordList struct {
+	Name      string    `json:"name"`
+	Version   string    `json:"version"`
+	Words     []string  `json:"words,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WordListError lists every problem found while validating
+// an uploaded word list.
+type WordListError struct {
+	Problems []string
+}
+
+func (e *WordListError) Error() string {
+	return "invalid word list: " + strings.Join(e.Problems, "; ")
+}
+
+// WordListVersion returns the content hash identifying words.
+// The hash covers the words in order, because the order is part
+// of what ReconstructGame samples a board from.
+func WordListVersion(words []string) string {
+	h := sha256.New()
+	for _, w := range words {
+		h.Write([]byte(w))
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// ValidateWordList checks an uploaded list and returns its
+// canonical form: upper-cased, de-duplicated and sorted, the same
+// shape DefaultWordlists produces for the lists on disk. Blank
+// lines are ignored.
+func ValidateWordList(words []string) ([]string, error) {
+	var problems []string
+	seen := map[string]string{}
+	var valid []string
+	for _, w := range words {
+		w = strings.TrimSpace(w)
+		if w == "" {
+			continue
+		}
+		if !isSingleToken(w) {
+			problems = append(problems, fmt.Sprintf("%q is not a single word", w))
+			continue
+		}
+		folded := strings.ToUpper(w)
+		if prev, ok := seen[folded]; ok {
+			problems = append(problems, fmt.Sprintf("%q duplicates %q", w, prev))
+			continue
+		}
+		seen[folded] = w
+		valid = append(valid, w)
+	}
+	if len(valid) < minWordListSize {
+		problems = append(problems, fmt.Sprintf("a word list must have at least %d unique words, found %d", minWordListSize, len(valid)))
+	}
+	if len(problems) > 0 {
+		return nil, &WordListError{Problems: problems}
+	}
+	return canonicalWords(dictionary.WithWords(valid...)), nil
+}
+
+// minWordListSize is the fewest words an uploaded list may have,
+// enough for a standard Duet board. Larger layouts are checked
+// against their own size when a game is created.
+const minWordListSize = 25
+
+// isSingleToken reports whether w is made up only of letters,
+// so it can't be split into several tokens by a tokenizer.
+func isSingleToken(w string) bool {
+	for _, c := range w {
+		if !unicode.IsLetter(c) && !unicode.IsMark(c) {
+			return false
+		}
+	}
+	return true
+}
+
+func canonicalWords(d dictionary.Interface) []string {
+	words := d.Words()
+	sort.Strings(words)
+	return words
+}
+
+func isListName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if !isLetter(c) && !('0' <= c && c <= '9') && c != '_' && c != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// wordListStore holds every known version of every word list.
+// When dir is set, uploads are written to dir/<name>.txt so they
+// become the current list after a restart, and every version,
+// including those loaded at startup, to
+// dir/versions/<name>-<version>.txt so older versions stay
+// resolvable.
+type wordListStore struct {
+	dir string
+
+	mu    sync.Mutex
+	lists map[string][]WordList // by name, oldest first
+}
+
+func newWordListStore(dir string, initial map[string][]string) (*wordListStore, error) {
+	s := &wordListStore{
+		dir:   dir,
+		lists: make(map[string][]WordList),
+	}
+	if dir != "" {
+		matches, err := filepath.Glob(filepath.Join(dir, "versions", "*.txt"))
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range matches {
+			base := strings.TrimSuffix(filepath.Base(m), ".txt")
+			i := strings.LastIndex(base, "-")
+			if i <= 0 {
+				continue
+			}
+			d, err := dictionary.Load(m)
+			if err != nil {
+				return nil, err
+			}
+			info, err := os.Stat(m)
+			if err != nil {
+				return nil, err
+			}
+			s.insert(base[:i], canonicalWords(d), info.ModTime())
+		}
+		for _, versions := range s.lists {
+			sort.SliceStable(versions, func(i, j int) bool {
+				return versions[i].CreatedAt.Before(versions[j].CreatedAt)
+			})
+		}
+	}
+
+	// The lists loaded at startup are current, even if an older
+	// upload of the same content sorted after them above.
+	// They are saved as versions too, so games drawn from them
+	// can be rebuilt after an upload replaces them.
+	now := time.Now()
+	for name, words := range initial {
+		wl, _ := s.insert(name, words, now)
+		if err := s.saveVersion(wl); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// saveVersion writes a version to dir/versions, if it isn't
+// there already.
+func (s *wordListStore) saveVersion(wl WordList) error {
+	if s.dir == "" {
+		return nil
+	}
+	versionsDir := filepath.Join(s.dir, "versions")
+	filename := filepath.Join(versionsDir, wl.Name+"-"+wl.Version+".txt")
+	if _, err := os.Stat(filename); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(versionsDir, 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, wordListContent(wl.Words), 0644)
+}
+
+func wordListContent(words []string) []byte {
+	return []byte(strings.Join(words, "\n") + "\n")
+}
+
+// insert records words as the current version of name, unless
+// it already is. It returns the stored list and whether it's new.
+func (s *wordListStore) insert(name string, words []string, when time.Time) (WordList, bool) {
+	version := WordListVersion(words)
+	versions := s.lists[name]
+	if n := len(versions); n > 0 && versions[n-1].Version == version {
+		return versions[n-1], false
+	}
+	wl := WordList{Name: name, Version: version, Words: words, CreatedAt: when}
+	for i, old := range versions {
+		if old.Version == version {
+			// Re-uploading an older version makes it current again.
+			versions = append(versions[:i:i], versions[i+1:]...)
+			break
+		}
+	}
+	s.lists[name] = append(versions, wl)
+	return wl, true
+}
+
+// add validates and stores an uploaded list.
+func (s *wordListStore) add(name string, words []string) (WordList, error) {
+	if !isListName(name) {
+		return WordList{}, &WordListError{Problems: []string{
+			fmt.Sprintf("%q is not a valid list name; use letters, digits, '-' and '_'", name),
+		}}
+	}
+	words, err := ValidateWordList(words)
+	if err != nil {
+		return WordList{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	wl, isNew := s.insert(name, words, time.Now())
+	if !isNew || s.dir == "" {
+		return wl, nil
+	}
+
+	if err := s.saveVersion(wl); err != nil {
+		return wl, err
+	}
+	return wl, ioutil.WriteFile(filepath.Join(s.dir, name+".txt"), wordListContent(words), 0644)
+}
+
+// current returns the latest version of the named list.
+func (s *wordListStore) current(name string) (WordList, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	versions := s.lists[name]
+	if len(versions) == 0 {
+		return WordList{}, false
+	}
+	return versions[len(versions)-1], true
+}
+
+// version returns the list with the given content hash. When
+// lists of several names share it, the first name in order wins.
+func (s *wordListStore) version(version string) (WordList, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.lists))
+	for name := range s.lists {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, wl := range s.lists[name] {
+			if wl.Version == version {
+				return wl, true
+			}
+		}
+	}
+	return WordList{}, false
+}
+
+// all returns every stored version without its words,
+// sorted by name and then age.
+func (s *wordListStore) all() []WordList {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []WordList
+	for _, versions := range s.lists {
+		for _, wl := range versions {
+			wl.Words = nil
+			out = append(out, wl)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Name != out[j].Name {
+			return out[i].Name < out[j].Name
+		}
+		return out[i].CreatedAt.Before(out[j].CreatedAt)
+	})
+	return out
+}
+
+// wordsFor resolves the words a new game is drawn from: the words
+// sent with the request, a stored version, the current version of
+// a named list, or by default every word we know. It also returns
+// the name of the stored list, if one was used.
+func (h *handler) wordsFor(words []string, name, version string) ([]string, string, bool) {
+	switch {
+	case len(words) > 0:
+		return words, "", true
+	case version != "":
+		wl, ok := h.wordLists.version(version)
+		return wl.Words, wl.Name, ok
+	case name != "":
+		wl, ok := h.wordLists.current(name)
+		return wl.Words, wl.Name, ok
+	default:
+		return h.allWords, "", true
+	}
+}
+
+// POST /word-lists
+// list every stored version of every word list, without the words
+func (h *handler) handleWordLists(rw http.ResponseWriter, req *http.Request) {
+	writeJSON(rw, h.wordLists.all())
+}
+
+// POST /word-list
+// get a word list by version, or the current version of a named list
+func (h *handler) handleWordList(rw http.ResponseWriter, req *http.Request) {
+	var body struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+
+	err := json.NewDecoder(req.Body).Decode(&body)
+	if err != nil || (body.Name == "" && body.Version == "") {
+		writeError(rw, "malformed_body", "Unable to parse request body.", 400)
+		return
+	}
+
+	var wl WordList
+	var ok bool
+	if body.Version != "" {
+		wl, ok = h.wordLists.version(body.Version)
+	} else {
+		wl, ok = h.wordLists.current(body.Name)
+	}
+	if !ok {
+		writeError(rw, "not_found", "Word list not found", 404)
+		return
+	}
+	writeJSON(rw, wl)
+}
+
+// POST /upload-word-list
+// validate a word list and store it as the current version of its name.
+// Words may be sent as a list or as newline separated text.
+func (h *handler) handleUploadWordList(rw http.ResponseWriter, req *http.Request) {
+	var body struct {
+		Token string   `json:"token"`
+		Name  string   `json:"name"`
+		Words []string `json:"words"`
+		Text  string   `json:"text"`
+	}
+
+	err := json.NewDecoder(req.Body).Decode(&body)
+	if err != nil {
+		writeError(rw, "malformed_body", "Unable to parse request body.", 400)
+		return
+	}
+	if !h.checkAdmin(rw, body.Token) {
+		return
+	}
+
+	words := body.Words
+	if body.Text != "" {
+		words = append(words, strings.Split(body.Text, "\n")...)
+	}
+	wl, err := h.wordLists.add(body.Name, words)
+	if wlErr, ok := err.(*WordListError); ok {
+		rw.WriteHeader(400)
+		writeJSON(rw, struct {
+			Code     string   `json:"code"`
+			Message  string   `json:"message"`
+			Problems []string `json:"problems"`
+		}{Code: "invalid_word_list", Message: "The word list failed validation.", Problems: wlErr.Problems})
+		return
+	}
+	if err != nil {
+		writeError(rw, "storage_error", "Unable to save the word list: "+err.Error(), 500)
+		return
+	}
+	wl.Words = nil
+	writeJSON(rw, wl)
+}
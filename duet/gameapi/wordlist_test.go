@@ -0,0 +1,127 @@
+package gameapi
+
+import (
+	"codenamesgreen/dictionary-master"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func numberedWords(n int) []string {
+	letters := "abcdefghijklmnopqrstuvwxyz"
+	words := make([]string, n)
+	for i := range words {
+		words[i] = fmt.Sprintf("word%c%c", letters[i/26%26], letters[i%26])
+	}
+	return words
+}
+
+func TestValidateWordList(t *testing.T) {
+	var testCases = []struct {
+		words    []string
+		problems int
+	}{
+		{words: numberedWords(25), problems: 0},
+		{words: append(numberedWords(25), "", "  "), problems: 0},
+		{words: numberedWords(24), problems: 1},
+		{words: append(numberedWords(25), "WORDAA"), problems: 1},
+		{words: append(numberedWords(25), "ice cream", "x-ray"), problems: 2},
+		{words: append(numberedWords(24), "Wordaa"), problems: 2},
+	}
+
+	for _, tc := range testCases {
+		words, err := ValidateWordList(tc.words)
+		if tc.problems == 0 {
+			if err != nil {
+				t.Errorf("Expected %v to be valid, got %s", tc.words, err)
+			}
+			if len(words) != 25 || words[0] != "WORDAA" {
+				t.Errorf("Expected 25 canonical words starting with WORDAA, got %v", words)
+			}
+			continue
+		}
+		wlErr, ok := err.(*WordListError)
+		if !ok {
+			t.Errorf("Expected a *WordListError for %v, got %v", tc.words, err)
+			continue
+		}
+		if len(wlErr.Problems) != tc.problems {
+			t.Errorf("Expected %d problems for %v, got %v", tc.problems, tc.words, wlErr.Problems)
+		}
+	}
+}
+
+func TestWordListStoreVersions(t *testing.T) {
+	s, err := newWordListStore(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := s.add("study", numberedWords(25))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := s.add("study", numberedWords(30))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Version == second.Version {
+		t.Fatalf("Expected different versions, both were %s", first.Version)
+	}
+	if cur, _ := s.current("study"); cur.Version != second.Version {
+		t.Errorf("Expected current version %s, got %s", second.Version, cur.Version)
+	}
+	if old, ok := s.version(first.Version); !ok || len(old.Words) != 25 {
+		t.Errorf("Expected version %s to still resolve to 25 words", first.Version)
+	}
+
+	// Reloading from disk keeps both versions, with the latest current.
+	reloaded, err := newWordListStore(s.dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := reloaded.version(first.Version); !ok {
+		t.Errorf("Expected version %s to survive a reload", first.Version)
+	}
+	if n := len(reloaded.all()); n != 2 {
+		t.Errorf("Expected 2 stored versions after reload, got %d", n)
+	}
+}
+
+func TestStartupListsKeepTheirVersion(t *testing.T) {
+	dir := t.TempDir()
+	startup := canonicalWords(dictionary.WithWords(numberedWords(25)...))
+	s, err := newWordListStore(dir, map[string][]string{"original": startup, "copy": startup})
+	if err != nil {
+		t.Fatal(err)
+	}
+	version := WordListVersion(startup)
+	if wl, _ := s.version(version); wl.Name != "copy" {
+		t.Errorf("Expected the first name with the content, got %q", wl.Name)
+	}
+	if _, err := s.add("original", numberedWords(30)); err != nil {
+		t.Fatal(err)
+	}
+
+	// After a restart with the uploaded list as the one on disk,
+	// the startup version still resolves.
+	uploaded, _ := s.current("original")
+	reloaded, err := newWordListStore(dir, map[string][]string{"original": uploaded.Words})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wl, ok := reloaded.version(version); !ok || len(wl.Words) != 25 {
+		t.Errorf("Expected the startup version %s to survive an upload and a restart", version)
+	}
+}
+
+func TestUploadNeedsAdmin(t *testing.T) {
+	h := newTestHandler(t, Config{AdminToken: "secret"})
+	words := `"text": "` + strings.Join(numberedWords(25), `\n`) + `"`
+	if status := post(t, h, "/upload-word-list", `{"name": "study", `+words+`}`, nil); status != 403 {
+		t.Errorf("Expected an upload without a token to be refused, got %d", status)
+	}
+	if status := post(t, h, "/upload-word-list", `{"token": "secret", "name": "study", `+words+`}`, nil); status != 200 {
+		t.Errorf("Expected an admin's upload to be stored, got %d", status)
+	}
+}
@@ -57,6 +57,7 @@ type alias GameState =
     , events : List Event
     , oneLayout : List Color
     , twoLayout : List Color
+    , cols : Int
     }
 
 
@@ -290,13 +291,18 @@ decodeIndex =
 
 decoderGameState : D.Decoder GameState
 decoderGameState =
-    D.map6 GameState
+    D.map7 GameState
         (D.field "game_id" D.string)
         (D.field "state" (D.field "seed" D.string))
         (D.field "words" (D.list D.string))
         (D.field "state" (D.field "events" (D.list decodeEvent)))
         (D.field "one_layout" (D.list Color.decode))
         (D.field "two_layout" (D.list Color.decode))
+        (D.oneOf
+            [ D.field "state" (D.field "layout" (D.field "cols" D.int))
+            , D.succeed 5
+            ]
+        )
 
 
 decodeUpdate : D.Decoder Update
@@ -42,6 +42,7 @@ init state user client toMsg =
                         state.twoLayout
                         |> List.indexedMap (\i ( w, ( e1, l1 ), ( e2, l2 ) ) -> Cell i w ( e1, l1 ) ( e2, l2 ))
                         |> Array.fromList
+                , cols = state.cols
                 , player = { user = user, side = Nothing }
                 , guessesThisTurn = 0
                 , chatsThisTurn = 0
@@ -75,6 +76,7 @@ type alias Model =
     , players : Dict.Dict String Side
     , events : List Api.Event
     , cells : Array Cell
+    , cols : Int
     , player : Player
     , guessesThisTurn : Int
     , chatsThisTurn: Int
@@ -147,7 +149,10 @@ status g =
 
 remainingGreen : Array Cell -> Int
 remainingGreen cells =
-    15
+    (cells
+        |> Array.filter (\c -> Cell.sideColor Side.A c == Color.Green || Cell.sideColor Side.B c == Color.Green)
+        |> Array.length
+    )
         - (cells
             |> Array.map Cell.display
             |> Array.filter (\x -> x == Cell.ExposedGreen)
@@ -541,6 +546,7 @@ viewBoard model =
     in
     Keyed.node "div"
         [ Attr.id "board"
+        , Attr.style "grid-template-columns" (gridColumns model)
         , Attr.classList
             [ ( "no-team", model.player.side == Nothing )
             , ( "guessing", isGuessing )
@@ -557,6 +563,11 @@ viewBoard model =
         )
 
 
+gridColumns : Model -> String
+gridColumns model =
+    "repeat(" ++ String.fromInt model.cols ++ ", 1fr)"
+
+
 viewEvents : Model -> Html Msg
 viewEvents model =
     Keyed.node "div"
@@ -623,6 +634,31 @@ viewEvent model e =
         "player_left" ->
             div [] [ text e.name, text " has left the game." ]
 
+        "player_disconnected" ->
+            div [] [ text e.name, text " has lost their connection." ]
+
+        "player_reconnected" ->
+            div [] [ text e.name, text " is back." ]
+
+        "clock_warning" ->
+            div [] [ text "Hurry: time is running out!" ]
+
+        "turn_timeout" ->
+            div [] [ text "Side ", text (e.side |> Maybe.map Side.toString |> Maybe.withDefault ""), text " ran out of time." ]
+
+        "game_timeout" ->
+            div [] [ text "The game ran out of time." ]
+
+        "abandoned" ->
+            div [] [ text e.name, text " stopped playing, so this game is over." ]
+
+        "requeued" ->
+            if e.playerId == model.player.user.id then
+                div [] [ text "Reload the page to continue with a new partner." ]
+
+            else
+                text ""
+
         "guess" ->
             Array.get e.index model.cells
                 |> Maybe.map2
@@ -650,6 +686,14 @@ viewEvent model e =
             in
             div [] [ text e.name, sideEl, text ": ", text (Maybe.withDefault "" (Array.get 0 e.message)), text ", ", text (String.fromInt e.num_target_words) ]
 
+        "message" ->
+            div [ Attr.class "message" ]
+                [ text e.name
+                , text (e.side |> Maybe.map (\s -> " (" ++ Side.toString s ++ ")") |> Maybe.withDefault "")
+                , text " says: "
+                , text (Maybe.withDefault "" (Array.get 0 e.message))
+                ]
+
         "end_turn" ->
             case e.side of
                 Nothing ->
@@ -735,7 +779,7 @@ viewKeycard model side =
                     ]
 
             ShowKeycard ->
-                div [ Attr.id "key-card", onClick (ToggleKeyView ShowWords) ]
+                div [ Attr.id "key-card", Attr.style "grid-template-columns" (gridColumns model), onClick (ToggleKeyView ShowWords) ]
                     (model.cells
                         |> Array.toList
                         |> List.map